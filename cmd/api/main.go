@@ -28,13 +28,20 @@ func initConfig() {
 
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.timeout", "30s")
+	viper.SetDefault("session.store", "memory")
+	viper.SetDefault("session.path", "./data/sessions.json")
+	viper.SetDefault("session.ttl", "1h")
 }
 
 func main() {
 	initConfig()
 
-	// Initialize Prometheus client
-	promClient := prometheus.NewClient()
+	// Initialize Prometheus datasources
+	sources, err := prometheus.LoadRegistry()
+	if err != nil {
+		fmt.Printf("Error loading datasources: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize Echo instance
 	e := echo.New()
@@ -45,7 +52,7 @@ func main() {
 	e.Use(middleware.CORS())
 
 	// Register handlers
-	if err := server.RegisterHandlers(e, promClient); err != nil {
+	if err := server.RegisterHandlers(e, sources); err != nil {
 		fmt.Printf("Error registering handlers: %v\n", err)
 		os.Exit(1)
 	}
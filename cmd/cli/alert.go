@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/spf13/cobra"
+)
+
+var alertOpts struct {
+	group    string
+	severity string
+	output   string
+	backtest time.Duration
+	step     time.Duration
+}
+
+var alertCmd = &cobra.Command{
+	Use:     "alert [description]",
+	Short:   "Generate a Prometheus alerting rule from a description",
+	Example: `  txt2promql alert "alert when checkout error rate is above 5% for 10 minutes" --backtest 168h`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		llm, err := newLLM()
+		if err != nil {
+			return err
+		}
+		if llm == nil {
+			return errors.New("ai.api_key is required to convert questions")
+		}
+
+		ctx := context.Background()
+		pipeline, err := newPipeline(llm)
+		if err != nil {
+			return err
+		}
+		generator := rules.NewAlertGenerator(pipeline, llm)
+		result, err := generator.Generate(ctx, args[0], rules.AlertOptions{
+			Group:    alertOpts.group,
+			Severity: alertOpts.severity,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := writeOutput(alertOpts.output, []byte(result.YAML)); err != nil {
+			return err
+		}
+		if len(result.ValidationErrors) > 0 {
+			return fmt.Errorf("generated rule is invalid:\n  %s", strings.Join(result.ValidationErrors, "\n  "))
+		}
+
+		if alertOpts.backtest > 0 {
+			end := time.Now()
+			step := alertOpts.step
+			if step <= 0 {
+				step = rules.BacktestStep(alertOpts.backtest, time.Duration(result.Rule.For))
+			}
+			client, err := clientFor(ctx, pipeline.Datasources(), datasourceName, result.Rule.Expr, alertOpts.backtest)
+			if err != nil {
+				return err
+			}
+			bt, err := rules.BacktestAlert(ctx, client, result.Rule, end.Add(-alertOpts.backtest), end, step)
+			if err != nil {
+				return err
+			}
+			printBacktest(bt)
+		}
+		return nil
+	},
+}
+
+func printBacktest(bt *rules.Backtest) {
+	fmt.Fprintf(os.Stderr, "\nBacktest %s to %s (step %s): would have fired %d time(s)\n",
+		bt.Start.Format(time.RFC3339), bt.End.Format(time.RFC3339), bt.Step, bt.Firings)
+	for _, s := range bt.Series {
+		fmt.Fprintf(os.Stderr, "  %s\n", prometheus.SeriesName(s.Labels))
+		for _, e := range s.Episodes {
+			fmt.Fprintf(os.Stderr, "    %s  firing for %s\n", e.Start.Local().Format("2006-01-02 15:04"), e.For)
+		}
+	}
+}
+
+// writeOutput writes content to path, or to stdout when path is empty or -.
+func writeOutput(path string, content []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	return nil
+}
+
+func init() {
+	flags := alertCmd.Flags()
+	flags.StringVar(&alertOpts.group, "group", rules.DefaultAlertGroup, "rule group name")
+	flags.StringVar(&alertOpts.severity, "severity", "", "severity label (default: from the description, else warning)")
+	flags.StringVarP(&alertOpts.output, "output", "o", "-", "rule file to write, - for stdout")
+	flags.DurationVar(&alertOpts.backtest, "backtest", 0, "replay the rule over this past range, e.g. 168h")
+	flags.DurationVar(&alertOpts.step, "step", 0, "backtest resolution (default: half the rule's for duration, at most 1m)")
+	rootCmd.AddCommand(alertCmd)
+}
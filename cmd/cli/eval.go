@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/agentkube/txt2promql/internal/eval"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/spf13/cobra"
+)
+
+var evalOpts struct {
+	categories  []string
+	output      string
+	compare     string
+	minAccuracy float64
+	verbose     bool
+}
+
+var evalCmd = &cobra.Command{
+	Use:   "eval [dataset]",
+	Short: "Score conversions against a golden dataset",
+	Long: `Converts every question of a dataset against the dataset's fixed schema and
+scores the answer by exact match, AST equivalence after normalization and
+result equivalence on synthetic data. Prints accuracy, latency and token
+usage per category, and what changed since a previous run with --compare.`,
+	Example: `  txt2promql eval test/eval/golden.yaml -o run.json
+  txt2promql eval test/eval/golden.yaml --compare run.json --category latency`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "test/eval/golden.yaml"
+		if len(args) == 1 {
+			path = args[0]
+		}
+		dataset, err := eval.LoadDataset(path)
+		if err != nil {
+			return err
+		}
+
+		var previous *eval.Report
+		if evalOpts.compare != "" {
+			if previous, err = eval.LoadReport(evalOpts.compare); err != nil {
+				return err
+			}
+		}
+
+		llm, err := newLLM()
+		if err != nil {
+			return err
+		}
+		if llm == nil {
+			return errors.New("ai.api_key is required to convert questions")
+		}
+
+		sources, err := prometheus.LoadRegistry()
+		if err != nil {
+			return err
+		}
+		ds, err := sources.Get(datasourceName)
+		if err != nil {
+			return err
+		}
+		runner, err := eval.NewRunner(dataset, ds.Client, llm)
+		if err != nil {
+			return err
+		}
+		defer runner.Close()
+
+		report, err := runner.Run(context.Background(), eval.RunOptions{
+			Categories: evalOpts.categories,
+			OnCase: func(res eval.CaseResult) {
+				if !evalOpts.verbose {
+					return
+				}
+				status := "ok  "
+				if !res.Correct() {
+					status = "FAIL"
+				}
+				fmt.Fprintf(os.Stderr, "%s %-24s %s\n", status, res.ID, res.Latency)
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		report.Write(os.Stdout)
+		if previous != nil {
+			fmt.Println()
+			eval.Compare(previous, report).Write(os.Stdout)
+		}
+		if evalOpts.output != "" {
+			if err := report.Save(evalOpts.output); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %s\n", evalOpts.output)
+		}
+
+		if report.Overall.Result < evalOpts.minAccuracy {
+			return fmt.Errorf("accuracy %.1f%% is below the minimum of %.1f%%", report.Overall.Result*100, evalOpts.minAccuracy*100)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := evalCmd.Flags()
+	flags.StringSliceVar(&evalOpts.categories, "category", nil, "only run cases of these categories")
+	flags.StringVarP(&evalOpts.output, "output", "o", "", "save the report as JSON, to compare later runs against")
+	flags.StringVar(&evalOpts.compare, "compare", "", "previous report to diff this run against")
+	flags.Float64Var(&evalOpts.minAccuracy, "min-accuracy", 0, "fail when result accuracy is below this fraction")
+	flags.BoolVarP(&evalOpts.verbose, "verbose", "v", false, "print each case as it is scored")
+	rootCmd.AddCommand(evalCmd)
+}
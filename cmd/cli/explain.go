@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/spf13/cobra"
+)
+
+var explainNoLLM bool
+
+var explainCmd = &cobra.Command{
+	Use:   "explain [promql]",
+	Short: "Explain an arbitrary PromQL expression",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		explainer := agent.NewExplainer(nil)
+		if !explainNoLLM {
+			llm, err := newLLM()
+			if err != nil {
+				return err
+			}
+			if llm != nil {
+				explainer = agent.NewExplainer(llm)
+			}
+		}
+
+		structural, explanation, err := explainer.ExplainPromQL(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s\n\n", structural.Query)
+		for _, step := range structural.Steps {
+			fmt.Printf("%s- %s\n%s  %s\n", strings.Repeat("  ", step.Depth), step.Expr, strings.Repeat("  ", step.Depth), step.Text)
+		}
+		fmt.Printf("\n%s\n", explanation)
+		return nil
+	},
+}
+
+func init() {
+	explainCmd.Flags().BoolVar(&explainNoLLM, "no-llm", false, "only print the structural explanation")
+	rootCmd.AddCommand(explainCmd)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/agentkube/txt2promql/internal/grafana"
+	"github.com/spf13/cobra"
+)
+
+var grafanaExport struct {
+	questions          []string
+	exprs              []string
+	title              string
+	output             string
+	datasourceVariable bool
+	datasourceUID      string
+	templateVariables  bool
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export queries to other tools",
+}
+
+var exportGrafanaCmd = &cobra.Command{
+	Use:     "grafana",
+	Short:   "Export questions or PromQL expressions as a Grafana dashboard",
+	Example: `  txt2promql export grafana -q "error rate by service" -e 'up' --template-variables -o dashboard.json`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var queries []grafana.Query
+		for _, q := range grafanaExport.questions {
+			queries = append(queries, grafana.Query{Question: q})
+		}
+		for _, e := range grafanaExport.exprs {
+			queries = append(queries, grafana.Query{PromQL: e})
+		}
+		if len(queries) == 0 {
+			return errors.New("at least one --question or --expr is required")
+		}
+
+		llm, err := newLLM()
+		if err != nil {
+			return err
+		}
+		if llm == nil && len(grafanaExport.questions) > 0 {
+			return errors.New("ai.api_key is required to convert questions")
+		}
+
+		pipeline, err := newPipeline(llm)
+		if err != nil {
+			return err
+		}
+		if _, err := pipeline.Datasources().Get(datasourceName); err != nil {
+			return err
+		}
+		exporter := grafana.NewExporter(pipeline)
+		dashboard, err := exporter.Export(context.Background(), queries, grafana.ExportOptions{
+			Options: grafana.Options{
+				Title:              grafanaExport.title,
+				DatasourceVariable: grafanaExport.datasourceVariable,
+				DatasourceUID:      grafanaExport.datasourceUID,
+			},
+			TemplateVariables: grafanaExport.templateVariables,
+			Datasource:        datasourceName,
+		})
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if grafanaExport.output != "" && grafanaExport.output != "-" {
+			f, err := os.Create(grafanaExport.output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dashboard); err != nil {
+			return err
+		}
+		if out != os.Stdout {
+			fmt.Fprintf(os.Stderr, "Wrote %s\n", grafanaExport.output)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := exportGrafanaCmd.Flags()
+	flags.StringArrayVarP(&grafanaExport.questions, "question", "q", nil, "natural language question to add as a panel (repeatable)")
+	flags.StringArrayVarP(&grafanaExport.exprs, "expr", "e", nil, "PromQL expression to add as a panel (repeatable)")
+	flags.StringVar(&grafanaExport.title, "title", "", "dashboard title")
+	flags.StringVarP(&grafanaExport.output, "output", "o", "-", "output file, - for stdout")
+	flags.BoolVar(&grafanaExport.datasourceVariable, "datasource-variable", false, "add a $datasource variable used by every panel")
+	flags.StringVar(&grafanaExport.datasourceUID, "datasource-uid", "", "datasource uid when no datasource variable is used")
+	flags.BoolVar(&grafanaExport.templateVariables, "template-variables", false, "add variables for common labels such as namespace and job")
+
+	exportCmd.AddCommand(exportGrafanaCmd)
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/spf13/cobra"
+)
+
+var fakePromOpts struct {
+	listen string
+	now    string
+}
+
+var fakePromCmd = &cobra.Command{
+	Use:   "fake-prometheus file...",
+	Short: "Serve series from files over the Prometheus HTTP API",
+	Long: `Loads series into an in-memory Prometheus and serves the query, series,
+labels and metadata APIs, for development without a Prometheus. Files are
+loaded by extension: .yaml and .yml are promtool rule test files, .prom and
+.txt the text exposition format, .om OpenMetrics, and anything else the promql
+test "load" notation. Loaded samples start at the Unix epoch; instant queries
+without a time are evaluated at the newest sample unless --time is set.`,
+	Example: `  txt2promql fake-prometheus testdata/series.yaml --listen :9091
+  PROMETHEUS_URL=http://localhost:9091 txt2promql ask "request rate per job"`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		srv, err := promtest.NewServer()
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+
+		for _, path := range args {
+			if err := srv.LoadFile(path); err != nil {
+				return err
+			}
+		}
+		if fakePromOpts.now != "" {
+			now, err := time.Parse(time.RFC3339, fakePromOpts.now)
+			if err != nil {
+				return fmt.Errorf("invalid --time: %w", err)
+			}
+			srv.Now = now
+		}
+
+		fmt.Fprintf(os.Stderr, "Serving %d file(s) on %s\n", len(args), fakePromOpts.listen)
+		return http.ListenAndServe(fakePromOpts.listen, srv)
+	},
+}
+
+func init() {
+	fakePromCmd.Flags().StringVar(&fakePromOpts.listen, "listen", ":9091", "address to listen on")
+	fakePromCmd.Flags().StringVar(&fakePromOpts.now, "time", "", "default evaluation time (RFC 3339)")
+	rootCmd.AddCommand(fakePromCmd)
+}
@@ -1,10 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/config"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/provider/factory"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	cfgFile        string
+	datasourceName string
 )
 
 var rootCmd = &cobra.Command{
@@ -26,8 +40,81 @@ var convertCmd = &cobra.Command{
 }
 
 func init() {
+	cobra.OnInitialize(initConfig)
+
 	rootCmd.AddCommand(convertCmd)
-	rootCmd.PersistentFlags().String("config", "", "config file (default is $HOME/.text2promql.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.text2promql.yaml)")
+	rootCmd.PersistentFlags().String("schema-snapshot", "", "convert against a schema snapshot instead of Prometheus")
+	viper.BindPFlag("prometheus.schema_snapshot", rootCmd.PersistentFlags().Lookup("schema-snapshot"))
+	rootCmd.PersistentFlags().StringVar(&datasourceName, "datasource", "", "datasource to use (default: routed by metric and range)")
+}
+
+func initConfig() {
+	if cfgFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if _, err := os.Stat(filepath.Join(home, ".text2promql.yaml")); err == nil {
+				cfgFile = filepath.Join(home, ".text2promql.yaml")
+			}
+		}
+	}
+	// Without an explicit file, LoadConfig falls back to configs/config.yaml.
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+	}
+
+	if _, err := config.LoadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newLLM returns the configured LLM provider, or nil when it needs an API
+// key and none is set so that commands which can work without one degrade
+// gracefully.
+func newLLM() (provider.Provider, error) {
+	aiConfig, err := factory.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !aiConfig.Offline() && aiConfig.OpenAI.APIKey == "" {
+		return nil, nil
+	}
+	return factory.New(aiConfig)
+}
+
+// newPipeline returns a conversion pipeline over the configured
+// datasources, running on the configured schema snapshot when there is one.
+func newPipeline(llm provider.Provider) (*agent.Pipeline, error) {
+	sources, err := prometheus.LoadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sources.Get(datasourceName); err != nil {
+		return nil, err
+	}
+	pipeline := agent.NewPipelineFor(sources, llm)
+	if path := viper.GetString("prometheus.schema_snapshot"); path != "" {
+		snapshot, err := prometheus.LoadSnapshot(path)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.UseSnapshot(snapshot)
+	}
+	return pipeline, nil
+}
+
+// clientFor returns the client of the named datasource, or of the one
+// promQL routes to when it reaches lookback into the past.
+func clientFor(ctx context.Context, sources *prometheus.Registry, name, promQL string, lookback time.Duration) (*prometheus.Client, error) {
+	if name != "" {
+		ds, err := sources.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return ds.Client, nil
+	}
+	ds, _ := sources.RouteQuery(ctx, promQL, lookback)
+	return ds.Client, nil
 }
 
 func main() {
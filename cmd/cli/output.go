@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// Output formats for query results.
+const (
+	outputAuto      = "auto"
+	outputTable     = "table"
+	outputSparkline = "sparkline"
+	outputBraille   = "braille"
+	outputCSV       = "csv"
+	outputJSON      = "json"
+)
+
+// maxBrailleSeries is the most series drawn on one braille chart before
+// falling back to one sparkline per series.
+const maxBrailleSeries = 6
+
+var resultOutput struct {
+	format  string
+	noColor bool
+	height  int
+}
+
+func addOutputFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&resultOutput.format, "output", outputAuto, "output format: auto, table, sparkline, braille, csv or json")
+	flags.BoolVar(&resultOutput.noColor, "no-color", false, "disable colored output")
+	flags.IntVar(&resultOutput.height, "height", 10, "rows of the braille chart")
+}
+
+// writeResult prints a query result in the requested format. With the auto
+// format, a terminal gets charts and tables and anything else gets CSV.
+// metrics, which may be nil, types the metrics of promQL.
+func writeResult(w io.Writer, promQL string, result *prometheus.QueryResult, metrics map[string]prometheus.MetricSchema) error {
+	tty := isTerminal(w)
+	format := resultOutput.format
+	series := result.Series()
+
+	if format == outputAuto {
+		switch {
+		case !tty:
+			format = outputCSV
+		case result.Data.ResultType != prometheus.ResultMatrix:
+			format = outputTable
+		case len(series) > maxBrailleSeries:
+			format = outputSparkline
+		default:
+			format = outputBraille
+		}
+	}
+
+	opts := chart.TerminalOptions{
+		Width:        terminalWidth(w),
+		Height:       resultOutput.height,
+		Color:        tty && !resultOutput.noColor && os.Getenv("NO_COLOR") == "",
+		LegendFormat: chart.Suggest(promQL, result, metrics).LegendFormat,
+	}
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	case outputCSV:
+		return result.WriteCSV(w)
+	}
+
+	if len(series) == 0 {
+		fmt.Fprintln(w, "No data")
+		return nil
+	}
+	switch format {
+	case outputTable:
+		chart.WriteTable(w, series, opts)
+	case outputSparkline:
+		chart.WriteSparklines(w, series, opts)
+	case outputBraille:
+		chart.WriteBrailleChart(w, series, opts)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	return nil
+}
+
+// isTerminal reports whether w is a file open on a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// terminalWidth returns the width of the terminal w writes to, or $COLUMNS,
+// or 80.
+func terminalWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+func testResult(t *testing.T) *prometheus.QueryResult {
+	t.Helper()
+	var result prometheus.QueryResult
+	body := `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"api"},"value":[1700000000,"3"]}]}}`
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func TestWriteResultDetectsTerminalOnWriter(t *testing.T) {
+	resultOutput.format = outputAuto
+	want := "job,timestamp,value\napi,2023-11-14T22:13:20Z,3\n"
+
+	// Neither a buffer nor a regular file is a terminal, whatever stdout is.
+	var buf bytes.Buffer
+	if err := writeResult(&buf, "up", testResult(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("buffer: got %q, want CSV", buf.String())
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Fatal("regular file reported as a terminal")
+	}
+	if err := writeResult(f, "up", testResult(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(f.Name()); string(got) != want {
+		t.Errorf("file: got %q, want CSV", got)
+	}
+}
+
+func TestWriteResultFormats(t *testing.T) {
+	defer func() { resultOutput.format = outputAuto }()
+
+	resultOutput.format = outputJSON
+	var buf bytes.Buffer
+	if err := writeResult(&buf, "up", testResult(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded prometheus.QueryResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Data.Result) != 1 {
+		t.Errorf("json output %q: %v", buf.String(), err)
+	}
+
+	resultOutput.format = outputTable
+	buf.Reset()
+	if err := writeResult(&buf, "up", testResult(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("api")) {
+		t.Errorf("table output %q", buf.String())
+	}
+}
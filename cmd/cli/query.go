@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/chart"
+	parser "github.com/agentkube/txt2promql/internal/core/parser"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/spf13/cobra"
+)
+
+var queryRange struct {
+	window time.Duration
+	step   time.Duration
+}
+
+var queryCmd = &cobra.Command{
+	Use:   "query [promql]",
+	Short: "Execute a PromQL query and show the result in the terminal",
+	Long: `Execute a PromQL query. Instant results are shown as a table sorted by
+value, range results (--range) as a chart. When stdout is not a terminal the
+result is written as CSV.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		sources, err := prometheus.LoadRegistry()
+		if err != nil {
+			return err
+		}
+		client, err := clientFor(ctx, sources, datasourceName, args[0], queryRange.window)
+		if err != nil {
+			return err
+		}
+		result, err := execute(ctx, client, args[0], queryRange.window, queryRange.step)
+		if err != nil {
+			return err
+		}
+		metrics, _ := sources.Metrics(ctx)
+		return writeResult(os.Stdout, args[0], result, metrics)
+	},
+}
+
+var askCmd = &cobra.Command{
+	Use:   "ask [question]",
+	Short: "Convert a question to PromQL, execute it and answer it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		llm, err := newLLM()
+		if err != nil {
+			return err
+		}
+		if llm == nil {
+			return errors.New("ai.api_key is required to convert questions")
+		}
+
+		ctx := context.Background()
+		pipeline, err := newPipeline(llm)
+		if err != nil {
+			return err
+		}
+		window := queryRange.window
+		if intent, _ := parser.NewIntentParser().Parse(args[0]); window == 0 && intent.Range {
+			window = time.Hour
+		}
+		converted, err := pipeline.Convert(ctx, args[0], agent.ConvertOptions{
+			Datasource: datasourceName,
+			Lookback:   window,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s\n\n", converted.PromQL)
+
+		client, err := clientFor(ctx, pipeline.Datasources(), converted.Datasource, converted.PromQL, window)
+		if err != nil {
+			return err
+		}
+		result, err := execute(ctx, client, converted.PromQL, window, queryRange.step)
+		if err != nil {
+			return err
+		}
+		metrics, _ := pipeline.Metrics(ctx)
+		if err := writeResult(os.Stdout, converted.PromQL, result, metrics); err != nil {
+			return err
+		}
+
+		answer := agent.NewSummarizer(llm).Summarize(ctx, args[0], converted.PromQL, result)
+		fmt.Fprintf(os.Stderr, "\n%s\n", answer)
+		return nil
+	},
+}
+
+// execute runs promQL as a range query over the last window, or as an
+// instant query when window is zero. A zero step is derived from the window.
+func execute(ctx context.Context, client *prometheus.Client, promQL string, window, step time.Duration) (*prometheus.QueryResult, error) {
+	if window <= 0 {
+		return client.QueryInstant(ctx, promQL, nil)
+	}
+	if step <= 0 {
+		step = chart.DefaultStep(window)
+	}
+	end := time.Now()
+	return client.QueryRange(ctx, promQL, end.Add(-window), end, step)
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{queryCmd, askCmd} {
+		flags := cmd.Flags()
+		flags.DurationVar(&queryRange.window, "range", 0, "run a range query over this window, e.g. 1h")
+		flags.DurationVar(&queryRange.step, "step", 0, "range query resolution (default: range/120)")
+		addOutputFlags(flags)
+		rootCmd.AddCommand(cmd)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/spf13/cobra"
+)
+
+var recordingOpts struct {
+	group          string
+	interval       time.Duration
+	minOccurrences int
+	output         string
+}
+
+var recordingCmd = &cobra.Command{
+	Use:   "recording-rules [file]",
+	Short: "Suggest recording rules for expensive or repeated queries",
+	Long: `Reads PromQL queries, one per line, or a Prometheus query log, from file or
+stdin. Prints the rule file to --output and the rewritten queries to stderr.`,
+	Example: `  txt2promql recording-rules queries.txt -o recording.yml
+  txt2promql recording-rules /prometheus/query.log --min-occurrences 5`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var in io.Reader = os.Stdin
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		queries, err := rules.ReadQueries(in)
+		if err != nil {
+			return err
+		}
+		if len(queries) == 0 {
+			return errors.New("no queries to analyze")
+		}
+
+		analysis, err := rules.AnalyzeRecording(queries, rules.RecordingOptions{
+			Group:          recordingOpts.group,
+			Interval:       recordingOpts.interval,
+			MinOccurrences: recordingOpts.minOccurrences,
+		})
+		if err != nil {
+			return err
+		}
+		for _, q := range analysis.Skipped {
+			fmt.Fprintf(os.Stderr, "skipped invalid query: %s\n", q)
+		}
+		if analysis.File == nil {
+			fmt.Fprintln(os.Stderr, "No expensive or repeated subexpressions found.")
+			return nil
+		}
+
+		if err := writeOutput(recordingOpts.output, []byte(analysis.YAML)); err != nil {
+			return err
+		}
+		if errs := analysis.File.Validate(); len(errs) > 0 {
+			return fmt.Errorf("generated rules are invalid:\n  %s", strings.Join(errs, "\n  "))
+		}
+
+		if len(analysis.Rewrites) > 0 {
+			fmt.Fprintln(os.Stderr, "\nRewritten queries:")
+			for _, r := range analysis.Rewrites {
+				fmt.Fprintf(os.Stderr, "  %s\n    => %s\n", r.Original, r.Rewritten)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := recordingCmd.Flags()
+	flags.StringVar(&recordingOpts.group, "group", rules.DefaultRecordingGroup, "rule group name")
+	flags.DurationVar(&recordingOpts.interval, "interval", 0, "group evaluation interval (default: the global evaluation_interval)")
+	flags.IntVar(&recordingOpts.minOccurrences, "min-occurrences", 2, "how often a cheap subexpression must repeat to be recorded")
+	flags.StringVarP(&recordingOpts.output, "output", "o", "-", "rule file to write, - for stdout")
+	rootCmd.AddCommand(recordingCmd)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/spf13/cobra"
+)
+
+var renderOpts struct {
+	output  string
+	chart   string
+	width   int
+	height  int
+	theme   string
+	legend  bool
+	title   string
+	window  time.Duration
+	step    time.Duration
+	instant bool
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render [promql]",
+	Short: "Execute a PromQL query and render the result as a PNG or SVG chart",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		promQL := args[0]
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(renderOpts.output)), ".")
+
+		ctx := context.Background()
+		sources, err := prometheus.LoadRegistry()
+		if err != nil {
+			return err
+		}
+		lookback := renderOpts.window
+		if renderOpts.instant {
+			lookback = 0
+		}
+		client, err := clientFor(ctx, sources, datasourceName, promQL, lookback)
+		if err != nil {
+			return err
+		}
+
+		var result *prometheus.QueryResult
+		if renderOpts.instant {
+			result, err = client.QueryInstant(ctx, promQL, nil)
+		} else {
+			end := time.Now()
+			step := renderOpts.step
+			if step == 0 {
+				step = chart.DefaultStep(renderOpts.window)
+			}
+			result, err = client.QueryRange(ctx, promQL, end.Add(-renderOpts.window), end, step)
+		}
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(renderOpts.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		opts := chart.RenderOptions{
+			Type:   renderOpts.chart,
+			Format: format,
+			Width:  renderOpts.width,
+			Height: renderOpts.height,
+			Theme:  renderOpts.theme,
+			Legend: renderOpts.legend,
+			Title:  renderOpts.title,
+		}
+		metrics, _ := sources.Metrics(ctx)
+		if err := chart.Render(f, result, chart.Suggest(promQL, result, metrics), opts); err != nil {
+			os.Remove(renderOpts.output)
+			return err
+		}
+
+		fmt.Printf("Wrote %s\n", renderOpts.output)
+		return nil
+	},
+}
+
+func init() {
+	flags := renderCmd.Flags()
+	flags.StringVarP(&renderOpts.output, "output", "o", "chart.png", "output file; the extension (.png or .svg) selects the format")
+	flags.StringVar(&renderOpts.chart, "type", "", "chart type: time-series, bar, gauge or heatmap (default: suggested)")
+	flags.IntVar(&renderOpts.width, "width", 800, "image width in pixels")
+	flags.IntVar(&renderOpts.height, "height", 400, "image height in pixels")
+	flags.StringVar(&renderOpts.theme, "theme", chart.ThemeLight, "light or dark")
+	flags.BoolVar(&renderOpts.legend, "legend", false, "show a legend")
+	flags.StringVar(&renderOpts.title, "title", "", "chart title")
+	flags.DurationVar(&renderOpts.window, "range", time.Hour, "time range to render")
+	flags.DurationVar(&renderOpts.step, "step", 0, "range query resolution (default: range/120)")
+	flags.BoolVar(&renderOpts.instant, "instant", false, "render an instant query instead of a range")
+	rootCmd.AddCommand(renderCmd)
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/session"
+	"github.com/agentkube/txt2promql/internal/types"
+	"github.com/peterh/liner"
+	promql "github.com/prometheus/prometheus/promql/parser"
+	"github.com/spf13/cobra"
+)
+
+const replHelp = `Type a question to convert it; later questions refine the current query.
+
+  :run            execute the current query
+  :explain        explain the current query
+  :edit           edit the current PromQL by hand
+  :range <dur>    execute as a range query over <dur>, e.g. 6h; ":range off" for instant
+  :by <labels>    group the current query by labels, e.g. :by pod; ":by" alone removes grouping
+  :history        list the questions and queries of this session
+  :new            start over with a new session
+  :help           show this help
+  :quit           leave the REPL`
+
+var replCommands = []string{":run", ":explain", ":edit", ":range", ":by", ":history", ":new", ":help", ":quit"}
+
+var replCmd = &cobra.Command{
+	Use:   "repl",
+	Short: "Interactive shell for converting, refining and running queries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		llm, err := newLLM()
+		if err != nil {
+			return err
+		}
+		if llm == nil {
+			return errors.New("ai.api_key is required to convert questions")
+		}
+
+		pipeline, err := newPipeline(llm)
+		if err != nil {
+			return err
+		}
+		r := &repl{
+			pipeline:  pipeline,
+			explainer: agent.NewExplainer(llm),
+			session:   session.New(),
+			out:       os.Stdout,
+		}
+		return r.run()
+	},
+}
+
+// lineEditor is the part of the terminal line editor the commands use.
+type lineEditor interface {
+	PromptWithSuggestion(prompt, text string, pos int) (string, error)
+}
+
+// repl holds the state of an interactive session: the conversation so far
+// and the query the commands apply to. run owns the terminal; handle and the
+// commands only write to out and edit through editor.
+type repl struct {
+	pipeline  *agent.Pipeline
+	explainer *agent.Explainer
+	session   *session.Session
+	out       io.Writer
+	editor    lineEditor
+
+	// promQL is the current query. queryCtx is nil once it was edited by
+	// hand, since the context no longer describes it.
+	promQL   string
+	queryCtx *types.QueryContext
+	// datasource is the one the current query was validated on, which :run
+	// and :by keep using. Empty routes by the query.
+	datasource string
+	// window is the range :run executes over; zero runs an instant query.
+	window time.Duration
+}
+
+func (r *repl) run() error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(r.complete)
+	r.editor = line
+
+	historyPath := replHistoryPath()
+	if f, err := os.Open(historyPath); err == nil {
+		line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if f, err := os.Create(historyPath); err == nil {
+			line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	fmt.Fprintln(r.out, "txt2promql REPL. Type :help for commands.")
+	for {
+		input, err := line.Prompt("promql> ")
+		if errors.Is(err, liner.ErrPromptAborted) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+
+		if input == ":quit" || input == ":exit" {
+			return nil
+		}
+		if err := r.handle(context.Background(), input); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+	}
+}
+
+func (r *repl) handle(ctx context.Context, input string) error {
+	if !strings.HasPrefix(input, ":") {
+		return r.ask(ctx, input)
+	}
+
+	command, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case ":help":
+		fmt.Fprintln(r.out, replHelp)
+	case ":new":
+		r.session = session.New()
+		r.promQL, r.queryCtx, r.datasource, r.window = "", nil, "", 0
+		fmt.Fprintln(r.out, "Started a new session.")
+	case ":history":
+		r.history()
+	case ":run":
+		return r.execute(ctx)
+	case ":explain":
+		return r.explain(ctx)
+	case ":edit":
+		return r.edit()
+	case ":range":
+		return r.setRange(arg)
+	case ":by":
+		return r.groupBy(ctx, arg)
+	default:
+		return fmt.Errorf("unknown command %s, type :help for a list", command)
+	}
+	return nil
+}
+
+// ask converts a question, as a follow-up to the current query when there
+// is one.
+func (r *repl) ask(ctx context.Context, question string) error {
+	result, err := r.pipeline.Convert(ctx, question, agent.ConvertOptions{
+		Previous:   r.queryCtx,
+		Datasource: datasourceName,
+		Lookback:   r.window,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	r.record(question, result)
+	return nil
+}
+
+// groupBy rebuilds the current query grouped by labels.
+func (r *repl) groupBy(ctx context.Context, arg string) error {
+	if r.queryCtx == nil {
+		return r.noGeneratedQuery()
+	}
+
+	refined := *r.queryCtx
+	refined.GroupBy = strings.FieldsFunc(arg, func(c rune) bool { return c == ',' || c == ' ' })
+
+	result, err := r.pipeline.Resolve(ctx, &refined, r.datasource, r.window, nil)
+	if err != nil {
+		return err
+	}
+	r.record(":by "+arg, result)
+	return nil
+}
+
+func (r *repl) record(question string, result *agent.ConvertResult) {
+	r.promQL, r.queryCtx, r.datasource = result.PromQL, result.Context, result.Datasource
+	r.session.Turns = append(r.session.Turns, session.Turn{
+		Question:    question,
+		Context:     result.Context,
+		PromQL:      result.PromQL,
+		Explanation: result.Explanation,
+		CreatedAt:   time.Now(),
+	})
+	r.session.UpdatedAt = time.Now()
+
+	fmt.Fprintf(r.out, "\n  %s\n\n", result.PromQL)
+	if result.Confidence != nil {
+		fmt.Fprintf(r.out, "  confidence %.2f", result.Confidence.Score)
+	}
+	if result.Validation != nil && result.Validation.Valid {
+		fmt.Fprintf(r.out, ", %d series", result.Validation.Series)
+	}
+	fmt.Fprintf(r.out, "\n  %s\n\n", result.Explanation)
+}
+
+func (r *repl) execute(ctx context.Context) error {
+	if r.promQL == "" {
+		return errors.New("no current query, ask a question first")
+	}
+
+	client, err := clientFor(ctx, r.pipeline.Datasources(), r.datasource, r.promQL, r.window)
+	if err != nil {
+		return err
+	}
+	result, err := execute(ctx, client, r.promQL, r.window, 0)
+	if err != nil {
+		return err
+	}
+	metrics, _ := r.pipeline.Metrics(ctx)
+	return writeResult(r.out, r.promQL, result, metrics)
+}
+
+func (r *repl) explain(ctx context.Context) error {
+	if r.promQL == "" {
+		return errors.New("no current query, ask a question first")
+	}
+
+	structural, explanation, err := r.explainer.ExplainPromQL(ctx, r.promQL)
+	if err != nil {
+		return err
+	}
+	for _, step := range structural.Steps {
+		fmt.Fprintf(r.out, "%s- %s\n%s  %s\n", strings.Repeat("  ", step.Depth), step.Expr, strings.Repeat("  ", step.Depth), step.Text)
+	}
+	fmt.Fprintf(r.out, "\n%s\n", explanation)
+	return nil
+}
+
+// edit lets the user change the current query by hand. The edited query is
+// kept only if it parses.
+func (r *repl) edit() error {
+	if r.promQL == "" {
+		return errors.New("no current query, ask a question first")
+	}
+
+	edited, err := r.editor.PromptWithSuggestion("edit> ", r.promQL, -1)
+	if err != nil {
+		return nil
+	}
+	edited = strings.TrimSpace(edited)
+	if edited == "" || edited == r.promQL {
+		return nil
+	}
+	if _, err := promql.ParseExpr(edited); err != nil {
+		return fmt.Errorf("invalid PromQL, query unchanged: %w", err)
+	}
+
+	r.promQL, r.queryCtx = edited, nil
+	r.session.Turns = append(r.session.Turns, session.Turn{
+		Question:  ":edit",
+		PromQL:    edited,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (r *repl) setRange(arg string) error {
+	switch arg {
+	case "":
+		if r.window == 0 {
+			fmt.Fprintln(r.out, "Queries run as instant queries.")
+		} else {
+			fmt.Fprintf(r.out, "Queries run over the last %s.\n", r.window)
+		}
+		return nil
+	case "off":
+		r.window = 0
+		r.datasource = datasourceName
+		return nil
+	}
+
+	window, err := time.ParseDuration(arg)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid range %q", arg)
+	}
+	// The datasource the query was validated on may not keep data that far
+	// back, so route again unless one was pinned.
+	r.window = window
+	r.datasource = datasourceName
+	return nil
+}
+
+func (r *repl) history() {
+	for i, turn := range r.session.Turns {
+		fmt.Fprintf(r.out, "%3d  %s\n     %s\n", i+1, turn.Question, turn.PromQL)
+	}
+}
+
+func (r *repl) noGeneratedQuery() error {
+	if r.promQL != "" {
+		return errors.New("the current query was edited by hand; ask a question to refine it")
+	}
+	return errors.New("no current query, ask a question first")
+}
+
+// complete offers commands at the start of a line, label names after :by,
+// and metric and label names from the discovered schema everywhere else.
+func (r *repl) complete(line string, pos int) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+	start := strings.LastIndexFunc(head, func(c rune) bool {
+		return !(c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+	}) + 1
+	word := head[start:]
+	head = head[:start]
+
+	var candidates []string
+	switch {
+	case start == 0 && strings.HasPrefix(word, ":"):
+		candidates = replCommands
+	case strings.HasPrefix(line, ":by "):
+		candidates = r.labelNames()
+	case word == "":
+		return head, nil, tail
+	default:
+		candidates = append(r.metricNames(), r.labelNames()...)
+	}
+
+	var completions []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			completions = append(completions, c)
+		}
+	}
+	sort.Strings(completions)
+	return head, completions, tail
+}
+
+func (r *repl) metricNames() []string {
+	metrics, err := r.pipeline.Metrics(context.Background())
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	return names
+}
+
+// labelNames returns the labels of the current metric, or of every metric
+// when there is no current query.
+func (r *repl) labelNames() []string {
+	metrics, err := r.pipeline.Metrics(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for name, schema := range metrics {
+		if r.queryCtx != nil && name != r.queryCtx.MainMetric {
+			continue
+		}
+		for label := range schema.LabelValues {
+			seen[label] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for label := range seen {
+		names = append(names, label)
+	}
+	return names
+}
+
+func replHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".txt2promql_history"
+	}
+	return filepath.Join(home, ".txt2promql_history")
+}
+
+func init() {
+	addOutputFlags(replCmd.Flags())
+	rootCmd.AddCommand(replCmd)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/session"
+)
+
+// fakeEditor answers edit prompts with a fixed line.
+type fakeEditor struct {
+	line       string
+	suggestion string
+}
+
+func (e *fakeEditor) PromptWithSuggestion(prompt, text string, pos int) (string, error) {
+	e.suggestion = text
+	return e.line, nil
+}
+
+func newTestREPL(t *testing.T) (*repl, *bytes.Buffer, *fakeEditor) {
+	t.Helper()
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	err = srv.Load(`
+load 1m
+  http_requests_total{job="api", code="200"} 0+60x60
+  http_requests_total{job="web", code="200"} 0+30x60
+  up{job="api", instance="api-0"} 1x60
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm, err := mock.New([]mock.Rule{{
+		Pattern:  `Query: request rate$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate"}`,
+	}}, nil, "explanation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	editor := &fakeEditor{}
+	return &repl{
+		pipeline:  agent.NewPipeline(prometheus.NewClientFor(srv.Start(), 5*time.Second), llm),
+		explainer: agent.NewExplainer(llm),
+		session:   session.New(),
+		out:       out,
+		editor:    editor,
+	}, out, editor
+}
+
+func TestREPLCommands(t *testing.T) {
+	r, out, editor := newTestREPL(t)
+	ctx := context.Background()
+	resultOutput.format = outputCSV
+	defer func() { resultOutput.format = outputAuto }()
+
+	if err := r.handle(ctx, ":run"); err == nil {
+		t.Error(":run without a query succeeded")
+	}
+
+	if err := r.handle(ctx, "request rate"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(r.promQL, "rate(http_requests_total[") || !strings.Contains(out.String(), r.promQL) {
+		t.Fatalf("got query %q, output %q", r.promQL, out)
+	}
+
+	if err := r.handle(ctx, ":by job"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(r.promQL, "by (job)") {
+		t.Errorf(":by job: got %q", r.promQL)
+	}
+
+	out.Reset()
+	if err := r.handle(ctx, ":run"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], "job,") {
+		t.Errorf(":run: got %q", out)
+	}
+
+	for _, tt := range []struct {
+		arg     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"6h", 6 * time.Hour, false},
+		{"soon", 6 * time.Hour, true},
+		{"-1h", 6 * time.Hour, true},
+		{"off", 0, false},
+	} {
+		err := r.handle(ctx, ":range "+tt.arg)
+		if (err != nil) != tt.wantErr || r.window != tt.want {
+			t.Errorf(":range %s: got window %s, error %v", tt.arg, r.window, err)
+		}
+	}
+	out.Reset()
+	if err := r.handle(ctx, ":range"); err != nil || !strings.Contains(out.String(), "instant") {
+		t.Errorf(":range: got %q, %v", out, err)
+	}
+
+	editor.line = "sum(rate(http_requests_total[5m]))"
+	before := r.promQL
+	if err := r.handle(ctx, ":edit"); err != nil {
+		t.Fatal(err)
+	}
+	if editor.suggestion != before || r.promQL != editor.line || r.queryCtx != nil {
+		t.Errorf(":edit: suggested %q, got %q", editor.suggestion, r.promQL)
+	}
+	editor.line = "sum(rate("
+	if err := r.handle(ctx, ":edit"); err == nil || r.promQL != "sum(rate(http_requests_total[5m]))" {
+		t.Errorf("invalid edit: got %q, %v", r.promQL, err)
+	}
+	if err := r.handle(ctx, ":by job"); err == nil || !strings.Contains(err.Error(), "edited by hand") {
+		t.Errorf(":by after :edit: got %v", err)
+	}
+
+	out.Reset()
+	if err := r.handle(ctx, ":history"); err != nil {
+		t.Fatal(err)
+	}
+	history := out.String()
+	for _, want := range []string{"1  request rate", "2  :by job", "3  :edit", "sum(rate(http_requests_total[5m]))"} {
+		if !strings.Contains(history, want) {
+			t.Errorf(":history missing %q in %q", want, history)
+		}
+	}
+
+	if err := r.handle(ctx, ":new"); err != nil || r.promQL != "" || len(r.session.Turns) != 0 {
+		t.Errorf(":new left %q, %d turns, %v", r.promQL, len(r.session.Turns), err)
+	}
+	if err := r.handle(ctx, ":nope"); err == nil {
+		t.Error("unknown command accepted")
+	}
+}
+
+func TestREPLComplete(t *testing.T) {
+	r, _, _ := newTestREPL(t)
+
+	tests := []struct {
+		line string
+		head string
+		want []string
+	}{
+		{":r", "", []string{":range", ":run"}},
+		{":by j", ":by ", []string{"job"}},
+		{"rate(http_", "rate(", []string{"http_requests_total"}},
+		{"show in", "show ", []string{"instance"}},
+		{"show ", "show ", nil},
+	}
+	for _, tt := range tests {
+		head, got, tail := r.complete(tt.line, len(tt.line))
+		if head != tt.head || !reflect.DeepEqual(got, tt.want) || tail != "" {
+			t.Errorf("complete(%q): got %q %v %q, want %q %v", tt.line, head, got, tail, tt.head, tt.want)
+		}
+	}
+
+	// With a current query, :by only offers its labels.
+	if err := r.handle(context.Background(), "request rate"); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, _ := r.complete(":by ", 4); !reflect.DeepEqual(got, []string{"code", "job"}) {
+		t.Errorf(":by labels: got %v", got)
+	}
+}
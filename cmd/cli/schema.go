@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/spf13/cobra"
+)
+
+var schemaOpts struct {
+	output    string
+	format    string
+	maxValues int
+
+	diffFormat string
+	exitCode   bool
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Export and compare schema snapshots",
+	Long: `A schema snapshot is the metric schema discovered from Prometheus, saved
+to a file. Conversions run against it with --schema-snapshot, or
+prometheus.schema_snapshot in the config, without contacting Prometheus.`,
+}
+
+var schemaExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Save the discovered schema to a snapshot file",
+	Long: `Discovers the schema from Prometheus, or the --datasource datasource, and
+writes metric names, types, HELP, units, label names, sampled label values and
+cardinalities. The format is taken from --format, else from the extension of
+--output, else JSON.`,
+	Example: `  txt2promql schema export -o schema.json
+  txt2promql --schema-snapshot schema.json alert "error rate above 5% on checkout"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := schemaOpts.format
+		if format == "" {
+			format = prometheus.SnapshotFormat(schemaOpts.output)
+		}
+		if format != "json" && format != "yaml" {
+			return fmt.Errorf("unknown format %q, use json or yaml", format)
+		}
+
+		sources, err := prometheus.LoadRegistry()
+		if err != nil {
+			return err
+		}
+		ds, err := sources.Get(datasourceName)
+		if err != nil {
+			return err
+		}
+		metrics, err := ds.Schema.Metrics(context.Background())
+		if err != nil {
+			return fmt.Errorf("discovering schema: %w", err)
+		}
+		if len(metrics) == 0 {
+			return errors.New("Prometheus reported no metrics")
+		}
+
+		snapshot := prometheus.NewSnapshot(metrics, ds.Address, schemaOpts.maxValues)
+		var buf bytes.Buffer
+		if err := snapshot.Encode(&buf, format); err != nil {
+			return err
+		}
+		if err := writeOutput(schemaOpts.output, buf.Bytes()); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d metrics\n", len(snapshot.Metrics))
+		return nil
+	},
+}
+
+var schemaDiffCmd = &cobra.Command{
+	Use:   "diff old new",
+	Short: "Compare two schema snapshots",
+	Long: `Lists metrics added (+), removed (-) and changed (~) between two snapshots.
+Changes are type, unit, series count, labels and label cardinality.`,
+	Example: `  txt2promql schema diff schema-2024-05.json schema-2024-06.json
+  txt2promql schema diff old.yaml new.yaml --format json --exit-code`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := prometheus.LoadSnapshot(args[0])
+		if err != nil {
+			return err
+		}
+		to, err := prometheus.LoadSnapshot(args[1])
+		if err != nil {
+			return err
+		}
+
+		diff := prometheus.DiffSnapshots(from, to)
+		switch schemaOpts.diffFormat {
+		case "", "text":
+			err = diff.Write(os.Stdout)
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(diff)
+		default:
+			return fmt.Errorf("unknown format %q, use text or json", schemaOpts.diffFormat)
+		}
+		if err != nil {
+			return err
+		}
+		if schemaOpts.exitCode && !diff.Empty() {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	schemaExportCmd.Flags().StringVarP(&schemaOpts.output, "output", "o", "-", "snapshot file, - for stdout")
+	schemaExportCmd.Flags().StringVar(&schemaOpts.format, "format", "", "json or yaml")
+	schemaExportCmd.Flags().IntVar(&schemaOpts.maxValues, "max-values", prometheus.DefaultSnapshotValues, "label values to keep per label")
+	schemaDiffCmd.Flags().StringVar(&schemaOpts.diffFormat, "format", "text", "text or json")
+	schemaDiffCmd.Flags().BoolVar(&schemaOpts.exitCode, "exit-code", false, "exit with status 1 when the snapshots differ")
+
+	schemaCmd.AddCommand(schemaExportCmd, schemaDiffCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/spf13/cobra"
+)
+
+var sloOpts struct {
+	errors string
+	good   string
+	total  string
+	format string
+	output string
+}
+
+var sloCmd = &cobra.Command{
+	Use:   "slo [description]",
+	Short: "Generate SLO queries, recording rules and burn-rate alerts",
+	Long: `Generates the SLI, error budget and burn-rate queries for an SLO, with the
+recording rules and multi-window burn-rate alerts they depend on. The SLI
+metrics are discovered from Prometheus unless given with --errors or --good
+and --total.`,
+	Example: `  txt2promql slo "99.9% of checkout requests succeed over 30 days" -o slo.yml
+  txt2promql slo "99% of search requests complete within 300ms" --format json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if sloOpts.format != "yaml" && sloOpts.format != "json" {
+			return fmt.Errorf("unknown format %q, use yaml or json", sloOpts.format)
+		}
+
+		// Discovery only needs the schema, so no LLM is required.
+		pipeline, err := newPipeline(nil)
+		if err != nil {
+			return err
+		}
+		generator := rules.NewSLOGenerator(pipeline)
+		result, err := generator.Generate(context.Background(), args[0], rules.SLOOptions{
+			Errors: sloOpts.errors,
+			Good:   sloOpts.good,
+			Total:  sloOpts.total,
+		})
+		if err != nil {
+			return err
+		}
+
+		content := []byte(result.YAML)
+		if sloOpts.format == "json" {
+			if content, err = json.MarshalIndent(result, "", "  "); err != nil {
+				return err
+			}
+			content = append(content, '\n')
+		}
+		if err := writeOutput(sloOpts.output, content); err != nil {
+			return err
+		}
+
+		for _, note := range result.SLI.Notes {
+			fmt.Fprintf(os.Stderr, "note: %s\n", note)
+		}
+		if len(result.ValidationErrors) > 0 {
+			return fmt.Errorf("generated rules are invalid:\n  %s", strings.Join(result.ValidationErrors, "\n  "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := sloCmd.Flags()
+	flags.StringVar(&sloOpts.errors, "errors", "", "selector counting failed requests, e.g. 'http_requests_total{code=~\"5..\"}'")
+	flags.StringVar(&sloOpts.good, "good", "", "selector counting requests within the latency threshold, for latency SLOs")
+	flags.StringVar(&sloOpts.total, "total", "", "selector counting all requests")
+	flags.StringVar(&sloOpts.format, "format", "yaml", "output format: yaml rule file or json with the queries")
+	flags.StringVarP(&sloOpts.output, "output", "o", "-", "file to write, - for stdout")
+	rootCmd.AddCommand(sloCmd)
+}
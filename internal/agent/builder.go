@@ -2,6 +2,7 @@ package agent
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/agentkube/txt2promql/internal/types"
@@ -22,10 +23,6 @@ func (qb *QueryBuilder) Build(ctx *types.QueryContext) (string, []string) {
 		return "", warnings
 	}
 
-	if ctx.Aggregation != "" {
-		parts = append(parts, ctx.Aggregation, "(")
-	}
-
 	parts = append(parts, ctx.MainMetric)
 
 	if len(ctx.Labels) > 0 {
@@ -33,6 +30,7 @@ func (qb *QueryBuilder) Build(ctx *types.QueryContext) (string, []string) {
 		for k, v := range ctx.Labels {
 			labelParts = append(labelParts, fmt.Sprintf("%s=%q", k, v))
 		}
+		sort.Strings(labelParts)
 		parts = append(parts, "{"+strings.Join(labelParts, ",")+"}")
 	}
 
@@ -40,10 +38,29 @@ func (qb *QueryBuilder) Build(ctx *types.QueryContext) (string, []string) {
 		parts = append(parts, fmt.Sprintf("[%s]", ctx.TimeRange.Duration.String()))
 	}
 
-	if ctx.Aggregation != "" {
-		parts = append(parts, ")")
+	promQL := strings.Join(parts, "")
+
+	switch {
+	case len(ctx.GroupBy) > 0 && isAggregationOperator(ctx.Aggregation):
+		promQL = fmt.Sprintf("%s by (%s) (%s)", ctx.Aggregation, strings.Join(ctx.GroupBy, ", "), promQL)
+	case len(ctx.GroupBy) > 0:
+		if ctx.Aggregation != "" {
+			promQL = ctx.Aggregation + "(" + promQL + ")"
+		}
+		promQL = fmt.Sprintf("sum by (%s) (%s)", strings.Join(ctx.GroupBy, ", "), promQL)
+	case ctx.Aggregation != "":
+		promQL = ctx.Aggregation + "(" + promQL + ")"
 	}
 
-	promQL := strings.Join(parts, "")
 	return promQL, warnings
 }
+
+// isAggregationOperator reports whether agg is a PromQL aggregation operator
+// that accepts a by clause, as opposed to a function such as rate.
+func isAggregationOperator(agg string) bool {
+	switch agg {
+	case "sum", "avg", "count", "min", "max", "stddev", "stdvar", "group":
+		return true
+	}
+	return false
+}
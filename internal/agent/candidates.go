@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/query"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+// maxQueryCandidates caps how many alternatives a single request can ask for.
+const maxQueryCandidates = 10
+
+// duplicatePenalty scales the rank score of a candidate that is the same
+// expression as a better ranked one up to label order or formatting.
+const duplicatePenalty = 0.5
+
+// Candidate is one of several alternative queries for a broad question.
+type Candidate struct {
+	Rank        int                          `json:"rank"`
+	PromQL      string                       `json:"promql"`
+	Description string                       `json:"description,omitempty"`
+	Explanation string                       `json:"explanation,omitempty"`
+	Validation  *prometheus.ValidationResult `json:"validation"`
+	Confidence  *Confidence                  `json:"confidence"`
+	// RankScore is the confidence score after the duplicate penalty.
+	RankScore float64 `json:"rank_score"`
+	// DuplicateOf is the rank of the candidate this one repeats, if any.
+	DuplicateOf int                 `json:"duplicate_of,omitempty"`
+	Context     *types.QueryContext `json:"-"`
+
+	normalized string
+	duplicate  bool
+}
+
+// convertCandidates builds, validates, scores and explains up to
+// opts.Candidates interpretations of question and ranks them. The best
+// candidate also fills the primary fields of the result.
+func (p *Pipeline) convertCandidates(ctx context.Context, question string, opts ConvertOptions, candidates, metrics map[string]prometheus.MetricSchema, emit EventFunc) (*ConvertResult, error) {
+	n := opts.Candidates
+	if n > maxQueryCandidates {
+		n = maxQueryCandidates
+	}
+
+	interpretations, err := p.extractor.ExtractInterpretations(ctx, question, n, candidates, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrContextExtraction, err)
+	}
+
+	var ranked []Candidate
+	for _, in := range interpretations {
+		promQL, _ := p.builder.Build(in.Context)
+		if promQL == "" {
+			continue
+		}
+
+		validation, err := p.validate(ctx, promQL, metrics, p.route(ctx, promQL, opts.Datasource, opts.Lookback))
+		if err != nil {
+			return nil, err
+		}
+
+		normalized, err := query.Normalize(promQL)
+		if err != nil {
+			normalized = promQL
+		}
+
+		ranked = append(ranked, Candidate{
+			PromQL:      promQL,
+			Description: in.Description,
+			Validation:  validation,
+			Confidence:  p.scorer.Score(in.Context, promQL, validation, metrics),
+			Context:     in.Context,
+			normalized:  normalized,
+		})
+	}
+	if len(ranked) == 0 {
+		return nil, ErrNoPromQL
+	}
+
+	rankCandidates(ranked)
+
+	for i := range ranked {
+		if !ranked[i].duplicate {
+			ranked[i].Explanation = p.explainer.GenerateExplanation(ctx, ranked[i].Context, ranked[i].PromQL)
+		}
+		emit(Event{Stage: StageCandidate, Data: ranked[i]})
+	}
+
+	best := ranked[0]
+	explanation := best.Explanation
+	if !best.Validation.Valid {
+		explanation += " (Generated PromQL query may not be accurate)"
+	}
+
+	return &ConvertResult{
+		Context:        best.Context,
+		PromQL:         best.PromQL,
+		Explanation:    explanation,
+		Validation:     best.Validation,
+		Confidence:     best.Confidence,
+		Datasource:     best.Validation.Datasource,
+		SimilarMetrics: p.patterns.FindSimilarMetrics(best.Context.MainMetric, metrics),
+		Candidates:     ranked,
+	}, nil
+}
+
+// rankCandidates orders candidates by confidence, penalising every
+// candidate whose normalized expression already appeared with a higher
+// score, and assigns ranks starting at 1.
+func rankCandidates(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence.Score > candidates[j].Confidence.Score
+	})
+
+	seen := make(map[string]bool)
+	for i := range candidates {
+		c := &candidates[i]
+		c.RankScore = c.Confidence.Score
+		if seen[c.normalized] {
+			c.RankScore *= duplicatePenalty
+			c.duplicate = true
+			continue
+		}
+		seen[c.normalized] = true
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].RankScore > candidates[j].RankScore
+	})
+
+	rankOf := make(map[string]int)
+	for i := range candidates {
+		candidates[i].Rank = i + 1
+		if !candidates[i].duplicate {
+			rankOf[candidates[i].normalized] = i + 1
+		}
+	}
+	for i := range candidates {
+		if candidates[i].duplicate {
+			candidates[i].DuplicateOf = rankOf[candidates[i].normalized]
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/query"
+)
+
+func TestRankCandidatesPenalisesDuplicates(t *testing.T) {
+	candidate := func(promQL string, score float64) Candidate {
+		normalized, err := query.Normalize(promQL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Candidate{PromQL: promQL, Confidence: &Confidence{Score: score}, normalized: normalized}
+	}
+	// The second query is the first with its matchers reordered.
+	candidates := []Candidate{
+		candidate(`rate(http_requests_total{job="api", code="500"}[5m])`, 0.9),
+		candidate(`rate(http_requests_total{code="500", job="api"}[5m])`, 0.8),
+		candidate(`sum(up)`, 0.6),
+	}
+	rankCandidates(candidates)
+
+	want := []struct {
+		promQL      string
+		rankScore   float64
+		duplicateOf int
+	}{
+		{`rate(http_requests_total{job="api", code="500"}[5m])`, 0.9, 0},
+		{`sum(up)`, 0.6, 0},
+		{`rate(http_requests_total{code="500", job="api"}[5m])`, 0.8 * duplicatePenalty, 1},
+	}
+	for i, w := range want {
+		c := candidates[i]
+		if c.Rank != i+1 || c.PromQL != w.promQL || c.RankScore != w.rankScore || c.DuplicateOf != w.duplicateOf {
+			t.Errorf("rank %d: got %s (rank score %v, duplicate of %d), want %s (rank score %v, duplicate of %d)",
+				i+1, c.PromQL, c.RankScore, c.DuplicateOf, w.promQL, w.rankScore, w.duplicateOf)
+		}
+	}
+}
+
+func TestExtractInterpretationsKeepsCandidateWithBadDescription(t *testing.T) {
+	llm, err := mock.New(nil, nil, `[
+		{"metric": "http_requests_total", "aggregation": "rate", "timeRange": "5m", "description": "request rate"},
+		{"metric": "http_requests_total", "aggregation": "increase", "timeRange": "1h", "description": 5}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpretations, err := NewContextExtractor(llm).ExtractInterpretations(context.Background(), "traffic", 3, clarifyMetrics, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interpretations) != 2 || interpretations[0].Description != "request rate" || interpretations[1].Description != "" {
+		t.Fatalf("got %+v", interpretations)
+	}
+}
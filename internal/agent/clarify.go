@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+// maxClarifyOptions caps how many interpretations are offered to the user.
+// Labels with more values than this are treated as dimensions rather than
+// choices.
+const maxClarifyOptions = 5
+
+// Clarification lists the interpretations of an ambiguous question. The
+// client answers by picking one of the option ids.
+type Clarification struct {
+	ID       string                `json:"id"`
+	Question string                `json:"question"`
+	Options  []ClarificationOption `json:"options"`
+	// Datasource is the datasource the question was asked against, which
+	// the answer is resolved on.
+	Datasource string `json:"datasource,omitempty"`
+}
+
+type ClarificationOption struct {
+	ID          string              `json:"id"`
+	Description string              `json:"description"`
+	PromQL      string              `json:"promql"`
+	Context     *types.QueryContext `json:"-"`
+}
+
+// Option returns the option with the given id.
+func (c *Clarification) Option(id string) (*ClarificationOption, bool) {
+	for i := range c.Options {
+		if c.Options[i].ID == id {
+			return &c.Options[i], true
+		}
+	}
+	return nil, false
+}
+
+// clarify returns a Clarification when queryCtx is one of several equally
+// plausible interpretations: either the LLM reported alternative metrics, or
+// it picked a label value the question never mentioned out of a handful of
+// candidates.
+func (p *Pipeline) clarify(queryCtx *types.QueryContext, metrics map[string]prometheus.MetricSchema) *Clarification {
+	var contexts []*types.QueryContext
+	var question string
+
+	for _, alt := range queryCtx.Alternatives {
+		if _, ok := metrics[alt.MainMetric]; ok {
+			contexts = append(contexts, alt)
+		}
+	}
+
+	if len(contexts) > 0 {
+		primary := *queryCtx
+		primary.Alternatives = nil
+		contexts = append([]*types.QueryContext{&primary}, contexts...)
+		question = "Several metrics match the question. Which one did you mean?"
+	} else {
+		label, values := ambiguousLabel(queryCtx, metrics)
+		if label == "" {
+			return nil
+		}
+		for _, value := range values {
+			option := *queryCtx
+			option.Alternatives = nil
+			option.Labels = make(map[string]string, len(queryCtx.Labels))
+			for k, v := range queryCtx.Labels {
+				option.Labels[k] = v
+			}
+			option.Labels[label] = value
+			contexts = append(contexts, &option)
+		}
+		question = fmt.Sprintf("%s is reported by several %s values. Which one did you mean?", queryCtx.MainMetric, label)
+	}
+
+	clarification := &Clarification{
+		ID:       newClarificationID(),
+		Question: question,
+	}
+	seen := make(map[string]bool)
+	for _, c := range contexts {
+		if len(clarification.Options) == maxClarifyOptions {
+			break
+		}
+		promQL, _ := p.builder.Build(c)
+		if promQL == "" || seen[promQL] {
+			continue
+		}
+		seen[promQL] = true
+		clarification.Options = append(clarification.Options, ClarificationOption{
+			ID:          strconv.Itoa(len(clarification.Options) + 1),
+			Description: describeSelection(c),
+			PromQL:      promQL,
+			Context:     c,
+		})
+	}
+
+	if len(clarification.Options) < 2 {
+		return nil
+	}
+	return clarification
+}
+
+// ambiguousLabel finds a label whose value the LLM chose although the
+// question never mentions it, and returns the values it could have chosen.
+func ambiguousLabel(queryCtx *types.QueryContext, metrics map[string]prometheus.MetricSchema) (string, []string) {
+	schema, ok := metrics[queryCtx.MainMetric]
+	if !ok {
+		return "", nil
+	}
+
+	labels := make([]string, 0, len(queryCtx.Labels))
+	for label := range queryCtx.Labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	question := strings.ToLower(queryCtx.Query)
+	for _, label := range labels {
+		if strings.Contains(question, strings.ToLower(queryCtx.Labels[label])) {
+			continue
+		}
+		values := schema.LabelValues[label]
+		if len(values) >= 2 && len(values) <= maxClarifyOptions {
+			return label, values
+		}
+	}
+	return "", nil
+}
+
+func describeSelection(c *types.QueryContext) string {
+	if len(c.Labels) == 0 {
+		return c.MainMetric
+	}
+	pairs := make([]string, 0, len(c.Labels))
+	for k, v := range c.Labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%s where %s", c.MainMetric, strings.Join(pairs, ", "))
+}
+
+func newClarificationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
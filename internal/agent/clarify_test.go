@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+var clarifyMetrics = map[string]prometheus.MetricSchema{
+	"http_requests_total": {
+		Name: "http_requests_total",
+		Type: "counter",
+		LabelValues: map[string][]string{
+			"job":  {"api", "web"},
+			"code": {"200", "500"},
+			"pod":  {"p1", "p2", "p3", "p4", "p5", "p6"},
+			"env":  {"prod"},
+		},
+	},
+	"grpc_requests_total": {
+		Name:        "grpc_requests_total",
+		Type:        "counter",
+		LabelValues: map[string][]string{"job": {"api"}},
+	},
+}
+
+func TestAmbiguousLabel(t *testing.T) {
+	tests := []struct {
+		name       string
+		ctx        types.QueryContext
+		wantLabel  string
+		wantValues []string
+	}{
+		{
+			name:       "value not in question",
+			ctx:        types.QueryContext{Query: "request rate", MainMetric: "http_requests_total", Labels: map[string]string{"job": "api"}},
+			wantLabel:  "job",
+			wantValues: []string{"api", "web"},
+		},
+		{
+			name: "value named in question",
+			ctx:  types.QueryContext{Query: "request rate of the API", MainMetric: "http_requests_total", Labels: map[string]string{"job": "api"}},
+		},
+		{
+			name: "too many values to choose from",
+			ctx:  types.QueryContext{Query: "request rate", MainMetric: "http_requests_total", Labels: map[string]string{"pod": "p1"}},
+		},
+		{
+			name: "only one value",
+			ctx:  types.QueryContext{Query: "request rate", MainMetric: "http_requests_total", Labels: map[string]string{"env": "prod"}},
+		},
+		{
+			name:       "first ambiguous label in name order",
+			ctx:        types.QueryContext{Query: "request rate", MainMetric: "http_requests_total", Labels: map[string]string{"job": "api", "code": "500"}},
+			wantLabel:  "code",
+			wantValues: []string{"200", "500"},
+		},
+		{
+			name: "unknown metric",
+			ctx:  types.QueryContext{Query: "request rate", MainMetric: "missing_total", Labels: map[string]string{"job": "api"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label, values := ambiguousLabel(&tt.ctx, clarifyMetrics)
+			if label != tt.wantLabel || !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("got %q %v, want %q %v", label, values, tt.wantLabel, tt.wantValues)
+			}
+		})
+	}
+}
+
+func TestClarify(t *testing.T) {
+	p := &Pipeline{builder: NewQueryBuilder()}
+
+	tests := []struct {
+		name        string
+		ctx         types.QueryContext
+		wantOptions []string
+	}{
+		{
+			name: "alternative metrics",
+			ctx: types.QueryContext{
+				Query:        "request rate",
+				MainMetric:   "http_requests_total",
+				Aggregation:  "rate",
+				Alternatives: []*types.QueryContext{{MainMetric: "grpc_requests_total", Aggregation: "rate"}},
+			},
+			wantOptions: []string{"http_requests_total", "grpc_requests_total"},
+		},
+		{
+			name: "alternatives missing from the schema",
+			ctx: types.QueryContext{
+				Query:        "request rate",
+				MainMetric:   "http_requests_total",
+				Aggregation:  "rate",
+				Alternatives: []*types.QueryContext{{MainMetric: "missing_total"}},
+			},
+		},
+		{
+			name:        "ambiguous label value",
+			ctx:         types.QueryContext{Query: "request rate", MainMetric: "http_requests_total", Labels: map[string]string{"job": "api"}, Aggregation: "rate"},
+			wantOptions: []string{`http_requests_total where job="api"`, `http_requests_total where job="web"`},
+		},
+		{
+			name: "unambiguous question",
+			ctx:  types.QueryContext{Query: "request rate of web", MainMetric: "http_requests_total", Labels: map[string]string{"job": "web"}, Aggregation: "rate"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clarification := p.clarify(&tt.ctx, clarifyMetrics)
+			if tt.wantOptions == nil {
+				if clarification != nil {
+					t.Fatalf("unexpected clarification %+v", clarification)
+				}
+				return
+			}
+			if clarification == nil {
+				t.Fatal("no clarification")
+			}
+			var got []string
+			for i, option := range clarification.Options {
+				got = append(got, option.Description)
+				if option.ID != strconv.Itoa(i+1) || option.PromQL == "" || option.Context == nil {
+					t.Errorf("option %d: %+v", i, option)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantOptions) {
+				t.Errorf("got options %v, want %v", got, tt.wantOptions)
+			}
+			if clarification.ID == "" || clarification.Question == "" {
+				t.Errorf("clarification %+v", clarification)
+			}
+		})
+	}
+}
+
+func TestClarificationResumeWithAnswer(t *testing.T) {
+	llm, err := mock.New([]mock.Rule{{
+		Pattern:  `Query: request rate$`,
+		Response: `{"metric": "http_requests_total", "labels": {"job": "api"}, "timeRange": "5m", "aggregation": "rate"}`,
+	}}, nil, "explanation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens here: the snapshot stands in for Prometheus.
+	p := NewPipeline(prometheus.NewClientFor("http://127.0.0.1:1", time.Second), llm)
+	p.UseSnapshot(prometheus.NewSnapshot(clarifyMetrics, "test", 0))
+	ctx := context.Background()
+
+	result, err := p.Convert(ctx, "request rate", ConvertOptions{Clarify: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Clarification == nil || result.PromQL != "" {
+		t.Fatalf("expected a clarification, got %+v", result)
+	}
+
+	option, ok := result.Clarification.Option("2")
+	if !ok {
+		t.Fatalf("no option 2 in %+v", result.Clarification.Options)
+	}
+	if _, ok := result.Clarification.Option("9"); ok {
+		t.Error("unknown option found")
+	}
+
+	resolved, err := p.Resolve(ctx, option.Context, result.Clarification.Datasource, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.PromQL != option.PromQL || !strings.Contains(resolved.PromQL, `job="web"`) {
+		t.Errorf("resolved %q, option was %q", resolved.PromQL, option.PromQL)
+	}
+	if resolved.Clarification != nil || resolved.Validation == nil || !resolved.Validation.Valid {
+		t.Errorf("resolved %+v", resolved)
+	}
+
+	// Without Clarify the LLM's pick stands.
+	result, err = p.Convert(ctx, "request rate", ConvertOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Clarification != nil || !strings.Contains(result.PromQL, `job="api"`) {
+		t.Errorf("got %+v", result)
+	}
+}
@@ -0,0 +1,275 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	parser "github.com/agentkube/txt2promql/internal/core/parser"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/types"
+	"github.com/agentkube/txt2promql/pkg/ai"
+	promql "github.com/prometheus/prometheus/promql/parser"
+)
+
+// Confidence factor names.
+const (
+	FactorMetricExists      = "metric_exists"
+	FactorLabelsExist       = "labels_exist"
+	FactorParses            = "parses"
+	FactorAccepted          = "accepted_by_prometheus"
+	FactorReturnsData       = "returns_data"
+	FactorTypeMatch         = "aggregation_matches_type"
+	FactorRuleAgreement     = "rule_agreement"
+	FactorExampleSimilarity = "example_similarity"
+)
+
+// factorWeights sum to 1 so the confidence score stays within [0, 1].
+var factorWeights = map[string]float64{
+	FactorMetricExists:      0.20,
+	FactorLabelsExist:       0.10,
+	FactorParses:            0.15,
+	FactorAccepted:          0.10,
+	FactorReturnsData:       0.15,
+	FactorTypeMatch:         0.15,
+	FactorRuleAgreement:     0.10,
+	FactorExampleSimilarity: 0.05,
+}
+
+// Confidence is a weighted score in [0, 1] describing how trustworthy a
+// generated query is, with the factors that produced it.
+type Confidence struct {
+	Score   float64            `json:"score"`
+	Factors []ConfidenceFactor `json:"factors"`
+}
+
+type ConfidenceFactor struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Weight float64 `json:"weight"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+var callPattern = regexp.MustCompile(`([a-z_]+)\s*\(`)
+
+// Scorer rates generated queries against the schema, Prometheus' own
+// verdict, the rule-based intent parser and known good examples.
+type Scorer struct {
+	intentParser *parser.IntentParser
+	examples     []string
+}
+
+func NewScorer(examples []string) *Scorer {
+	return &Scorer{
+		intentParser: parser.NewIntentParser(),
+		examples:     append(append([]string(nil), ai.ExampleQueries...), examples...),
+	}
+}
+
+func (s *Scorer) Score(queryCtx *types.QueryContext, promQL string, validation *prometheus.ValidationResult, metrics map[string]prometheus.MetricSchema) *Confidence {
+	c := &Confidence{}
+	schema, metricExists := metrics[queryCtx.MainMetric]
+
+	if metricExists {
+		c.add(FactorMetricExists, 1, "")
+	} else {
+		c.add(FactorMetricExists, 0, fmt.Sprintf("%s is not in the discovered schema", queryCtx.MainMetric))
+	}
+
+	score, detail := scoreLabels(queryCtx.Labels, schema)
+	c.add(FactorLabelsExist, score, detail)
+
+	expr, err := promql.ParseExpr(promQL)
+	if err != nil {
+		c.add(FactorParses, 0, err.Error())
+	} else {
+		c.add(FactorParses, 1, "")
+	}
+
+	switch {
+	case validation == nil:
+		c.add(FactorAccepted, 0, "not validated")
+		c.add(FactorReturnsData, 0, "not executed")
+	case !validation.Valid:
+		c.add(FactorAccepted, 0, validation.Error)
+		c.add(FactorReturnsData, 0, "query failed")
+	case validation.Series == 0:
+		c.add(FactorAccepted, 1, "")
+		c.add(FactorReturnsData, 0, "query returned no series")
+	default:
+		c.add(FactorAccepted, 1, "")
+		c.add(FactorReturnsData, 1, fmt.Sprintf("%d series", validation.Series))
+	}
+
+	if expr != nil {
+		score, detail = scoreTypeMatch(expr, metrics)
+	} else {
+		score, detail = 0, "query does not parse"
+	}
+	c.add(FactorTypeMatch, score, detail)
+
+	score, detail = s.scoreRuleAgreement(queryCtx)
+	c.add(FactorRuleAgreement, score, detail)
+
+	score, detail = s.scoreExampleSimilarity(promQL)
+	c.add(FactorExampleSimilarity, score, detail)
+
+	return c
+}
+
+func (c *Confidence) add(name string, score float64, detail string) {
+	weight := factorWeights[name]
+	c.Factors = append(c.Factors, ConfidenceFactor{
+		Name:   name,
+		Score:  score,
+		Weight: weight,
+		Detail: detail,
+	})
+	c.Score = math.Round((c.Score+score*weight)*1000) / 1000
+}
+
+func scoreLabels(labels map[string]string, schema prometheus.MetricSchema) (float64, string) {
+	if len(labels) == 0 {
+		return 1, "no label filters"
+	}
+
+	var missing []string
+	for name, value := range labels {
+		values, ok := schema.LabelValues[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		found := false
+		for _, v := range values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+
+	if len(missing) == 0 {
+		return 1, ""
+	}
+	score := float64(len(labels)-len(missing)) / float64(len(labels))
+	return score, "unknown labels: " + strings.Join(missing, ", ")
+}
+
+// scoreTypeMatch checks that every selected metric is used the way its type
+// calls for: counters through rate-like functions, histogram buckets through
+// histogram_quantile, and gauges without rate.
+func scoreTypeMatch(expr promql.Expr, metrics map[string]prometheus.MetricSchema) (float64, string) {
+	var checked int
+	var problems []string
+
+	promql.Inspect(expr, func(node promql.Node, path []promql.Node) error {
+		vs, ok := node.(*promql.VectorSelector)
+		if !ok || vs.Name == "" {
+			return nil
+		}
+		checked++
+
+		metricType := prometheus.InferMetricType(vs.Name)
+		if schema, ok := metrics[vs.Name]; ok && schema.Type != "" {
+			metricType = schema.Type
+		}
+
+		funcs := enclosingFunctions(path)
+		switch metricType {
+		case "counter":
+			if !funcs["rate"] && !funcs["irate"] && !funcs["increase"] && !funcs["resets"] {
+				problems = append(problems, fmt.Sprintf("counter %s is used without rate or increase", vs.Name))
+			}
+		case "histogram":
+			if !funcs["histogram_quantile"] && !funcs["histogram_fraction"] {
+				problems = append(problems, fmt.Sprintf("histogram %s is used without histogram_quantile", vs.Name))
+			}
+		case "gauge":
+			if funcs["rate"] || funcs["irate"] || funcs["increase"] {
+				problems = append(problems, fmt.Sprintf("rate-like function applied to gauge %s", vs.Name))
+			}
+		}
+		return nil
+	})
+
+	if checked == 0 {
+		return 1, "no metric selectors"
+	}
+	if len(problems) == 0 {
+		return 1, ""
+	}
+	return math.Max(0, 1-float64(len(problems))/float64(checked)), strings.Join(problems, "; ")
+}
+
+func enclosingFunctions(path []promql.Node) map[string]bool {
+	funcs := make(map[string]bool)
+	for _, n := range path {
+		if call, ok := n.(*promql.Call); ok {
+			funcs[call.Func.Name] = true
+		}
+	}
+	return funcs
+}
+
+// scoreRuleAgreement compares the LLM's aggregation with the operation the
+// rule-based intent parser detects in the question.
+func (s *Scorer) scoreRuleAgreement(queryCtx *types.QueryContext) (float64, string) {
+	intent, err := s.intentParser.Parse(queryCtx.Query)
+	if err != nil || intent.Operation == "" {
+		return 0.5, "no rule-based operation detected"
+	}
+
+	if intent.Operation == queryCtx.Aggregation {
+		return 1, ""
+	}
+	// increase and irate answer the same questions as rate.
+	if intent.Operation == "rate" && (queryCtx.Aggregation == "irate" || queryCtx.Aggregation == "increase") {
+		return 0.75, ""
+	}
+	return 0, fmt.Sprintf("rules suggest %s, LLM chose %q", intent.Operation, queryCtx.Aggregation)
+}
+
+// scoreExampleSimilarity compares the functions the query calls with those
+// of the closest accepted example.
+func (s *Scorer) scoreExampleSimilarity(promQL string) (float64, string) {
+	shape := callShape(promQL)
+	best, bestExample := 0.0, ""
+	for _, example := range s.examples {
+		if sim := jaccard(shape, callShape(example)); sim > best {
+			best, bestExample = sim, example
+		}
+	}
+	if bestExample == "" {
+		return 0, "no similar example"
+	}
+	return math.Round(best*100) / 100, "closest example: " + bestExample
+}
+
+func callShape(promQL string) map[string]struct{} {
+	shape := make(map[string]struct{})
+	for _, m := range callPattern.FindAllStringSubmatch(promQL, -1) {
+		shape[m[1]] = struct{}{}
+	}
+	if strings.Contains(promQL, " by (") {
+		shape["by"] = struct{}{}
+	}
+	return shape
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
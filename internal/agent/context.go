@@ -4,26 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	parser "github.com/agentkube/txt2promql/internal/core/parser"
 	prometheus "github.com/agentkube/txt2promql/internal/prometheus"
-	openai "github.com/agentkube/txt2promql/internal/provider/openai"
+	"github.com/agentkube/txt2promql/internal/provider"
 	types "github.com/agentkube/txt2promql/internal/types"
 	"github.com/agentkube/txt2promql/pkg/ai"
 )
 
 type ContextExtractor struct {
-	openaiClient *openai.OpenAIClient
+	llm          provider.Provider
 	intentParser *parser.IntentParser
 	nerParser    *parser.NERParser
 	normalizer   *parser.Normalizer
 }
 
-func NewContextExtractor(openaiClient *openai.OpenAIClient) *ContextExtractor {
+func NewContextExtractor(llm provider.Provider) *ContextExtractor {
 	return &ContextExtractor{
-		openaiClient: openaiClient,
+		llm:          llm,
 		intentParser: parser.NewIntentParser(),
 		nerParser:    parser.NewNERParser(),
 		normalizer:   parser.NewNormalizer(),
@@ -31,16 +32,119 @@ func NewContextExtractor(openaiClient *openai.OpenAIClient) *ContextExtractor {
 }
 
 func (ce *ContextExtractor) ExtractQueryContext(ctx context.Context, query string, metrics map[string]prometheus.MetricSchema) (*types.QueryContext, error) {
+	return ce.ExtractQueryContextStream(ctx, query, metrics, nil)
+}
+
+// ExtractQueryContextStream behaves like ExtractQueryContext but streams the
+// raw LLM response to onToken. A nil onToken uses a regular completion.
+func (ce *ContextExtractor) ExtractQueryContextStream(ctx context.Context, query string, metrics map[string]prometheus.MetricSchema, onToken provider.TokenFunc) (*types.QueryContext, error) {
+	return ce.extract(ctx, query, ce.buildPrompt(query, metrics, ""), onToken)
+}
+
+// ExtractFollowUpContext resolves a follow-up question such as "now break
+// that down by pod" against the context of the previous answer.
+func (ce *ContextExtractor) ExtractFollowUpContext(ctx context.Context, query string, previous *types.QueryContext, metrics map[string]prometheus.MetricSchema, onToken provider.TokenFunc) (*types.QueryContext, error) {
+	previousPromQL, _ := NewQueryBuilder().Build(previous)
+	instructions := fmt.Sprintf(ai.PromptMap["PromQLFollowUp"], previous.Query, previousPromQL, contextJSON(previous))
+	return ce.extract(ctx, query, ce.buildPrompt(query, metrics, instructions), onToken)
+}
+
+// ExtractCorrectedContext asks the LLM to fix the context of a query that
+// Prometheus rejected, given the error it reported.
+func (ce *ContextExtractor) ExtractCorrectedContext(ctx context.Context, query string, rejected *types.QueryContext, promQL string, validation *prometheus.ValidationResult, metrics map[string]prometheus.MetricSchema, onToken provider.TokenFunc) (*types.QueryContext, error) {
+	instructions := fmt.Sprintf(ai.PromptMap["PromQLCorrection"], promQL, contextJSON(rejected), validation.ErrorType, validation.Error)
+	return ce.extract(ctx, query, ce.buildPrompt(query, metrics, instructions), onToken)
+}
+
+// Interpretation is one of several alternative readings of a question.
+type Interpretation struct {
+	Context     *types.QueryContext
+	Description string
+}
+
+// ExtractInterpretations asks the LLM for up to n different readings of a
+// broad question such as "how is the API doing".
+func (ce *ContextExtractor) ExtractInterpretations(ctx context.Context, query string, n int, metrics map[string]prometheus.MetricSchema, onToken provider.TokenFunc) ([]Interpretation, error) {
+	prompt := ce.buildPrompt(query, metrics, fmt.Sprintf(ai.PromptMap["PromQLCandidates"], n))
+
+	result, err := ce.complete(ctx, prompt, onToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract JSON array from response
+	jsonStart := strings.Index(result, "[")
+	jsonEnd := strings.LastIndex(result, "]")
+	if jsonStart >= 0 && jsonEnd > jsonStart {
+		result = result[jsonStart : jsonEnd+1]
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(result), &raw); err != nil {
+		return nil, fmt.Errorf("invalid response format: %w", err)
+	}
+
+	interpretations := make([]Interpretation, 0, len(raw))
+	for _, item := range raw {
+		queryCtx, err := parseQueryContext(query, string(item))
+		if err != nil {
+			continue
+		}
+		var described struct {
+			Description string `json:"description"`
+		}
+		// item already parsed as a query context, so this only fails for a
+		// description that is not a string; the candidate is kept without one.
+		if err := json.Unmarshal(item, &described); err != nil {
+			described.Description = ""
+		}
+		queryCtx.Alternatives = nil
+		interpretations = append(interpretations, Interpretation{
+			Context:     queryCtx,
+			Description: described.Description,
+		})
+		if len(interpretations) == n {
+			break
+		}
+	}
+
+	if len(interpretations) == 0 {
+		return nil, fmt.Errorf("no usable interpretations in response")
+	}
+	return interpretations, nil
+}
+
+func (ce *ContextExtractor) extract(ctx context.Context, query, prompt string, onToken provider.TokenFunc) (*types.QueryContext, error) {
+	result, err := ce.complete(ctx, prompt, onToken)
+	if err != nil {
+		return nil, err
+	}
+	return parseQueryContext(query, result)
+}
+
+func (ce *ContextExtractor) complete(ctx context.Context, prompt string, onToken provider.TokenFunc) (string, error) {
+	var result string
+	var err error
+	if onToken != nil {
+		result, err = ce.llm.CompleteStream(ctx, prompt, onToken)
+	} else {
+		result, err = ce.llm.Complete(ctx, prompt)
+	}
+	if err != nil {
+		return "", fmt.Errorf("OpenAI error: %w", err)
+	}
+
+	return result, nil
+}
+
+// buildPrompt describes the metrics to the LLM. Non-empty instructions are
+// added between the schema and the query.
+func (ce *ContextExtractor) buildPrompt(query string, metrics map[string]prometheus.MetricSchema, instructions string) string {
 	// Build metric info maps
 	metricInfo := make(map[string]map[string]map[string]int)
-	services := make(map[string][]string)
 
 	// Process metrics and their labels
 	for name, schema := range metrics {
-		if job, ok := schema.Labels["job"]; ok {
-			services[job] = append(services[job], name)
-		}
-
 		metricInfo[name] = make(map[string]map[string]int)
 		for label, value := range schema.Labels {
 			if label == "__name__" {
@@ -53,15 +157,6 @@ func (ce *ContextExtractor) ExtractQueryContext(ctx context.Context, query strin
 		}
 	}
 
-	// Print services and metrics
-	fmt.Printf("\nDiscovered Services and Metrics:\n")
-	for service, serviceMetrics := range services {
-		fmt.Printf("Service %s metrics:\n", service)
-		for _, metric := range serviceMetrics {
-			fmt.Printf("  - %s\n", metric)
-		}
-	}
-
 	// Format metric descriptions
 	var metricsDescription []string
 	for metricName, labels := range metricInfo {
@@ -71,31 +166,47 @@ func (ce *ContextExtractor) ExtractQueryContext(ctx context.Context, query strin
 			for value := range values {
 				valueList = append(valueList, value)
 			}
+			sort.Strings(valueList)
 			labelInfo = append(labelInfo, fmt.Sprintf("%s=[%s]", label, strings.Join(valueList, ", ")))
 		}
+		sort.Strings(labelInfo)
 		metricStr := metricName
 		if len(labelInfo) > 0 {
 			metricStr += fmt.Sprintf(" with labels: %s", strings.Join(labelInfo, ", "))
 		}
 		metricsDescription = append(metricsDescription, metricStr)
 	}
-
-	fmt.Printf("\nMetric Details:\n%s\n", strings.Join(metricsDescription, "\n"))
+	// Sorted so the same schema always gives the same prompt, which recorded
+	// fixtures rely on.
+	sort.Strings(metricsDescription)
 
 	// Build system context with examples
 	systemContext := fmt.Sprintf(ai.PromptMap["PromQLBuilder"], strings.Join(metricsDescription, "\n"))
 
-	// Process query
-	prompt := systemContext + "\n\nQuery: " + query
-	fmt.Printf("\nProcessing query: %s\n", query)
-
-	result, err := ce.openaiClient.Complete(ctx, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("OpenAI error: %w", err)
+	if instructions != "" {
+		systemContext += "\n\n" + instructions
 	}
 
-	fmt.Printf("\nAgent Response:\n%s\n", result)
+	return systemContext + "\n\nQuery: " + query
+}
+
+// contextJSON renders a QueryContext in the JSON shape the LLM is asked to
+// return.
+func contextJSON(qc *types.QueryContext) string {
+	components := map[string]interface{}{
+		"metric":      qc.MainMetric,
+		"labels":      qc.Labels,
+		"aggregation": qc.Aggregation,
+		"groupBy":     qc.GroupBy,
+	}
+	if qc.TimeRange.Duration > 0 {
+		components["timeRange"] = qc.TimeRange.Duration.String()
+	}
+	data, _ := json.Marshal(components)
+	return string(data)
+}
 
+func parseQueryContext(query, result string) (*types.QueryContext, error) {
 	// Extract JSON from response
 	jsonStart := strings.Index(result, "{")
 	jsonEnd := strings.LastIndex(result, "}")
@@ -104,10 +215,15 @@ func (ce *ContextExtractor) ExtractQueryContext(ctx context.Context, query strin
 	}
 
 	var extracted struct {
-		Metric      string            `json:"metric"`
-		Labels      map[string]string `json:"labels"`
-		TimeRange   string            `json:"timeRange"`
-		Aggregation string            `json:"aggregation"`
+		Metric       string            `json:"metric"`
+		Labels       map[string]string `json:"labels"`
+		TimeRange    string            `json:"timeRange"`
+		Aggregation  string            `json:"aggregation"`
+		GroupBy      []string          `json:"groupBy"`
+		Alternatives []struct {
+			Metric string            `json:"metric"`
+			Labels map[string]string `json:"labels"`
+		} `json:"alternatives"`
 	}
 
 	if err := json.Unmarshal([]byte(result), &extracted); err != nil {
@@ -124,11 +240,27 @@ func (ce *ContextExtractor) ExtractQueryContext(ctx context.Context, query strin
 		timeRange.Duration = duration
 	}
 
-	return &types.QueryContext{
+	queryCtx := &types.QueryContext{
 		Query:       query,
 		MainMetric:  extracted.Metric,
 		Labels:      extracted.Labels,
 		TimeRange:   timeRange,
 		Aggregation: extracted.Aggregation,
-	}, nil
+		GroupBy:     extracted.GroupBy,
+	}
+
+	// Alternatives only differ in metric and labels; everything else is
+	// shared with the primary interpretation.
+	for _, alt := range extracted.Alternatives {
+		if alt.Metric == "" {
+			continue
+		}
+		altCtx := *queryCtx
+		altCtx.MainMetric = alt.Metric
+		altCtx.Labels = alt.Labels
+		altCtx.Alternatives = nil
+		queryCtx.Alternatives = append(queryCtx.Alternatives, &altCtx)
+	}
+
+	return queryCtx, nil
 }
@@ -5,26 +5,39 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/agentkube/txt2promql/internal/provider/openai"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/query"
 	"github.com/agentkube/txt2promql/internal/types"
 	"github.com/agentkube/txt2promql/pkg/ai"
 )
 
 type Explainer struct {
-	openaiClient *openai.OpenAIClient
+	llm provider.Provider
 }
 
-func NewExplainer(openaiClient *openai.OpenAIClient) *Explainer {
+func NewExplainer(llm provider.Provider) *Explainer {
 	return &Explainer{
-		openaiClient: openaiClient,
+		llm: llm,
 	}
 }
 
 func (e *Explainer) GenerateExplanation(ctx context.Context, queryCtx *types.QueryContext, promQL string) string {
+	return e.GenerateExplanationStream(ctx, queryCtx, promQL, nil)
+}
+
+// GenerateExplanationStream behaves like GenerateExplanation but streams the
+// explanation to onToken. A nil onToken uses a regular completion.
+func (e *Explainer) GenerateExplanationStream(ctx context.Context, queryCtx *types.QueryContext, promQL string, onToken provider.TokenFunc) string {
 	prompt := fmt.Sprintf(ai.PromptMap["PromQLExplanation"],
 		promQL, queryCtx.Query, queryCtx.MainMetric, queryCtx.Aggregation, queryCtx.Labels)
 
-	result, err := e.openaiClient.Complete(ctx, prompt)
+	var result string
+	var err error
+	if onToken != nil {
+		result, err = e.llm.CompleteStream(ctx, prompt, onToken)
+	} else {
+		result, err = e.llm.Complete(ctx, prompt)
+	}
 	if err != nil {
 		return fmt.Sprintf("Query: %s\nError generating explanation: %v", promQL, err)
 	}
@@ -34,3 +47,30 @@ func (e *Explainer) GenerateExplanation(ctx context.Context, queryCtx *types.Que
 
 	return explanation
 }
+
+// ExplainPromQL explains any PromQL expression. The structure is explained
+// deterministically from the AST; the LLM, when available, only rewrites
+// those steps into prose. It falls back to the structural summary when the
+// LLM is unavailable or fails.
+func (e *Explainer) ExplainPromQL(ctx context.Context, promQL string) (*query.Explanation, string, error) {
+	structural, err := query.Explain(promQL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if e.llm == nil {
+		return structural, structural.Summary, nil
+	}
+
+	steps := make([]string, 0, len(structural.Steps))
+	for _, step := range structural.Steps {
+		steps = append(steps, fmt.Sprintf("%s- %s: %s", strings.Repeat("  ", step.Depth), step.Expr, step.Text))
+	}
+	prompt := fmt.Sprintf(ai.PromptMap["PromQLPolish"], structural.Query, strings.Join(steps, "\n"))
+
+	result, err := e.llm.Complete(ctx, prompt)
+	if err != nil || strings.TrimSpace(result) == "" {
+		return structural, structural.Summary, nil
+	}
+	return structural, strings.Trim(strings.TrimSpace(result), "`\""), nil
+}
@@ -0,0 +1,442 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	kg "github.com/agentkube/txt2promql/internal/core/knowledgegraph"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+// maxCandidates caps the number of metrics described to the LLM.
+const maxCandidates = 50
+
+// Stages reported to an EventFunc while a conversion runs.
+const (
+	StageSchema           = "schema"
+	StageCandidates       = "candidates"
+	StageContextToken     = "context_token"
+	StageContext          = "context"
+	StagePromQL           = "promql"
+	StageValidation       = "validation"
+	StageConfidence       = "confidence"
+	StageExplanationToken = "explanation_token"
+	StageClarification    = "clarification"
+	StageCandidate        = "candidate"
+	StageCorrection       = "correction"
+)
+
+var (
+	ErrSchemaUnavailable = errors.New("failed to refresh metrics")
+	ErrContextExtraction = errors.New("failed to extract query context")
+	ErrNoPromQL          = errors.New("unable to generate PromQL query")
+)
+
+// Event describes the progress of a single pipeline stage.
+type Event struct {
+	Stage string      `json:"stage"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// EventFunc receives pipeline events in the order the stages complete.
+type EventFunc func(Event)
+
+type ConvertResult struct {
+	Context *types.QueryContext
+	PromQL  string
+	// Datasource is where the query was validated and should be run.
+	Datasource     string
+	Explanation    string
+	Validation     *prometheus.ValidationResult
+	Confidence     *Confidence
+	SimilarMetrics []kg.MetricInfo
+	// Clarification is set instead of PromQL when the question was
+	// ambiguous and ConvertOptions.Clarify was requested.
+	Clarification *Clarification
+	// Candidates holds the ranked alternatives when more than one was
+	// requested; the primary fields describe the best of them.
+	Candidates []Candidate
+	// Correction is set when Prometheus rejected the first query and
+	// PromQL is the LLM's correction of it.
+	Correction *Correction
+}
+
+// Correction records a query Prometheus rejected and why.
+type Correction struct {
+	PromQL    string               `json:"promql"`
+	Error     string               `json:"error"`
+	ErrorType prometheus.ErrorType `json:"error_type"`
+}
+
+// Pipeline runs the full natural language to PromQL conversion: schema
+// lookup, candidate selection, context extraction, query building,
+// validation and explanation.
+type Pipeline struct {
+	sources   *prometheus.Registry
+	extractor *ContextExtractor
+	builder   *QueryBuilder
+	explainer *Explainer
+	patterns  *kg.KnowledgePatterns
+	scorer    *Scorer
+	// pinned replaces the discovered schema when set.
+	pinned map[string]prometheus.MetricSchema
+	// offline validates against the pinned schema instead of Prometheus.
+	offline bool
+}
+
+// NewPipeline converts against a single Prometheus.
+func NewPipeline(promClient *prometheus.Client, llm provider.Provider) *Pipeline {
+	return NewPipelineFor(prometheus.SingleRegistry(promClient), llm)
+}
+
+// NewPipelineFor converts against every datasource of sources, routing each
+// query to the one that suits it.
+func NewPipelineFor(sources *prometheus.Registry, llm provider.Provider) *Pipeline {
+	patterns := kg.NewKnowledgePatterns()
+	return &Pipeline{
+		sources:   sources,
+		extractor: NewContextExtractor(llm),
+		builder:   NewQueryBuilder(),
+		explainer: NewExplainer(llm),
+		patterns:  patterns,
+		scorer:    NewScorer(patterns.Examples()),
+	}
+}
+
+// ConvertOptions tunes a single conversion.
+type ConvertOptions struct {
+	// Previous is the context of the answer a follow-up question such as
+	// "only for production" refines. Nil for a standalone question.
+	Previous *types.QueryContext
+	// Clarify stops the conversion with a Clarification when the question
+	// maps to several equally plausible metrics or label values.
+	Clarify bool
+	// Candidates, when greater than one, asks for that many alternative
+	// queries ranked by confidence.
+	Candidates int
+	// Datasource restricts the conversion to the schema of one datasource
+	// and validates there. Empty routes automatically.
+	Datasource string
+	// Lookback is how far back the query will be evaluated, such as the
+	// span of a range query. Routing picks a datasource whose retention
+	// covers it. Zero means an instant query.
+	Lookback time.Duration
+}
+
+// Convert turns a natural language query into PromQL. When emit is non-nil
+// the LLM calls are streamed and every stage is reported to it.
+func (p *Pipeline) Convert(ctx context.Context, query string, opts ConvertOptions, emit EventFunc) (*ConvertResult, error) {
+	streaming := emit != nil
+	if !streaming {
+		emit = func(Event) {}
+	}
+
+	metrics, err := p.metrics(ctx, opts.Datasource)
+	if err != nil {
+		return nil, err
+	}
+	emit(Event{Stage: StageSchema, Data: map[string]int{"metrics": len(metrics)}})
+
+	candidates := selectCandidates(query, metrics, maxCandidates)
+	if previous := opts.Previous; previous != nil {
+		// Follow-ups rarely repeat the metric name, so always keep it.
+		if _, ok := candidates[previous.MainMetric]; !ok {
+			if schema, ok := metrics[previous.MainMetric]; ok {
+				candidates[previous.MainMetric] = schema
+			}
+		}
+	}
+	names := make([]string, 0, len(candidates))
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	emit(Event{Stage: StageCandidates, Data: names})
+
+	if opts.Candidates > 1 && opts.Previous == nil {
+		return p.convertCandidates(ctx, query, opts, candidates, metrics, emit)
+	}
+
+	var onContextToken provider.TokenFunc
+	if streaming {
+		onContextToken = func(token string) {
+			emit(Event{Stage: StageContextToken, Data: token})
+		}
+	}
+
+	var queryCtx *types.QueryContext
+	if opts.Previous != nil {
+		queryCtx, err = p.extractor.ExtractFollowUpContext(ctx, query, opts.Previous, candidates, onContextToken)
+	} else {
+		queryCtx, err = p.extractor.ExtractQueryContextStream(ctx, query, candidates, onContextToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrContextExtraction, err)
+	}
+	emit(Event{Stage: StageContext, Data: queryCtx})
+
+	if opts.Clarify {
+		if clarification := p.clarify(queryCtx, metrics); clarification != nil {
+			clarification.Datasource = opts.Datasource
+			emit(Event{Stage: StageClarification, Data: clarification})
+			return &ConvertResult{Context: queryCtx, Clarification: clarification}, nil
+		}
+	}
+
+	return p.finish(ctx, queryCtx, metrics, opts.Datasource, opts.Lookback, streaming, emit)
+}
+
+// Metrics returns the cached metric schema conversions run against,
+// refreshing it when stale. With several datasources it is the union of
+// their schemas.
+func (p *Pipeline) Metrics(ctx context.Context) (map[string]prometheus.MetricSchema, error) {
+	if p.pinned != nil {
+		return p.pinned, nil
+	}
+	return p.sources.Metrics(ctx)
+}
+
+// metrics returns the schema of the named datasource, or the union of all
+// of them when name is empty.
+func (p *Pipeline) metrics(ctx context.Context, name string) (map[string]prometheus.MetricSchema, error) {
+	if p.pinned != nil {
+		return p.pinned, nil
+	}
+	if name == "" {
+		metrics, err := p.sources.Metrics(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSchemaUnavailable, err)
+		}
+		return metrics, nil
+	}
+	ds, err := p.sources.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := ds.Schema.Metrics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaUnavailable, err)
+	}
+	return metrics, nil
+}
+
+// Datasources returns the datasources conversions are routed across.
+func (p *Pipeline) Datasources() *prometheus.Registry {
+	return p.sources
+}
+
+// UseSchema runs every later conversion against metrics instead of the
+// schema discovered from Prometheus.
+func (p *Pipeline) UseSchema(metrics map[string]prometheus.MetricSchema) {
+	p.pinned = metrics
+}
+
+// UseSnapshot runs every later conversion against a schema snapshot, with no
+// Prometheus connection: queries are validated against the snapshot instead
+// of being run.
+func (p *Pipeline) UseSnapshot(snapshot *prometheus.Snapshot) {
+	p.pinned = snapshot.Schema()
+	p.offline = true
+}
+
+// Resolve completes a conversion from an already extracted context, such as
+// the option a user picked in answer to a Clarification, on the named
+// datasource or one routed for lookback.
+func (p *Pipeline) Resolve(ctx context.Context, queryCtx *types.QueryContext, datasource string, lookback time.Duration, emit EventFunc) (*ConvertResult, error) {
+	streaming := emit != nil
+	if !streaming {
+		emit = func(Event) {}
+	}
+
+	metrics, err := p.metrics(ctx, datasource)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.finish(ctx, queryCtx, metrics, datasource, lookback, streaming, emit)
+}
+
+// finish builds, validates and explains the query for queryCtx.
+func (p *Pipeline) finish(ctx context.Context, queryCtx *types.QueryContext, metrics map[string]prometheus.MetricSchema, datasource string, lookback time.Duration, streaming bool, emit EventFunc) (*ConvertResult, error) {
+	promQL, _ := p.builder.Build(queryCtx)
+	if promQL == "" {
+		return nil, ErrNoPromQL
+	}
+	emit(Event{Stage: StagePromQL, Data: promQL})
+
+	ds := p.route(ctx, promQL, datasource, lookback)
+	validation, err := p.validate(ctx, promQL, metrics, ds)
+	if err != nil {
+		return nil, err
+	}
+	emit(Event{Stage: StageValidation, Data: validation})
+
+	var correction *Correction
+	if correctable(validation) {
+		if corrected, correctedPromQL, correctedValidation := p.correct(ctx, queryCtx, promQL, validation, metrics, ds); corrected != nil {
+			correction = &Correction{PromQL: promQL, Error: validation.Error, ErrorType: validation.ErrorType}
+			queryCtx, promQL, validation = corrected, correctedPromQL, correctedValidation
+			emit(Event{Stage: StageCorrection, Data: correction})
+			emit(Event{Stage: StagePromQL, Data: promQL})
+			emit(Event{Stage: StageValidation, Data: validation})
+		}
+	}
+
+	confidence := p.scorer.Score(queryCtx, promQL, validation, metrics)
+	emit(Event{Stage: StageConfidence, Data: confidence})
+
+	var onExplanationToken provider.TokenFunc
+	if streaming {
+		onExplanationToken = func(token string) {
+			emit(Event{Stage: StageExplanationToken, Data: token})
+		}
+	}
+	explanation := p.explainer.GenerateExplanationStream(ctx, queryCtx, promQL, onExplanationToken)
+	if !validation.Valid {
+		explanation += " (Generated PromQL query may not be accurate)"
+	}
+
+	return &ConvertResult{
+		Context:        queryCtx,
+		PromQL:         promQL,
+		Datasource:     validation.Datasource,
+		Explanation:    explanation,
+		Validation:     validation,
+		Confidence:     confidence,
+		SimilarMetrics: p.patterns.FindSimilarMetrics(queryCtx.MainMetric, metrics),
+		Correction:     correction,
+	}, nil
+}
+
+// correctable reports whether validation failed because of the query
+// itself, which a rewrite may fix, rather than Prometheus being unreachable.
+func correctable(validation *prometheus.ValidationResult) bool {
+	return !validation.Valid && (validation.ErrorType == prometheus.ErrBadData || validation.ErrorType == prometheus.ErrExecution)
+}
+
+// correct gives the LLM one chance to fix a rejected query. It returns nil
+// when the correction builds no different query or is rejected as well.
+func (p *Pipeline) correct(ctx context.Context, queryCtx *types.QueryContext, promQL string, validation *prometheus.ValidationResult, metrics map[string]prometheus.MetricSchema, ds *prometheus.Datasource) (*types.QueryContext, string, *prometheus.ValidationResult) {
+	corrected, err := p.extractor.ExtractCorrectedContext(ctx, queryCtx.Query, queryCtx, promQL, validation, metrics, nil)
+	if err != nil {
+		return nil, "", nil
+	}
+	correctedPromQL, _ := p.builder.Build(corrected)
+	if correctedPromQL == "" || correctedPromQL == promQL {
+		return nil, "", nil
+	}
+	correctedValidation, err := p.validate(ctx, correctedPromQL, metrics, ds)
+	if err != nil || !correctedValidation.Valid {
+		return nil, "", nil
+	}
+	return corrected, correctedPromQL, correctedValidation
+}
+
+// Validate checks promQL the way conversions do, on the named datasource or
+// the one the query routes to.
+func (p *Pipeline) Validate(ctx context.Context, promQL, datasource string) (*prometheus.ValidationResult, error) {
+	if p.offline {
+		return prometheus.ValidateAgainstSchema(promQL, p.pinned), nil
+	}
+	ds, err := p.sources.Get(datasource)
+	if err != nil {
+		return nil, err
+	}
+	if datasource == "" {
+		ds, _ = p.sources.RouteQuery(ctx, promQL, 0)
+	}
+	validation, err := ds.Client.ValidateQuery(ctx, promQL)
+	if err != nil {
+		return nil, err
+	}
+	validation.Datasource = ds.Name
+	return validation, nil
+}
+
+// route picks the datasource promQL is validated on: the named one, else
+// the one that has its metric and data far enough back to evaluate it over
+// lookback.
+func (p *Pipeline) route(ctx context.Context, promQL, name string, lookback time.Duration) *prometheus.Datasource {
+	if name != "" {
+		if ds, err := p.sources.Get(name); err == nil {
+			return ds
+		}
+	}
+	ds, _ := p.sources.RouteQuery(ctx, promQL, lookback)
+	return ds
+}
+
+// validate runs promQL on ds, or checks it against the schema when the
+// pipeline is offline. The error is set when Prometheus could not be asked,
+// as opposed to rejecting the query.
+func (p *Pipeline) validate(ctx context.Context, promQL string, metrics map[string]prometheus.MetricSchema, ds *prometheus.Datasource) (*prometheus.ValidationResult, error) {
+	if p.offline {
+		return prometheus.ValidateAgainstSchema(promQL, metrics), nil
+	}
+	validation, err := ds.Client.ValidateQuery(ctx, promQL)
+	if err != nil {
+		return nil, err
+	}
+	validation.Datasource = ds.Name
+	return validation, nil
+}
+
+// selectCandidates narrows the schema to the metrics whose names or label
+// values share the most words with the query. Small schemas are returned
+// unchanged.
+func selectCandidates(query string, metrics map[string]prometheus.MetricSchema, limit int) map[string]prometheus.MetricSchema {
+	if len(metrics) <= limit {
+		return metrics
+	}
+
+	words := make(map[string]struct{})
+	for _, w := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if len(w) >= 3 {
+			words[w] = struct{}{}
+		}
+	}
+
+	type scored struct {
+		name  string
+		score int
+	}
+	ranked := make([]scored, 0, len(metrics))
+	for name, schema := range metrics {
+		score := 0
+		for _, part := range strings.Split(strings.ToLower(name), "_") {
+			if _, ok := words[part]; ok {
+				score += 2
+			}
+		}
+		for label, value := range schema.Labels {
+			if label == "__name__" {
+				continue
+			}
+			if _, ok := words[strings.ToLower(value)]; ok {
+				score++
+			}
+		}
+		ranked = append(ranked, scored{name: name, score: score})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].name < ranked[j].name
+	})
+
+	selected := make(map[string]prometheus.MetricSchema, limit)
+	for _, r := range ranked[:limit] {
+		selected[r.name] = metrics[r.name]
+	}
+	return selected
+}
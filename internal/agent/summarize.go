@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/pkg/ai"
+)
+
+// maxSummarySeries caps how many series are described in an answer.
+const maxSummarySeries = 5
+
+// Summarizer turns query results into a natural-language answer such as
+// "checkout p99 latency peaked at 2.3 at 14:05 and is now 0.4".
+type Summarizer struct {
+	llm provider.Provider
+}
+
+func NewSummarizer(llm provider.Provider) *Summarizer {
+	return &Summarizer{llm: llm}
+}
+
+// Summarize computes per-series statistics and asks the LLM to phrase them
+// as an answer to question. Without an LLM, or if it fails, the template
+// summary is returned.
+func (s *Summarizer) Summarize(ctx context.Context, question, promQL string, result *prometheus.QueryResult) string {
+	facts := TemplateSummary(result)
+	if s.llm == nil || len(result.Stats()) == 0 {
+		return facts
+	}
+
+	if question == "" {
+		question = "What does this query show?"
+	}
+	prompt := fmt.Sprintf(ai.PromptMap["ResultSummary"], question, promQL, facts)
+	answer, err := s.llm.Complete(ctx, prompt)
+	if err != nil || strings.TrimSpace(answer) == "" {
+		return facts
+	}
+	return strings.TrimSpace(answer)
+}
+
+// TemplateSummary describes query results without an LLM, one sentence per
+// series, largest last value first.
+func TemplateSummary(result *prometheus.QueryResult) string {
+	stats := result.Stats()
+	if len(stats) == 0 {
+		return "The query returned no data."
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Last > stats[j].Last
+	})
+
+	var sentences []string
+	if len(stats) > 1 {
+		sentences = append(sentences, fmt.Sprintf("The query returned %d series.", len(stats)))
+	}
+	for i, st := range stats {
+		if i == maxSummarySeries {
+			sentences = append(sentences, fmt.Sprintf("%d more series are not shown.", len(stats)-maxSummarySeries))
+			break
+		}
+		sentences = append(sentences, describeSeries(st))
+	}
+	return strings.Join(sentences, " ")
+}
+
+func describeSeries(st prometheus.SeriesStats) string {
+	if st.Samples == 1 {
+		return fmt.Sprintf("%s is %s.", st.Name, formatValue(st.Last))
+	}
+
+	sentence := fmt.Sprintf("%s peaked at %s at %s, was lowest at %s at %s, averaged %s and is now %s",
+		st.Name,
+		formatValue(st.Max), clock(st.MaxAt),
+		formatValue(st.Min), clock(st.MinAt),
+		formatValue(st.Mean), formatValue(st.Last))
+
+	sentence += ", " + trendOf(st)
+
+	if len(st.Spikes) > 0 {
+		sentence += fmt.Sprintf(", with %d spike(s), the largest at %s", len(st.Spikes), clock(largestSpike(st.Spikes).At))
+	}
+	return sentence + "."
+}
+
+// clock formats t as a UTC time of day, so answers read the same whatever
+// zone the server runs in.
+func clock(t time.Time) string {
+	return t.UTC().Format("15:04 UTC")
+}
+
+// trendOf classifies the slope relative to the series' mean over the whole
+// window, so small drifts on large values read as flat.
+func trendOf(st prometheus.SeriesStats) string {
+	change := st.Slope * st.LastAt.Sub(st.FirstAt).Seconds()
+	scale := math.Max(math.Abs(st.Mean), math.Abs(st.Max-st.Min))
+	if scale == 0 || math.Abs(change)/scale < 0.1 {
+		return "holding steady"
+	}
+	if change > 0 {
+		return "trending up"
+	}
+	return "trending down"
+}
+
+func largestSpike(spikes []prometheus.Spike) prometheus.Spike {
+	largest := spikes[0]
+	for _, s := range spikes[1:] {
+		if math.Abs(s.ZScore) > math.Abs(largest.ZScore) {
+			largest = s
+		}
+	}
+	return largest
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
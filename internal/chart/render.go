@@ -0,0 +1,490 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/font"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/text"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// Image formats supported by Render.
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Themes supported by Render.
+const (
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+const (
+	defaultWidth  = 800
+	defaultHeight = 400
+	maxDimension  = 4000
+	// maxLegendEntries keeps the legend from covering the plot.
+	maxLegendEntries = 10
+	// chartPoints is the number of samples per series a range query for a
+	// chart aims for.
+	chartPoints = 120
+	minStep     = 15 * time.Second
+)
+
+var (
+	// ErrInvalidOptions is returned for render options Render cannot draw
+	// with, such as an unknown theme or an image size out of range.
+	ErrInvalidOptions    = errors.New("invalid render options")
+	ErrUnsupportedFormat = fmt.Errorf("%w: unsupported image format", ErrInvalidOptions)
+)
+
+// RenderOptions controls how a query result is drawn. Zero values select the
+// defaults: the suggested chart type, PNG, 800x400 pixels, the light theme
+// and no legend.
+type RenderOptions struct {
+	Type   string
+	Format string
+	Width  int
+	Height int
+	Theme  string
+	Legend bool
+	Title  string
+}
+
+type theme struct {
+	background color.Color
+	foreground color.Color
+	grid       color.Color
+}
+
+var themes = map[string]theme{
+	ThemeLight: {
+		background: color.White,
+		foreground: color.Black,
+		grid:       color.Gray{Y: 220},
+	},
+	ThemeDark: {
+		background: color.RGBA{R: 24, G: 27, B: 31, A: 255},
+		foreground: color.Gray{Y: 216},
+		grid:       color.Gray{Y: 60},
+	},
+}
+
+// Render draws result as a chart image. The chart type comes from
+// opts.Type, or the suggestion when it is empty; types without a dedicated
+// renderer, such as pie and table, are drawn as bars.
+func Render(w io.Writer, result *prometheus.QueryResult, sug Suggestion, opts RenderOptions) error {
+	opts, err := normalizeOptions(opts)
+	if err != nil {
+		return err
+	}
+	chartType := opts.Type
+	if chartType == "" {
+		chartType = sug.Type
+	}
+	th := themes[opts.Theme]
+
+	p := plot.New()
+	p.Title.Text = opts.Title
+	applyTheme(p, th)
+
+	series := result.Series()
+	switch {
+	case len(series) == 0:
+		err = renderEmpty(p, th)
+	case chartType == TypeHeatmap:
+		err = renderHeatmap(p, series)
+	case chartType == TypeGauge:
+		err = renderGauge(p, series[0], sug.Unit, th)
+	case chartType == TypeTimeSeries && result.Data.ResultType == prometheus.ResultMatrix:
+		err = renderTimeSeries(p, series, sug, opts.Legend, th)
+	default:
+		err = renderBars(p, series, sug, th)
+	}
+	if err != nil {
+		return err
+	}
+
+	wt, err := p.WriterTo(pixels(opts.Width), pixels(opts.Height), opts.Format)
+	if err != nil {
+		return fmt.Errorf("rendering chart: %w", err)
+	}
+	_, err = wt.WriteTo(w)
+	return err
+}
+
+// DefaultStep spreads window over roughly chartPoints samples, never finer
+// than 15s.
+func DefaultStep(window time.Duration) time.Duration {
+	step := (window / chartPoints).Truncate(time.Second)
+	if step < minStep {
+		step = minStep
+	}
+	return step
+}
+
+// ContentType returns the MIME type of an image format.
+func ContentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+func normalizeOptions(opts RenderOptions) (RenderOptions, error) {
+	switch opts.Type {
+	case "", TypeTimeSeries, TypeBar, TypePie, TypeGauge, TypeTable, TypeHeatmap:
+	default:
+		return opts, fmt.Errorf("%w: unknown chart type %q", ErrInvalidOptions, opts.Type)
+	}
+
+	opts.Format = strings.ToLower(opts.Format)
+	switch opts.Format {
+	case "":
+		opts.Format = FormatPNG
+	case FormatPNG, FormatSVG:
+	default:
+		return opts, fmt.Errorf("%w: %s", ErrUnsupportedFormat, opts.Format)
+	}
+
+	if opts.Theme == "" {
+		opts.Theme = ThemeLight
+	}
+	if _, ok := themes[opts.Theme]; !ok {
+		return opts, fmt.Errorf("%w: unknown theme %q", ErrInvalidOptions, opts.Theme)
+	}
+
+	if opts.Width == 0 {
+		opts.Width = defaultWidth
+	}
+	if opts.Height == 0 {
+		opts.Height = defaultHeight
+	}
+	if opts.Width < 0 || opts.Height < 0 || opts.Width > maxDimension || opts.Height > maxDimension {
+		return opts, fmt.Errorf("%w: image size must be between 1 and %d pixels", ErrInvalidOptions, maxDimension)
+	}
+	return opts, nil
+}
+
+// pixels converts a pixel count to a length at the 96 DPI PNG output uses.
+func pixels(n int) vg.Length {
+	return vg.Length(n) * vg.Inch / 96
+}
+
+func applyTheme(p *plot.Plot, th theme) {
+	p.BackgroundColor = th.background
+	p.Title.TextStyle.Color = th.foreground
+	p.Legend.TextStyle.Color = th.foreground
+	for _, axis := range []*plot.Axis{&p.X, &p.Y} {
+		axis.Color = th.foreground
+		axis.Label.TextStyle.Color = th.foreground
+		axis.Tick.Color = th.foreground
+		axis.Tick.Label.Color = th.foreground
+	}
+}
+
+func addGrid(p *plot.Plot, th theme) {
+	grid := plotter.NewGrid()
+	grid.Vertical.Color = th.grid
+	grid.Horizontal.Color = th.grid
+	p.Add(grid)
+}
+
+func renderEmpty(p *plot.Plot, th theme) error {
+	p.HideAxes()
+	p.Add(message{text: "No data", color: th.foreground})
+	return nil
+}
+
+func renderTimeSeries(p *plot.Plot, series []prometheus.Series, sug Suggestion, legend bool, th theme) error {
+	addGrid(p, th)
+	p.X.Tick.Marker = plot.TimeTicks{Format: "15:04"}
+	p.Y.Label.Text = sug.Unit
+	if sug.LogScale && !sug.Stacked {
+		p.Y.Scale = plot.LogScale{}
+		p.Y.Tick.Marker = plot.LogTicks{}
+	}
+
+	// Stacked series are drawn cumulatively, each on top of the previous.
+	stackedOn := make(map[int64]float64)
+	for i, s := range series {
+		pts := make(plotter.XYs, 0, len(s.Samples))
+		for _, sample := range s.Samples {
+			v := sample.Value
+			if sug.LogScale && !sug.Stacked && v <= 0 {
+				continue
+			}
+			if sug.Stacked {
+				key := sample.At.UnixNano()
+				stackedOn[key] += v
+				v = stackedOn[key]
+			}
+			pts = append(pts, plotter.XY{X: float64(sample.At.Unix()), Y: v})
+		}
+		if len(pts) == 0 {
+			continue
+		}
+
+		line, err := plotter.NewLine(pts)
+		if err != nil {
+			return fmt.Errorf("plotting %s: %w", s.Name, err)
+		}
+		line.Color = plotutil.Color(i)
+		line.Width = vg.Points(1.5)
+		p.Add(line)
+		if legend && i < maxLegendEntries {
+			p.Legend.Add(legendLabel(sug.LegendFormat, s), line)
+		}
+	}
+	p.Legend.Top = true
+	return nil
+}
+
+func renderBars(p *plot.Plot, series []prometheus.Series, sug Suggestion, th theme) error {
+	addGrid(p, th)
+
+	// Bars compare the latest value of each series, largest first.
+	sort.SliceStable(series, func(i, j int) bool {
+		return last(series[i]) > last(series[j])
+	})
+	if len(series) > maxBars {
+		series = series[:maxBars]
+	}
+
+	values := make(plotter.Values, len(series))
+	names := make([]string, len(series))
+	for i, s := range series {
+		values[i] = last(s)
+		names[i] = legendLabel(sug.LegendFormat, s)
+	}
+
+	bars, err := plotter.NewBarChart(values, vg.Points(20))
+	if err != nil {
+		return fmt.Errorf("plotting bars: %w", err)
+	}
+	bars.Color = plotutil.Color(0)
+	bars.LineStyle.Width = 0
+	p.Add(bars)
+	p.NominalX(names...)
+	p.Y.Label.Text = sug.Unit
+	return nil
+}
+
+func renderGauge(p *plot.Plot, s prometheus.Series, unit string, th theme) error {
+	p.HideAxes()
+	value := last(s)
+	p.Add(gauge{
+		value: value,
+		max:   gaugeMax(value, unit),
+		label: formatGaugeValue(value, unit),
+		fg:    th.foreground,
+		track: th.grid,
+		fill:  plotutil.Color(0),
+	})
+	return nil
+}
+
+// renderHeatmap draws histogram buckets over time. Buckets are cumulative,
+// so each row shows the difference to the next lower bucket.
+func renderHeatmap(p *plot.Plot, series []prometheus.Series) error {
+	type bucket struct {
+		le     float64
+		label  string
+		values map[int64]float64
+	}
+
+	var buckets []bucket
+	times := make(map[int64]bool)
+	for _, s := range series {
+		le, err := strconv.ParseFloat(s.Labels["le"], 64)
+		if err != nil {
+			return fmt.Errorf("heatmap requires an le label on every series: %s", s.Name)
+		}
+		b := bucket{le: le, label: s.Labels["le"], values: make(map[int64]float64)}
+		for _, sample := range s.Samples {
+			t := sample.At.Unix()
+			b.values[t] += sample.Value
+			times[t] = true
+		}
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].le < buckets[j].le })
+
+	grid := &heatGrid{rows: len(buckets)}
+	for t := range times {
+		grid.times = append(grid.times, t)
+	}
+	sort.Slice(grid.times, func(i, j int) bool { return grid.times[i] < grid.times[j] })
+
+	grid.z = make([][]float64, len(grid.times))
+	for c, t := range grid.times {
+		grid.z[c] = make([]float64, len(buckets))
+		prev := 0.0
+		for r, b := range buckets {
+			v := b.values[t]
+			grid.z[c][r] = math.Max(0, v-prev)
+			prev = v
+		}
+	}
+
+	heat := plotter.NewHeatMap(grid, moreland.ExtendedBlackBody().Palette(255))
+	p.Add(heat)
+
+	labels := make([]string, len(buckets))
+	for i, b := range buckets {
+		labels[i] = b.label
+	}
+	p.Y.Tick.Marker = bucketTicks(labels)
+	p.Y.Label.Text = "le"
+	p.X.Tick.Marker = plot.TimeTicks{Format: "15:04"}
+	return nil
+}
+
+// heatGrid implements plotter.GridXYZ with time columns and bucket rows.
+type heatGrid struct {
+	times []int64
+	rows  int
+	z     [][]float64
+}
+
+func (g *heatGrid) Dims() (int, int)   { return len(g.times), g.rows }
+func (g *heatGrid) Z(c, r int) float64 { return g.z[c][r] }
+func (g *heatGrid) X(c int) float64    { return float64(g.times[c]) }
+func (g *heatGrid) Y(r int) float64    { return float64(r) }
+func (g *heatGrid) Min() float64       { return g.extreme(math.Min, math.Inf(1)) }
+func (g *heatGrid) Max() float64       { return g.extreme(math.Max, math.Inf(-1)) }
+func (g *heatGrid) extreme(f func(a, b float64) float64, start float64) float64 {
+	v := start
+	for _, col := range g.z {
+		for _, z := range col {
+			v = f(v, z)
+		}
+	}
+	if math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+type bucketTicks []string
+
+func (b bucketTicks) Ticks(min, max float64) []plot.Tick {
+	ticks := make([]plot.Tick, len(b))
+	for i, label := range b {
+		ticks[i] = plot.Tick{Value: float64(i), Label: label}
+	}
+	return ticks
+}
+
+// gauge draws a half-ring filled in proportion to value/max, with the value
+// printed in the middle.
+type gauge struct {
+	value, max float64
+	label      string
+	fg         color.Color
+	track      color.Color
+	fill       color.Color
+}
+
+func (g gauge) Plot(c draw.Canvas, _ *plot.Plot) {
+	size := c.Max.Sub(c.Min)
+	radius := vg.Length(math.Min(float64(size.X)/2, float64(size.Y))) * 0.85
+	width := radius / 5
+	center := vg.Point{X: c.Center().X, Y: c.Min.Y + (size.Y-radius)/2}
+
+	ring := func(fraction float64, clr color.Color) {
+		var path vg.Path
+		path.Arc(center, radius-width/2, math.Pi, -math.Pi*fraction)
+		c.SetLineStyle(draw.LineStyle{Color: clr, Width: width})
+		c.Stroke(path)
+	}
+	ring(1, g.track)
+	if g.max > 0 {
+		ring(math.Max(0, math.Min(1, g.value/g.max)), g.fill)
+	}
+
+	c.FillText(textStyle(g.fg, radius/5), vg.Point{X: center.X, Y: center.Y + radius/8}, g.label)
+}
+
+func (g gauge) DataRange() (xmin, xmax, ymin, ymax float64) { return 0, 1, 0, 1 }
+
+// message prints a line of text in the middle of the plot.
+type message struct {
+	text  string
+	color color.Color
+}
+
+func (m message) Plot(c draw.Canvas, _ *plot.Plot) {
+	c.FillText(textStyle(m.color, 18), c.Center(), m.text)
+}
+
+func (m message) DataRange() (xmin, xmax, ymin, ymax float64) { return 0, 1, 0, 1 }
+
+func textStyle(clr color.Color, size vg.Length) draw.TextStyle {
+	return draw.TextStyle{
+		Color:   clr,
+		Font:    font.From(plot.DefaultFont, size),
+		XAlign:  text.XCenter,
+		YAlign:  text.YCenter,
+		Handler: plot.DefaultTextHandler,
+	}
+}
+
+// gaugeMax picks the end of the gauge scale: 1 or 100 for ratios and
+// percentages, otherwise the next power of ten above the value.
+func gaugeMax(value float64, unit string) float64 {
+	switch unit {
+	case "percentunit":
+		return 1
+	case "percent":
+		return 100
+	}
+	if value <= 0 {
+		return 1
+	}
+	return math.Pow(10, math.Ceil(math.Log10(value)))
+}
+
+func formatGaugeValue(value float64, unit string) string {
+	switch unit {
+	case "percentunit":
+		return strconv.FormatFloat(value*100, 'f', 1, 64) + "%"
+	case "percent":
+		return strconv.FormatFloat(value, 'f', 1, 64) + "%"
+	case "":
+		return strconv.FormatFloat(value, 'g', 4, 64)
+	}
+	return strconv.FormatFloat(value, 'g', 4, 64) + " " + unit
+}
+
+// legendLabel expands a {{label}} legend format for s, falling back to the
+// series name.
+func legendLabel(format string, s prometheus.Series) string {
+	if format == "" {
+		return s.Name
+	}
+	label := format
+	for k, v := range s.Labels {
+		label = strings.ReplaceAll(label, "{{"+k+"}}", v)
+	}
+	return label
+}
+
+func last(s prometheus.Series) float64 {
+	return s.Samples[len(s.Samples)-1].Value
+}
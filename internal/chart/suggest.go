@@ -0,0 +1,312 @@
+// Package chart suggests how to visualise the result of a PromQL query.
+package chart
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Chart types.
+const (
+	TypeTimeSeries = "time-series"
+	TypeBar        = "bar"
+	TypePie        = "pie"
+	TypeGauge      = "gauge"
+	TypeTable      = "table"
+	TypeHeatmap    = "heatmap"
+)
+
+const (
+	// maxPieSlices is the most series a pie chart stays readable with.
+	maxPieSlices = 8
+	// maxBars is the most series shown as bars before falling back to a table.
+	maxBars = 20
+	// logScaleRatio is the spread between the largest and smallest positive
+	// value above which a log scale is suggested.
+	logScaleRatio = 1000
+)
+
+// Suggestion is the recommended visualisation for a query result.
+type Suggestion struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+	// Stacked is set when the series are parts of a whole, such as a sum
+	// split by a label.
+	Stacked  bool `json:"stacked,omitempty"`
+	LogScale bool `json:"logScale,omitempty"`
+	// Unit is a Grafana unit id such as "s", "bytes" or "reqps".
+	Unit string `json:"unit,omitempty"`
+	// LegendFormat names series from their labels, e.g. "{{job}}".
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// shape is what the suggestion needs to know about a query.
+type shape struct {
+	// outer is the outermost aggregation, if the query ends in one.
+	outer *parser.AggregateExpr
+	// buckets is set when histogram buckets are selected without being
+	// reduced to a quantile.
+	buckets bool
+	// rate is set when a rate-like function is applied.
+	rate bool
+	// metric is the first selected metric name.
+	metric string
+	// metricType is the type of metric, from the schema or its name.
+	metricType string
+	// ratio is set for a division of two vectors, such as an error rate.
+	ratio bool
+}
+
+// Suggest picks a chart for promQL from its AST and the shape of result.
+// metrics may be nil, in which case metric types are inferred from names.
+func Suggest(promQL string, result *prometheus.QueryResult, metrics map[string]prometheus.MetricSchema) Suggestion {
+	expr, err := parser.ParseExpr(promQL)
+	if err != nil {
+		return suggestFromResult(result, shape{})
+	}
+	return suggestFromResult(result, inspect(expr, metrics))
+}
+
+func inspect(expr parser.Expr, metrics map[string]prometheus.MetricSchema) shape {
+	var s shape
+	s.outer = outerAggregation(expr)
+
+	if b, ok := unwrap(expr).(*parser.BinaryExpr); ok && b.Op == parser.DIV &&
+		b.LHS.Type() == parser.ValueTypeVector && b.RHS.Type() == parser.ValueTypeVector {
+		s.ratio = true
+	}
+
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			switch n.Func.Name {
+			case "rate", "irate", "increase":
+				s.rate = true
+			}
+		case *parser.VectorSelector:
+			if n.Name == "" {
+				return nil
+			}
+			if s.metric == "" {
+				s.metric = n.Name
+				s.metricType = prometheus.InferMetricType(n.Name)
+				if schema, ok := metrics[n.Name]; ok && schema.Type != "" {
+					s.metricType = schema.Type
+				}
+			}
+			if strings.HasSuffix(n.Name, "_bucket") && !inQuantile(path) {
+				s.buckets = true
+			}
+		}
+		return nil
+	})
+	return s
+}
+
+func suggestFromResult(result *prometheus.QueryResult, s shape) Suggestion {
+	stats := result.Stats()
+	sug := Suggestion{
+		Unit:         unitFor(s),
+		LegendFormat: legendFormat(s, stats),
+		LogScale:     needsLogScale(stats),
+	}
+
+	matrix := result.Data.ResultType == prometheus.ResultMatrix
+	grouped := s.outer != nil && len(s.outer.Grouping) > 0 && !s.outer.Without
+
+	switch {
+	case s.buckets:
+		sug.Type = TypeHeatmap
+		sug.Reason = "Query selects histogram buckets, which show their distribution best as a heatmap"
+		sug.LegendFormat = "{{le}}"
+	case s.outer != nil && (s.outer.Op == parser.TOPK || s.outer.Op == parser.BOTTOMK) && !matrix:
+		sug.Type = TypeBar
+		sug.Reason = fmt.Sprintf("Query ranks series with %s, which compare best side by side", s.outer.Op)
+	case matrix:
+		sug.Type = TypeTimeSeries
+		sug.Reason = "Query returns values over time"
+		if len(stats) > 1 && grouped && additive(s.outer) && nonNegative(stats) && !s.ratio {
+			sug.Stacked = true
+			sug.Reason += "; the series split a total by " + strings.Join(s.outer.Grouping, ", ") + " and can be stacked"
+		}
+	case len(stats) == 0 && result.HasHistograms():
+		sug.Type = TypeTable
+		sug.Reason = "Query returns native histograms, which are listed by count and sum"
+	case len(stats) == 0:
+		sug.Type = TypeTable
+		sug.Reason = "Query returned no data"
+	case len(stats) == 1:
+		sug.Type = TypeGauge
+		sug.Reason = "Query returns a single value"
+	case grouped && additive(s.outer) && len(stats) <= maxPieSlices && nonNegative(stats) && !s.ratio:
+		sug.Type = TypePie
+		sug.Reason = "Query splits a total by " + strings.Join(s.outer.Grouping, ", ") + " into a few parts"
+	case len(stats) <= maxBars:
+		sug.Type = TypeBar
+		sug.Reason = fmt.Sprintf("Query returns %d values to compare", len(stats))
+	default:
+		sug.Type = TypeTable
+		sug.Reason = fmt.Sprintf("Query returns %d series, too many to chart", len(stats))
+	}
+	return sug
+}
+
+// outerAggregation returns the aggregation the query ends in, looking
+// through parentheses and functions that keep the labels, such as sort.
+func outerAggregation(expr parser.Expr) *parser.AggregateExpr {
+	for {
+		switch e := unwrap(expr).(type) {
+		case *parser.AggregateExpr:
+			return e
+		case *parser.Call:
+			switch e.Func.Name {
+			case "sort", "sort_desc", "abs", "ceil", "floor", "round", "clamp", "clamp_min", "clamp_max":
+				expr = e.Args[0]
+				continue
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+func unwrap(expr parser.Expr) parser.Expr {
+	for {
+		switch e := expr.(type) {
+		case *parser.ParenExpr:
+			expr = e.Expr
+		case *parser.StepInvariantExpr:
+			expr = e.Expr
+		default:
+			return expr
+		}
+	}
+}
+
+func inQuantile(path []parser.Node) bool {
+	for _, n := range path {
+		if call, ok := n.(*parser.Call); ok && strings.HasPrefix(call.Func.Name, "histogram_") {
+			return true
+		}
+	}
+	return false
+}
+
+// additive reports whether the aggregation's series add up to a meaningful
+// total.
+func additive(agg *parser.AggregateExpr) bool {
+	return agg.Op == parser.SUM || agg.Op == parser.COUNT
+}
+
+func nonNegative(stats []prometheus.SeriesStats) bool {
+	for _, st := range stats {
+		if st.Min < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func needsLogScale(stats []prometheus.SeriesStats) bool {
+	lo, hi := math.Inf(1), 0.0
+	for _, st := range stats {
+		if st.Min < 0 {
+			return false
+		}
+		if st.Min > 0 && st.Min < lo {
+			lo = st.Min
+		}
+		if st.Max > hi {
+			hi = st.Max
+		}
+	}
+	return !math.IsInf(lo, 1) && hi/lo > logScaleRatio
+}
+
+// unitFor derives a Grafana unit from the metric name's base unit suffix,
+// as recommended by the Prometheus naming conventions.
+func unitFor(s shape) string {
+	if s.ratio {
+		return "percentunit"
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(s.metric, "_total"), "_bucket"), "_count")
+
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		if s.rate && !s.buckets && s.metricType != "histogram" {
+			// Seconds spent per second, e.g. CPU usage.
+			return "percentunit"
+		}
+		return "s"
+	case strings.HasSuffix(name, "_bytes"):
+		if s.rate {
+			return "Bps"
+		}
+		return "bytes"
+	case strings.HasSuffix(name, "_ratio"):
+		return "percentunit"
+	case strings.HasSuffix(name, "_percent"):
+		return "percent"
+	case strings.HasSuffix(name, "_celsius"):
+		return "celsius"
+	case s.rate && s.metricType == "counter":
+		if strings.Contains(name, "request") {
+			return "reqps"
+		}
+		return "ops"
+	}
+	return ""
+}
+
+// legendFormat names series by the labels the query groups by, or
+// otherwise by the labels whose values differ between series.
+func legendFormat(s shape, stats []prometheus.SeriesStats) string {
+	var labels []string
+	if s.outer != nil && len(s.outer.Grouping) > 0 && !s.outer.Without {
+		labels = s.outer.Grouping
+	} else {
+		labels = varyingLabels(stats)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = "{{" + l + "}}"
+	}
+	return strings.Join(parts, " ")
+}
+
+func varyingLabels(stats []prometheus.SeriesStats) []string {
+	if len(stats) < 2 {
+		return nil
+	}
+	values := make(map[string]map[string]bool)
+	for _, st := range stats {
+		for k, v := range st.Labels {
+			if k == "__name__" {
+				continue
+			}
+			if values[k] == nil {
+				values[k] = make(map[string]bool)
+			}
+			values[k][v] = true
+		}
+	}
+
+	var labels []string
+	for k, vs := range values {
+		if len(vs) > 1 {
+			labels = append(labels, k)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
@@ -0,0 +1,389 @@
+package chart
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+// sparkTicks are the eight block heights a sparkline is drawn with.
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// ansiColors cycles through the standard foreground colors for series.
+var ansiColors = []string{"\033[31m", "\033[32m", "\033[33m", "\033[34m", "\033[35m", "\033[36m"}
+
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiDim   = "\033[2m"
+)
+
+// TerminalOptions controls terminal output.
+type TerminalOptions struct {
+	// Width is the terminal width in columns.
+	Width int
+	// Height is the number of rows of a braille chart.
+	Height int
+	Color  bool
+	// LegendFormat names series from their labels, e.g. "{{job}}".
+	LegendFormat string
+}
+
+func (o TerminalOptions) paint(code, s string) string {
+	if !o.Color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (o TerminalOptions) seriesColor(i int) string {
+	return ansiColors[i%len(ansiColors)]
+}
+
+// Sparkline scales values into a single line of block characters, at most
+// width runes long.
+func Sparkline(values []float64, width int) string {
+	if len(values) == 0 || width <= 0 {
+		return ""
+	}
+	values = resample(values, width)
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		i := len(sparkTicks) / 2
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(sparkTicks)-1))
+		}
+		b.WriteRune(sparkTicks[i])
+	}
+	return b.String()
+}
+
+// resample reduces values to n points by averaging neighbours.
+func resample(values []float64, n int) []float64 {
+	if len(values) <= n {
+		return values
+	}
+	out := make([]float64, n)
+	for i := range out {
+		from, to := i*len(values)/n, (i+1)*len(values)/n
+		var sum float64
+		for _, v := range values[from:to] {
+			sum += v
+		}
+		out[i] = sum / float64(to-from)
+	}
+	return out
+}
+
+// WriteSparklines prints one sparkline per series with its name, latest
+// value and range.
+func WriteSparklines(w io.Writer, series []prometheus.Series, opts TerminalOptions) {
+	names := make([]string, len(series))
+	nameWidth := 0
+	for i, s := range series {
+		names[i] = legendLabel(opts.LegendFormat, s)
+		nameWidth = max(nameWidth, utf8.RuneCountInString(names[i]))
+	}
+	// Keep at least half the line for the sparkline itself.
+	nameWidth = min(nameWidth, opts.Width/3)
+
+	for i, s := range series {
+		values := make([]float64, len(s.Samples))
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for j, sample := range s.Samples {
+			values[j] = sample.Value
+			lo, hi = math.Min(lo, sample.Value), math.Max(hi, sample.Value)
+		}
+		suffix := fmt.Sprintf(" %s (%s–%s)", formatNumber(last(s)), formatNumber(lo), formatNumber(hi))
+		sparkWidth := opts.Width - nameWidth - utf8.RuneCountInString(suffix) - 1
+
+		fmt.Fprintf(w, "%s %s%s\n",
+			pad(truncate(names[i], nameWidth), nameWidth),
+			opts.paint(opts.seriesColor(i), Sparkline(values, sparkWidth)),
+			opts.paint(ansiDim, suffix))
+	}
+}
+
+// WriteBrailleChart draws all series as lines on a grid of braille
+// characters, each holding 2x4 dots, with the value range on the left and
+// the time range below.
+func WriteBrailleChart(w io.Writer, series []prometheus.Series, opts TerminalOptions) {
+	if len(series) == 0 {
+		return
+	}
+	height := opts.Height
+	if height <= 0 {
+		height = 10
+	}
+
+	tMin, tMax := series[0].Samples[0].At, series[0].Samples[0].At
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			if sample.At.Before(tMin) {
+				tMin = sample.At
+			}
+			if sample.At.After(tMax) {
+				tMax = sample.At
+			}
+			lo, hi = math.Min(lo, sample.Value), math.Max(hi, sample.Value)
+		}
+	}
+	if hi == lo {
+		lo, hi = lo-1, hi+1
+	}
+
+	axis := []string{formatNumber(hi), formatNumber(lo)}
+	axisWidth := max(utf8.RuneCountInString(axis[0]), utf8.RuneCountInString(axis[1]))
+	cols := max(opts.Width-axisWidth-2, 10)
+
+	grid := newBrailleGrid(cols, height)
+	xOf := func(t time.Time) int {
+		if !tMax.After(tMin) {
+			return 0
+		}
+		return int(float64(t.Sub(tMin)) / float64(tMax.Sub(tMin)) * float64(grid.dotsX()-1))
+	}
+	yOf := func(v float64) int {
+		return int((hi - v) / (hi - lo) * float64(grid.dotsY()-1))
+	}
+
+	for i, s := range series {
+		px, py := -1, -1
+		for _, sample := range s.Samples {
+			x, y := xOf(sample.At), yOf(sample.Value)
+			if px >= 0 {
+				grid.line(px, py, x, y, i)
+			} else {
+				grid.set(x, y, i)
+			}
+			px, py = x, y
+		}
+	}
+
+	for row := 0; row < height; row++ {
+		label := ""
+		switch row {
+		case 0:
+			label = axis[0]
+		case height - 1:
+			label = axis[1]
+		}
+		fmt.Fprintf(w, "%*s ┤%s\n", axisWidth, label, grid.row(row, opts))
+	}
+
+	start, end := tMin.Local().Format("15:04"), tMax.Local().Format("15:04")
+	gap := max(cols-len(start)-len(end), 1)
+	fmt.Fprintf(w, "%*s  %s%s%s\n", axisWidth, "", start, strings.Repeat(" ", gap), end)
+
+	if len(series) > 1 {
+		for i, s := range series {
+			fmt.Fprintf(w, "%*s  %s %s\n", axisWidth, "", opts.paint(opts.seriesColor(i), "━━"), legendLabel(opts.LegendFormat, s))
+		}
+	}
+}
+
+// brailleGrid is a canvas of braille cells. Each cell remembers the series
+// that last drew in it, which decides its color.
+type brailleGrid struct {
+	cols, rows int
+	dots       [][]rune
+	owner      [][]int
+}
+
+// brailleDots maps a dot position within a cell to its bit, indexed by
+// [y][x].
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+func newBrailleGrid(cols, rows int) *brailleGrid {
+	g := &brailleGrid{cols: cols, rows: rows}
+	g.dots = make([][]rune, rows)
+	g.owner = make([][]int, rows)
+	for r := range g.dots {
+		g.dots[r] = make([]rune, cols)
+		g.owner[r] = make([]int, cols)
+	}
+	return g
+}
+
+func (g *brailleGrid) dotsX() int { return g.cols * 2 }
+func (g *brailleGrid) dotsY() int { return g.rows * 4 }
+
+func (g *brailleGrid) set(x, y, series int) {
+	if x < 0 || y < 0 || x >= g.dotsX() || y >= g.dotsY() {
+		return
+	}
+	g.dots[y/4][x/2] |= brailleDots[y%4][x%2]
+	g.owner[y/4][x/2] = series
+}
+
+// line draws from (x0, y0) to (x1, y1) with Bresenham's algorithm.
+func (g *brailleGrid) line(x0, y0, x1, y1, series int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	e := dx + dy
+	for {
+		g.set(x0, y0, series)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func (g *brailleGrid) row(r int, opts TerminalOptions) string {
+	var b strings.Builder
+	for c, dots := range g.dots[r] {
+		cell := string(0x2800 + dots)
+		if dots != 0 {
+			cell = opts.paint(opts.seriesColor(g.owner[r][c]), cell)
+		}
+		b.WriteString(cell)
+	}
+	return b.String()
+}
+
+// WriteTable prints the latest value of every series as an aligned table,
+// largest value first, with one column per label that differs between
+// series. Cells are shortened to fit opts.Width.
+func WriteTable(w io.Writer, series []prometheus.Series, opts TerminalOptions) {
+	series = append([]prometheus.Series(nil), series...)
+	sort.SliceStable(series, func(i, j int) bool { return last(series[i]) > last(series[j]) })
+
+	labels := tableLabels(series)
+	header := append(append([]string(nil), labels...), "VALUE")
+	rows := make([][]string, len(series))
+	for i, s := range series {
+		row := make([]string, 0, len(header))
+		for _, l := range labels {
+			row = append(row, s.Labels[l])
+		}
+		rows[i] = append(row, formatNumber(last(s)))
+	}
+
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	fitWidths(widths, opts.Width)
+
+	printRow := func(cells []string, code string) {
+		parts := make([]string, len(cells))
+		for i, cell := range cells {
+			cell = truncate(cell, widths[i])
+			if i == len(cells)-1 {
+				parts[i] = fmt.Sprintf("%*s", widths[i], cell)
+			} else {
+				parts[i] = pad(cell, widths[i])
+			}
+		}
+		fmt.Fprintln(w, opts.paint(code, strings.Join(parts, "  ")))
+	}
+	printRow(header, ansiBold)
+	for _, row := range rows {
+		printRow(row, "")
+	}
+}
+
+// tableLabels returns the labels worth a column: those whose values differ
+// between series, or every label of a single series.
+func tableLabels(series []prometheus.Series) []string {
+	if len(series) == 1 {
+		var labels []string
+		for k := range series[0].Labels {
+			labels = append(labels, k)
+		}
+		sort.Strings(labels)
+		return labels
+	}
+	stats := make([]prometheus.SeriesStats, len(series))
+	for i, s := range series {
+		stats[i].Labels = s.Labels
+	}
+	labels := varyingLabels(stats)
+	if _, ok := series[0].Labels["__name__"]; ok && len(labels) == 0 {
+		labels = []string{"__name__"}
+	}
+	return labels
+}
+
+// fitWidths shrinks the widest columns until the row, with two spaces
+// between columns, fits into total.
+func fitWidths(widths []int, total int) {
+	if total <= 0 {
+		return
+	}
+	for {
+		sum := 2 * (len(widths) - 1)
+		widest := 0
+		for i, w := range widths {
+			sum += w
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if sum <= total || widths[widest] <= 4 {
+			return
+		}
+		widths[widest]--
+	}
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string([]rune(s)[:width])
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+func pad(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
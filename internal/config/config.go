@@ -6,6 +6,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/agentkube/txt2promql/internal/decode"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/resilience"
+	promconfig "github.com/prometheus/common/config"
 	"github.com/spf13/viper"
 )
 
@@ -16,6 +20,7 @@ type Config struct {
 	AI         AIConfig         `mapstructure:"ai"`
 	KG         KGConfig         `mapstructure:"knowledge_graph"`
 	Semantic   SemanticConfig   `mapstructure:"semantic_memory"`
+	Session    SessionConfig    `mapstructure:"session"`
 }
 
 // ServerConfig
@@ -29,16 +34,32 @@ type ServerConfig struct {
 type PrometheusConfig struct {
 	Address string        `mapstructure:"address"`
 	Timeout time.Duration `mapstructure:"timeout"`
+	// SchemaSnapshot is a file written by "schema export". When set,
+	// conversions run against it without contacting Prometheus.
+	SchemaSnapshot string `mapstructure:"schema_snapshot"`
+	// Datasources lists named Prometheus servers queries are routed
+	// across. When empty, Address is the only datasource.
+	Datasources []prometheus.DatasourceConfig `mapstructure:"datasources"`
+	// HTTPConfig authenticates requests to Address, see
+	// prometheus.DatasourceConfig.
+	HTTPConfig *promconfig.HTTPClientConfig `mapstructure:"http_config"`
+	// Resilience tunes retries and the circuit breaker for Address.
+	Resilience resilience.Config `mapstructure:"resilience"`
 }
 
 // AI provider settings
 type AIConfig struct {
+	// Provider is openai (default) or mock, which answers from ai.mock
+	// fixtures and rules without a model API.
+	Provider      string   `mapstructure:"provider"`
 	Model         string   `mapstructure:"model"`
 	Temperature   float32  `mapstructure:"temperature"`
 	TopP          float32  `mapstructure:"top_p"`
 	BaseURL       string   `mapstructure:"base_url"`
 	Proxy         string   `mapstructure:"proxy"`
 	CustomHeaders []Header `mapstructure:"custom_headers"`
+	// Resilience tunes retries and the circuit breaker for the model API.
+	Resilience resilience.Config `mapstructure:"resilience"`
 }
 
 // HTTP header
@@ -60,6 +81,13 @@ type SemanticConfig struct {
 	EmbeddingsModel string `mapstructure:"embeddings_model"`
 }
 
+// SessionConfig holds conversational session settings
+type SessionConfig struct {
+	Store string        `mapstructure:"store"` // memory or file
+	Path  string        `mapstructure:"path"`
+	TTL   time.Duration `mapstructure:"ttl"`
+}
+
 var (
 	// Global configuration instance
 	globalConfig *Config
@@ -88,7 +116,7 @@ func LoadConfig() (*Config, error) {
 	loadEnvVariables()
 
 	config := &Config{}
-	if err := viper.Unmarshal(config); err != nil {
+	if err := decode.Unmarshal(config); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
@@ -129,6 +157,11 @@ func setDefaults() {
 	viper.SetDefault("semantic_memory.enabled", true)
 	viper.SetDefault("semantic_memory.faiss_index", "./data/faiss.index")
 	viper.SetDefault("semantic_memory.embeddings_model", "sentence-transformers/all-MiniLM-L6-v2")
+
+	// Session defaults
+	viper.SetDefault("session.store", "memory")
+	viper.SetDefault("session.path", "./data/sessions.json")
+	viper.SetDefault("session.ttl", "1h")
 }
 
 // loadEnvVariables loads environment variables into viper
@@ -168,5 +201,9 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("AI top_p must be between 0 and 1")
 	}
 
+	if cfg.Session.Store != "memory" && cfg.Session.Store != "file" {
+		return fmt.Errorf("session store must be memory or file")
+	}
+
 	return nil
 }
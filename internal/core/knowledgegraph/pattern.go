@@ -111,6 +111,20 @@ func (kp *KnowledgePatterns) FindPatterns(query string, availableMetrics map[str
 	return matches
 }
 
+// Examples returns the query shape of every known pattern.
+func (kp *KnowledgePatterns) Examples() []string {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+
+	var examples []string
+	for _, patterns := range kp.patterns {
+		for _, pattern := range patterns {
+			examples = append(examples, pattern.Pattern)
+		}
+	}
+	return examples
+}
+
 type MetricInfo struct {
 	Name        string            `json:"name"`
 	Pattern     string            `json:"pattern"`
@@ -2,18 +2,23 @@ package parser
 
 import (
 	"regexp"
+	"sort"
 )
 
 type Intent struct {
 	Type      string
 	Operation string
 	TimeFrame string
+	// Range is set when the question asks how something changed over time
+	// rather than for its current value.
+	Range     bool
 	Modifiers map[string]string
 }
 
 type IntentParser struct {
 	timePatterns map[string]*regexp.Regexp
 	opPatterns   map[string]*regexp.Regexp
+	rangePattern *regexp.Regexp
 }
 
 func NewIntentParser() *IntentParser {
@@ -29,6 +34,7 @@ func NewIntentParser() *IntentParser {
 			"sum":   regexp.MustCompile(`(?i)sum|total`),
 			"count": regexp.MustCompile(`(?i)count|number of`),
 		},
+		rangePattern: regexp.MustCompile(`(?i)over time|over the (last|past)|trend|history|graph|plot|chart|during|since|between`),
 	}
 }
 
@@ -39,16 +45,18 @@ func (p *IntentParser) Parse(query string) (*Intent, error) {
 	}
 
 	// Detect time frame
-	for frame, pattern := range p.timePatterns {
-		if pattern.MatchString(query) {
+	for _, frame := range sortedKeys(p.timePatterns) {
+		if p.timePatterns[frame].MatchString(query) {
 			intent.TimeFrame = frame
 			break
 		}
 	}
 
+	intent.Range = intent.TimeFrame != "" || p.rangePattern.MatchString(query)
+
 	// Detect operation
-	for op, pattern := range p.opPatterns {
-		if pattern.MatchString(query) {
+	for _, op := range sortedKeys(p.opPatterns) {
+		if p.opPatterns[op].MatchString(query) {
 			intent.Operation = op
 			break
 		}
@@ -61,3 +69,14 @@ func (p *IntentParser) Parse(query string) (*Intent, error) {
 
 	return intent, nil
 }
+
+// sortedKeys keeps pattern matching deterministic when a query matches
+// more than one pattern.
+func sortedKeys(patterns map[string]*regexp.Regexp) []string {
+	keys := make([]string, 0, len(patterns))
+	for k := range patterns {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+// Package decode unmarshals viper configuration into structs that embed
+// Prometheus configuration types.
+package decode
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/mitchellh/mapstructure"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPConfigHook lets viper decode http_config sections into
+// promconfig.HTTPClientConfig, which only carries yaml tags. The section is
+// re-encoded as YAML so it is read exactly like Prometheus' own http_config:
+// same keys, same defaults, same validation.
+func HTTPConfigHook() mapstructure.DecodeHookFuncType {
+	target := reflect.TypeOf(promconfig.HTTPClientConfig{})
+	return func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != target || from.Kind() != reflect.Map {
+			return data, nil
+		}
+		raw, err := yaml.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		var cfg promconfig.HTTPClientConfig
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("http_config: %w", err)
+		}
+		return cfg, nil
+	}
+}
+
+// hooks are viper's default decode hooks plus HTTPConfigHook.
+// Passing a hook to viper replaces its defaults, so they are repeated here.
+func hooks() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		HTTPConfigHook(),
+	))
+}
+
+// UnmarshalKey is viper.UnmarshalKey with support for http_config sections.
+func UnmarshalKey(key string, out interface{}) error {
+	return viper.UnmarshalKey(key, out, hooks())
+}
+
+// Unmarshal is viper.Unmarshal with support for http_config sections.
+func Unmarshal(out interface{}) error {
+	return viper.Unmarshal(out, hooks())
+}
@@ -0,0 +1,160 @@
+// Package eval measures conversion quality against a golden dataset of
+// questions and expected PromQL, run against a fixed schema and synthetic
+// data.
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultInterval = model.Duration(time.Minute)
+	defaultDuration = model.Duration(2 * time.Hour)
+)
+
+// Dataset is a golden dataset: the schema conversions see, how synthetic
+// data for it is generated, and the cases to score.
+type Dataset struct {
+	Name      string      `yaml:"name"`
+	Synthetic Synthetic   `yaml:"synthetic"`
+	Metrics   []MetricDef `yaml:"metrics"`
+	Cases     []Case      `yaml:"cases"`
+}
+
+// Synthetic controls the data results are compared on.
+type Synthetic struct {
+	// Interval between samples. Defaults to 1m.
+	Interval model.Duration `yaml:"interval"`
+	// Duration of generated data. Defaults to 2h.
+	Duration model.Duration `yaml:"duration"`
+	// Load is extra series in promql test "load" notation, for cases the
+	// generated data cannot tell apart.
+	Load string `yaml:"load"`
+}
+
+// MetricDef describes a metric of the fixed schema. Every combination of
+// label values becomes one synthetic series.
+type MetricDef struct {
+	Name   string              `yaml:"name"`
+	Type   string              `yaml:"type"`
+	Help   string              `yaml:"help"`
+	Labels map[string][]string `yaml:"labels"`
+	// Values, in load notation such as "1x120", replace the generated
+	// samples. Series take them in turn, so ["1x120", "0x120"] makes every
+	// other series 0.
+	Values []string `yaml:"values"`
+}
+
+// Case is one question with the PromQL a correct conversion is equivalent
+// to.
+type Case struct {
+	ID       string `yaml:"id"`
+	Category string `yaml:"category"`
+	Question string `yaml:"question"`
+	Expected string `yaml:"expected"`
+}
+
+// LoadDataset reads and checks a dataset file.
+func LoadDataset(path string) (*Dataset, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d Dataset
+	if err := yaml.Unmarshal(content, &d); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := d.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &d, nil
+}
+
+func (d *Dataset) validate() error {
+	if len(d.Metrics) == 0 {
+		return errors.New("dataset has no metrics")
+	}
+	if len(d.Cases) == 0 {
+		return errors.New("dataset has no cases")
+	}
+	if d.Synthetic.Interval <= 0 {
+		d.Synthetic.Interval = defaultInterval
+	}
+	if d.Synthetic.Duration <= 0 {
+		d.Synthetic.Duration = defaultDuration
+	}
+
+	seen := make(map[string]bool)
+	for i := range d.Cases {
+		c := &d.Cases[i]
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("case-%d", i+1)
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("duplicate case id %q", c.ID)
+		}
+		seen[c.ID] = true
+		if c.Category == "" {
+			c.Category = "uncategorized"
+		}
+		if c.Question == "" || c.Expected == "" {
+			return fmt.Errorf("case %s needs a question and an expected query", c.ID)
+		}
+		if _, err := parser.ParseExpr(c.Expected); err != nil {
+			return fmt.Errorf("case %s: expected query does not parse: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// Schema returns the metrics in the form discovery produces, so the
+// pipeline can be pinned to them.
+func (d *Dataset) Schema() map[string]prometheus.MetricSchema {
+	schema := make(map[string]prometheus.MetricSchema, len(d.Metrics))
+	for _, m := range d.Metrics {
+		metricType := m.Type
+		if metricType == "" {
+			metricType = prometheus.InferMetricType(m.Name)
+		}
+		labels := map[string]string{"__name__": m.Name}
+		values := make(map[string][]string, len(m.Labels))
+		for label, vs := range m.Labels {
+			sorted := append([]string(nil), vs...)
+			sort.Strings(sorted)
+			values[label] = sorted
+			if len(vs) > 0 {
+				labels[label] = vs[0]
+			}
+		}
+		schema[m.Name] = prometheus.MetricSchema{
+			Name:        m.Name,
+			Type:        metricType,
+			Help:        m.Help,
+			Labels:      labels,
+			LabelValues: values,
+		}
+	}
+	return schema
+}
+
+// Categories returns the case categories in order of first appearance.
+func (d *Dataset) Categories() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, c := range d.Cases {
+		if !seen[c.Category] {
+			seen[c.Category] = true
+			out = append(out, c.Category)
+		}
+	}
+	return out
+}
@@ -0,0 +1,283 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// CaseResult is the scored answer to one case.
+type CaseResult struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	Question string `json:"question"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Exact is a textual match, AST a match after normalization and Result
+	// equal results on the synthetic data. Each implies the next.
+	Exact   bool           `json:"exact"`
+	AST     bool           `json:"ast"`
+	Result  bool           `json:"result"`
+	Latency model.Duration `json:"latency"`
+	Tokens  int            `json:"tokens"`
+	// Note explains why the result did not match.
+	Note string `json:"note,omitempty"`
+}
+
+// Correct reports whether the answer is equivalent to the expected query.
+func (c CaseResult) Correct() bool {
+	return c.Exact || c.AST || c.Result
+}
+
+// Score aggregates the results of a category, or of the whole run.
+type Score struct {
+	Category string `json:"category"`
+	Cases    int    `json:"cases"`
+	// Exact, AST and Result are the fraction of cases matching at that
+	// level.
+	Exact       float64        `json:"exact"`
+	AST         float64        `json:"ast"`
+	Result      float64        `json:"result"`
+	Errors      int            `json:"errors"`
+	MeanLatency model.Duration `json:"mean_latency"`
+	Tokens      int            `json:"tokens"`
+}
+
+// Report is the outcome of a run, saved as JSON to diff later runs
+// against.
+type Report struct {
+	Dataset    string         `json:"dataset"`
+	StartedAt  time.Time      `json:"started_at"`
+	Duration   model.Duration `json:"duration"`
+	Results    []CaseResult   `json:"results"`
+	Categories []Score        `json:"categories"`
+	Overall    Score          `json:"overall"`
+}
+
+func (r *Report) summarize(order []string) {
+	byCategory := make(map[string][]CaseResult)
+	for _, res := range r.Results {
+		byCategory[res.Category] = append(byCategory[res.Category], res)
+	}
+	r.Categories = nil
+	for _, category := range order {
+		if results, ok := byCategory[category]; ok {
+			r.Categories = append(r.Categories, score(category, results))
+		}
+	}
+	r.Overall = score("overall", r.Results)
+}
+
+func score(category string, results []CaseResult) Score {
+	s := Score{Category: category, Cases: len(results)}
+	if len(results) == 0 {
+		return s
+	}
+	var exact, ast, result int
+	var latency time.Duration
+	for _, r := range results {
+		if r.Exact {
+			exact++
+		}
+		if r.Exact || r.AST {
+			ast++
+		}
+		if r.Correct() {
+			result++
+		}
+		if r.Error != "" {
+			s.Errors++
+		}
+		latency += time.Duration(r.Latency)
+		s.Tokens += r.Tokens
+	}
+	n := float64(len(results))
+	s.Exact, s.AST, s.Result = float64(exact)/n, float64(ast)/n, float64(result)/n
+	s.MeanLatency = model.Duration(latency / time.Duration(len(results)))
+	return s
+}
+
+// Save writes the report as JSON.
+func (r *Report) Save(path string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// LoadReport reads a report written by Save.
+func LoadReport(path string) (*Report, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(content, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// Write prints the wrong answers and a per-category summary.
+func (r *Report) Write(w io.Writer) {
+	failed := false
+	for _, res := range r.Results {
+		if res.Correct() {
+			continue
+		}
+		failed = true
+		fmt.Fprintf(w, "FAIL %s [%s] %s\n", res.ID, res.Category, res.Question)
+		fmt.Fprintf(w, "  expected: %s\n", res.Expected)
+		if res.Error != "" {
+			fmt.Fprintf(w, "  error:    %s\n", res.Error)
+		} else {
+			fmt.Fprintf(w, "  actual:   %s\n", res.Actual)
+		}
+		if res.Note != "" {
+			fmt.Fprintf(w, "  note:     %s\n", res.Note)
+		}
+	}
+	if failed {
+		fmt.Fprintln(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "category\tcases\texact\tast\tresult\terrors\tmean latency\ttokens\t")
+	for _, s := range append(append([]Score(nil), r.Categories...), r.Overall) {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%d\t%s\t%d\t\n",
+			s.Category, s.Cases, percent(s.Exact), percent(s.AST), percent(s.Result), s.Errors, s.MeanLatency, s.Tokens)
+	}
+	tw.Flush()
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.1f%%", f*100)
+}
+
+// Diff compares a run against a previous one.
+type Diff struct {
+	// Fixed cases are correct now but were not before; Regressed the
+	// reverse. Changed cases kept their score with a different answer.
+	Fixed     []CaseResult `json:"fixed"`
+	Regressed []CaseResult `json:"regressed"`
+	Changed   []CaseResult `json:"changed"`
+	// Added and Removed list case ids present in only one run.
+	Added      []string        `json:"added,omitempty"`
+	Removed    []string        `json:"removed,omitempty"`
+	Categories []CategoryDelta `json:"categories"`
+
+	// before holds the previous answers, to show what changed.
+	before map[string]CaseResult
+}
+
+// CategoryDelta is the change of a category's score between runs.
+type CategoryDelta struct {
+	Category string `json:"category"`
+	Before   Score  `json:"before"`
+	After    Score  `json:"after"`
+}
+
+// Compare diffs current against previous, case by case.
+func Compare(previous, current *Report) *Diff {
+	before := make(map[string]CaseResult, len(previous.Results))
+	for _, res := range previous.Results {
+		before[res.ID] = res
+	}
+	d := &Diff{before: before}
+	seen := make(map[string]bool)
+	for _, res := range current.Results {
+		seen[res.ID] = true
+		old, ok := before[res.ID]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, res.ID)
+		case res.Correct() && !old.Correct():
+			d.Fixed = append(d.Fixed, res)
+		case !res.Correct() && old.Correct():
+			d.Regressed = append(d.Regressed, res)
+		case res.Actual != old.Actual:
+			d.Changed = append(d.Changed, res)
+		}
+	}
+	for _, res := range previous.Results {
+		if !seen[res.ID] {
+			d.Removed = append(d.Removed, res.ID)
+		}
+	}
+
+	oldScores := make(map[string]Score)
+	for _, s := range append(previous.Categories, previous.Overall) {
+		oldScores[s.Category] = s
+	}
+	for _, s := range append(append([]Score(nil), current.Categories...), current.Overall) {
+		d.Categories = append(d.Categories, CategoryDelta{Category: s.Category, Before: oldScores[s.Category], After: s})
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// Write prints the changed cases and the score deltas.
+func (d *Diff) Write(w io.Writer) {
+	section := func(title string, results []CaseResult) {
+		if len(results) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s (%d):\n", title, len(results))
+		for _, res := range results {
+			fmt.Fprintf(w, "  %s [%s] %s\n", res.ID, res.Category, res.Question)
+			if old, ok := d.before[res.ID]; ok && old.Actual != res.Actual {
+				fmt.Fprintf(w, "    - %s\n", answer(old))
+			}
+			fmt.Fprintf(w, "    + %s\n", answer(res))
+		}
+	}
+	section("Regressed", d.Regressed)
+	section("Fixed", d.Fixed)
+	section("Changed", d.Changed)
+	if len(d.Added) > 0 {
+		fmt.Fprintf(w, "Added: %s\n", strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		fmt.Fprintf(w, "Removed: %s\n", strings.Join(d.Removed, ", "))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "category\tresult\tΔ\tast\tΔ\tmean latency\tΔ\ttokens\tΔ\t")
+	for _, c := range d.Categories {
+		a, b := c.After, c.Before
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%+d\t\n", c.Category,
+			percent(a.Result), signedPercent(a.Result-b.Result),
+			percent(a.AST), signedPercent(a.AST-b.AST),
+			a.MeanLatency, signedDuration(time.Duration(a.MeanLatency)-time.Duration(b.MeanLatency)),
+			a.Tokens, a.Tokens-b.Tokens)
+	}
+	tw.Flush()
+}
+
+func answer(res CaseResult) string {
+	if res.Error != "" {
+		return "error: " + res.Error
+	}
+	return res.Actual
+}
+
+func signedPercent(f float64) string {
+	return fmt.Sprintf("%+.1f%%", f*100)
+}
+
+func signedDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + model.Duration(-d).String()
+	}
+	return "+" + model.Duration(d).String()
+}
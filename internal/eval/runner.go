@@ -0,0 +1,112 @@
+package eval
+
+import (
+	"context"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/query"
+	"github.com/prometheus/common/model"
+)
+
+// Runner converts every case of a dataset with the pipeline pinned to the
+// dataset's schema and scores the answers.
+type Runner struct {
+	dataset   *Dataset
+	pipeline  *agent.Pipeline
+	meter     *provider.Metered
+	evaluator *Evaluator
+}
+
+// NewRunner prepares a run. client is only used to validate generated
+// queries; conversions never read the schema from it.
+func NewRunner(dataset *Dataset, client *prometheus.Client, llm provider.Provider) (*Runner, error) {
+	evaluator, err := NewEvaluator(dataset)
+	if err != nil {
+		return nil, err
+	}
+	meter := provider.NewMetered(llm)
+	pipeline := agent.NewPipeline(client, meter)
+	pipeline.UseSchema(dataset.Schema())
+	return &Runner{dataset: dataset, pipeline: pipeline, meter: meter, evaluator: evaluator}, nil
+}
+
+func (r *Runner) Close() error {
+	return r.evaluator.Close()
+}
+
+// RunOptions selects cases and reports progress.
+type RunOptions struct {
+	// Categories limits the run to these categories when not empty.
+	Categories []string
+	// OnCase is called after each case is scored.
+	OnCase func(CaseResult)
+}
+
+// Run scores every selected case. A failed conversion counts as a wrong
+// answer rather than an error.
+func (r *Runner) Run(ctx context.Context, opts RunOptions) (*Report, error) {
+	selected := make(map[string]bool, len(opts.Categories))
+	for _, c := range opts.Categories {
+		selected[c] = true
+	}
+
+	report := &Report{Dataset: r.dataset.Name, StartedAt: time.Now()}
+	for _, c := range r.dataset.Cases {
+		if len(selected) > 0 && !selected[c.Category] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := r.runCase(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, result)
+		if opts.OnCase != nil {
+			opts.OnCase(result)
+		}
+	}
+	report.Duration = model.Duration(time.Since(report.StartedAt))
+	report.summarize(r.dataset.Categories())
+	return report, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, c Case) (CaseResult, error) {
+	result := CaseResult{ID: c.ID, Category: c.Category, Question: c.Question, Expected: c.Expected}
+
+	before := r.meter.Usage()
+	started := time.Now()
+	converted, err := r.pipeline.Convert(ctx, c.Question, agent.ConvertOptions{}, nil)
+	result.Latency = model.Duration(time.Since(started))
+	result.Tokens = r.meter.Usage().Sub(before).Total()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Actual = converted.PromQL
+
+	result.Exact = exactMatch(c.Expected, result.Actual)
+	want, _ := query.Normalize(c.Expected)
+	got, err := query.Normalize(result.Actual)
+	if err != nil {
+		result.Note = err.Error()
+		return result, nil
+	}
+	result.AST = got == want
+
+	equivalent, reason, err := r.evaluator.Equivalent(ctx, c.Expected, result.Actual)
+	if err != nil {
+		// The expected query is part of the dataset; failing to evaluate
+		// it is a dataset error.
+		return result, err
+	}
+	result.Result = equivalent || result.AST
+	if !result.Result {
+		result.Note = reason
+	}
+	return result, nil
+}
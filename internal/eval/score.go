@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// tolerance is the relative difference under which two sample values are
+// considered equal.
+const tolerance = 1e-9
+
+// Evaluator compares query results on the dataset's synthetic data.
+type Evaluator struct {
+	storage    *promtest.Storage
+	start, end time.Time
+	step       time.Duration
+}
+
+// NewEvaluator loads the dataset's synthetic data. Results are compared
+// from half an hour in, so rates over long windows have data, to the end.
+func NewEvaluator(d *Dataset) (*Evaluator, error) {
+	storage, err := promtest.NewStorage()
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Load(d.SyntheticLoad()); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("loading synthetic data: %w", err)
+	}
+
+	end := promtest.Start.Add(time.Duration(d.Synthetic.Duration))
+	start := promtest.Start.Add(30 * time.Minute)
+	if !start.Before(end) {
+		start = promtest.Start
+	}
+	return &Evaluator{
+		storage: storage,
+		start:   start,
+		end:     end,
+		step:    end.Sub(start) / 10,
+	}, nil
+}
+
+func (e *Evaluator) Close() error {
+	return e.storage.Close()
+}
+
+// Equivalent evaluates both queries as range queries over the synthetic
+// data and reports whether they return the same series and values. The
+// reason explains a mismatch.
+func (e *Evaluator) Equivalent(ctx context.Context, expected, actual string) (bool, string, error) {
+	want, err := e.storage.QueryRange(ctx, expected, e.start, e.end, e.step)
+	if err != nil {
+		return false, "", fmt.Errorf("evaluating expected query: %w", err)
+	}
+	if len(want) == 0 {
+		return false, "expected query returns no synthetic data", nil
+	}
+	got, err := e.storage.QueryRange(ctx, actual, e.start, e.end, e.step)
+	if err != nil {
+		return false, "query failed: " + err.Error(), nil
+	}
+	return compareMatrices(want, got)
+}
+
+func compareMatrices(want, got promql.Matrix) (bool, string, error) {
+	if len(want) != len(got) {
+		return false, fmt.Sprintf("%d series, expected %d", len(got), len(want)), nil
+	}
+	index := make(map[string]promql.Series, len(got))
+	for _, s := range got {
+		index[s.Metric.String()] = s
+	}
+	for _, w := range want {
+		g, ok := index[w.Metric.String()]
+		if !ok {
+			return false, "missing series " + w.Metric.String(), nil
+		}
+		if len(w.Floats) != len(g.Floats) || len(w.Histograms) != len(g.Histograms) {
+			return false, "different number of points for " + w.Metric.String(), nil
+		}
+		for i, p := range w.Floats {
+			if p.T != g.Floats[i].T || !floatEqual(p.F, g.Floats[i].F) {
+				return false, fmt.Sprintf("%s: %g, expected %g", w.Metric, g.Floats[i].F, p.F), nil
+			}
+		}
+		for i, p := range w.Histograms {
+			if p.T != g.Histograms[i].T || !p.H.Equals(g.Histograms[i].H) {
+				return false, "different histograms for " + w.Metric.String(), nil
+			}
+		}
+	}
+	return true, "", nil
+}
+
+func floatEqual(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if a == b {
+		return true
+	}
+	return math.Abs(a-b) <= tolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// exactMatch compares queries ignoring surrounding whitespace.
+func exactMatch(expected, actual string) bool {
+	return strings.TrimSpace(expected) == strings.TrimSpace(actual)
+}
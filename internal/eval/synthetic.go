@@ -0,0 +1,179 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSeriesPerMetric caps the label combinations generated for one metric.
+const maxSeriesPerMetric = 64
+
+// SyntheticLoad renders deterministic data for every metric in promql test
+// "load" notation. Series of the same metric grow at different rates, so
+// queries that aggregate, filter or divide differently give different
+// results. Gauges rise and fall; histogram buckets are cumulative.
+func (d *Dataset) SyntheticLoad() string {
+	samples := int(time.Duration(d.Synthetic.Duration) / time.Duration(d.Synthetic.Interval))
+
+	metrics := append([]MetricDef(nil), d.Metrics...)
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "load %s\n", d.Synthetic.Interval)
+	for _, m := range metrics {
+		for k, series := range combinations(m) {
+			fmt.Fprintf(&b, "  %s %s\n", series.selector(m.Name), series.values(m, k, samples))
+		}
+	}
+	if d.Synthetic.Load != "" {
+		b.WriteString(d.Synthetic.Load)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type syntheticSeries struct {
+	labels [][2]string
+	// bucket is the position of the le label among the metric's buckets,
+	// or -1 for other metrics.
+	bucket int
+}
+
+func (s syntheticSeries) selector(name string) string {
+	if len(s.labels) == 0 {
+		return name
+	}
+	parts := make([]string, len(s.labels))
+	for i, l := range s.labels {
+		parts[i] = fmt.Sprintf("%s=%q", l[0], l[1])
+	}
+	return name + "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (s syntheticSeries) values(m MetricDef, k, samples int) string {
+	switch {
+	case len(m.Values) > 0:
+		return m.Values[k%len(m.Values)]
+	case s.bucket >= 0:
+		// Higher buckets count more, so every bucket stays cumulative.
+		h := k/bucketCount(m) + 1
+		return segments(0, []int{h * (s.bucket + 1), 3 * h * (s.bucket + 1), 2 * h * (s.bucket + 1)}, samples)
+	case isCounter(m):
+		step := k%7 + 1
+		return segments(10*(k+1), []int{step, 3 * step, 2 * step}, samples)
+	default:
+		step := k%5 + 1
+		return segments(10*(k+1)+100, []int{step, 2 * step, -3 * step, -step}, samples)
+	}
+}
+
+// segmentLength is the number of samples between slope changes. Changing
+// slopes make windows of different lengths give different rates.
+const segmentLength = 10
+
+// segments renders samples values starting at start, with the slope
+// cycling through slopes every segmentLength samples.
+func segments(start int, slopes []int, samples int) string {
+	var parts []string
+	v := start
+	for i := 0; i < samples; i += segmentLength {
+		n := min(segmentLength, samples-i)
+		slope := slopes[(i/segmentLength)%len(slopes)]
+		sign := "+"
+		if slope < 0 {
+			sign = "-"
+		}
+		parts = append(parts, fmt.Sprintf("%d%s%dx%d", v, sign, abs(slope), n-1))
+		v += slope * n
+	}
+	return strings.Join(parts, " ")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func isCounter(m MetricDef) bool {
+	if m.Type == "counter" {
+		return true
+	}
+	return strings.HasSuffix(m.Name, "_total") || strings.HasSuffix(m.Name, "_count") || strings.HasSuffix(m.Name, "_sum")
+}
+
+func bucketCount(m MetricDef) int {
+	if n := len(m.Labels["le"]); n > 0 && strings.HasSuffix(m.Name, "_bucket") {
+		return n
+	}
+	return 1
+}
+
+// combinations returns every combination of the metric's label values, up
+// to maxSeriesPerMetric. For buckets, le varies fastest so that consecutive
+// series form one histogram.
+func combinations(m MetricDef) []syntheticSeries {
+	names := make([]string, 0, len(m.Labels))
+	for name, values := range m.Labels {
+		if len(values) > 0 && name != "le" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	buckets := sortedBuckets(m)
+	if len(buckets) > 0 {
+		names = append(names, "le")
+	}
+
+	out := []syntheticSeries{{bucket: -1}}
+	for _, name := range names {
+		values := m.Labels[name]
+		if name == "le" {
+			values = buckets
+		}
+		var next []syntheticSeries
+		for _, s := range out {
+			for i, v := range values {
+				labels := append(append([][2]string(nil), s.labels...), [2]string{name, v})
+				bucket := -1
+				if name == "le" {
+					bucket = i
+				}
+				next = append(next, syntheticSeries{labels: labels, bucket: bucket})
+				if len(next) >= maxSeriesPerMetric {
+					break
+				}
+			}
+			if len(next) >= maxSeriesPerMetric {
+				break
+			}
+		}
+		out = next
+	}
+	return out
+}
+
+// sortedBuckets returns the le values of a _bucket metric in numeric
+// order, or nil for other metrics.
+func sortedBuckets(m MetricDef) []string {
+	if !strings.HasSuffix(m.Name, "_bucket") || len(m.Labels["le"]) == 0 {
+		return nil
+	}
+	buckets := append([]string(nil), m.Labels["le"]...)
+	sort.Slice(buckets, func(i, j int) bool { return bucketBound(buckets[i]) < bucketBound(buckets[j]) })
+	return buckets
+}
+
+func bucketBound(le string) float64 {
+	f, err := strconv.ParseFloat(le, 64)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return f
+}
@@ -0,0 +1,257 @@
+// Package grafana builds Grafana dashboard JSON models from generated
+// queries.
+package grafana
+
+import (
+	"github.com/agentkube/txt2promql/internal/chart"
+)
+
+// schemaVersion is the dashboard schema version the model targets.
+const schemaVersion = 39
+
+// DatasourceVariable is the name of the datasource template variable.
+const DatasourceVariable = "datasource"
+
+const (
+	panelWidth   = 12
+	panelHeight  = 8
+	columns      = 24 / panelWidth
+	defaultRange = "now-6h"
+)
+
+// Dashboard is the subset of the Grafana dashboard JSON model needed for
+// importable dashboards.
+type Dashboard struct {
+	UID           string     `json:"uid,omitempty"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Time          TimeRange  `json:"time"`
+	Panels        []Panel    `json:"panels"`
+	Templating    Templating `json:"templating"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []Variable `json:"list"`
+}
+
+// Variable is a dashboard template variable.
+type Variable struct {
+	Name       string      `json:"name"`
+	Label      string      `json:"label,omitempty"`
+	Type       string      `json:"type"`
+	Query      interface{} `json:"query"`
+	Datasource *Datasource `json:"datasource,omitempty"`
+	Refresh    int         `json:"refresh,omitempty"`
+	Multi      bool        `json:"multi,omitempty"`
+	IncludeAll bool        `json:"includeAll,omitempty"`
+	AllValue   string      `json:"allValue,omitempty"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid,omitempty"`
+}
+
+type Panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	GridPos     GridPos      `json:"gridPos"`
+	Datasource  *Datasource  `json:"datasource,omitempty"`
+	Targets     []Target     `json:"targets"`
+	FieldConfig FieldConfig  `json:"fieldConfig"`
+	Options     PanelOptions `json:"options"`
+}
+
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Target struct {
+	RefID        string      `json:"refId"`
+	Expr         string      `json:"expr"`
+	LegendFormat string      `json:"legendFormat,omitempty"`
+	Format       string      `json:"format,omitempty"`
+	Instant      bool        `json:"instant,omitempty"`
+	Datasource   *Datasource `json:"datasource,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults  FieldDefaults `json:"defaults"`
+	Overrides []interface{} `json:"overrides"`
+}
+
+type FieldDefaults struct {
+	Unit   string                 `json:"unit,omitempty"`
+	Custom map[string]interface{} `json:"custom,omitempty"`
+}
+
+type PanelOptions struct {
+	Legend        *Legend `json:"legend,omitempty"`
+	ReduceOptions *Reduce `json:"reduceOptions,omitempty"`
+}
+
+type Legend struct {
+	DisplayMode string `json:"displayMode"`
+	Placement   string `json:"placement"`
+	ShowLegend  bool   `json:"showLegend"`
+}
+
+type Reduce struct {
+	Calcs []string `json:"calcs"`
+}
+
+// PanelSpec describes one query to place on the dashboard.
+type PanelSpec struct {
+	Title       string
+	Description string
+	PromQL      string
+	Suggestion  chart.Suggestion
+}
+
+// Options controls dashboard-wide settings.
+type Options struct {
+	Title string
+	UID   string
+	// DatasourceVariable adds a $datasource variable every panel uses, so
+	// the dashboard can be pointed at any Prometheus datasource.
+	DatasourceVariable bool
+	// DatasourceUID is used when DatasourceVariable is off. Empty selects
+	// Grafana's default datasource.
+	DatasourceUID string
+	// Variables are label variables, such as namespace or job, the panel
+	// queries already filter on. See Templatize.
+	Variables []LabelVariable
+}
+
+// LabelVariable is a query variable listing the values of Label on Metric.
+type LabelVariable struct {
+	Label  string
+	Metric string
+}
+
+// panelTypes maps chart suggestions to Grafana panel plugins.
+var panelTypes = map[string]string{
+	chart.TypeTimeSeries: "timeseries",
+	chart.TypeBar:        "bargauge",
+	chart.TypePie:        "piechart",
+	chart.TypeGauge:      "gauge",
+	chart.TypeTable:      "table",
+	chart.TypeHeatmap:    "heatmap",
+}
+
+// Build lays out one panel per spec, two per row.
+func Build(specs []PanelSpec, opts Options) *Dashboard {
+	d := &Dashboard{
+		UID:           opts.UID,
+		Title:         opts.Title,
+		Tags:          []string{"txt2promql"},
+		Timezone:      "browser",
+		SchemaVersion: schemaVersion,
+		Time:          TimeRange{From: defaultRange, To: "now"},
+		Panels:        []Panel{},
+		Templating:    Templating{List: []Variable{}},
+	}
+	if d.Title == "" {
+		d.Title = "Generated dashboard"
+	}
+
+	ds := &Datasource{Type: "prometheus", UID: opts.DatasourceUID}
+	if opts.DatasourceVariable {
+		ds = &Datasource{Type: "prometheus", UID: "${" + DatasourceVariable + "}"}
+		d.Templating.List = append(d.Templating.List, Variable{
+			Name:  DatasourceVariable,
+			Label: "Datasource",
+			Type:  "datasource",
+			Query: "prometheus",
+		})
+	}
+
+	for _, v := range opts.Variables {
+		d.Templating.List = append(d.Templating.List, Variable{
+			Name:       v.Label,
+			Label:      v.Label,
+			Type:       "query",
+			Datasource: ds,
+			Query: map[string]string{
+				"query": "label_values(" + v.Metric + ", " + v.Label + ")",
+				"refId": "PrometheusVariableQueryEditor-VariableQuery",
+			},
+			// Refresh the values whenever the dashboard loads.
+			Refresh:    1,
+			Multi:      true,
+			IncludeAll: true,
+			AllValue:   ".*",
+		})
+	}
+
+	for i, spec := range specs {
+		d.Panels = append(d.Panels, newPanel(i, spec, ds))
+	}
+	return d
+}
+
+func newPanel(i int, spec PanelSpec, ds *Datasource) Panel {
+	sug := spec.Suggestion
+	panelType, ok := panelTypes[sug.Type]
+	if !ok {
+		panelType = "timeseries"
+	}
+
+	target := Target{
+		RefID:        "A",
+		Expr:         spec.PromQL,
+		LegendFormat: sug.LegendFormat,
+		Datasource:   ds,
+	}
+
+	p := Panel{
+		ID:          i + 1,
+		Type:        panelType,
+		Title:       spec.Title,
+		Description: spec.Description,
+		GridPos: GridPos{
+			H: panelHeight,
+			W: panelWidth,
+			X: (i % columns) * panelWidth,
+			Y: (i / columns) * panelHeight,
+		},
+		Datasource:  ds,
+		FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: sug.Unit}, Overrides: []interface{}{}},
+	}
+
+	switch panelType {
+	case "timeseries":
+		custom := map[string]interface{}{}
+		if sug.Stacked {
+			custom["stacking"] = map[string]string{"mode": "normal"}
+			custom["fillOpacity"] = 20
+		}
+		if sug.LogScale {
+			custom["scaleDistribution"] = map[string]interface{}{"type": "log", "log": 10}
+		}
+		if len(custom) > 0 {
+			p.FieldConfig.Defaults.Custom = custom
+		}
+		p.Options.Legend = &Legend{DisplayMode: "list", Placement: "bottom", ShowLegend: sug.LegendFormat != ""}
+	case "heatmap":
+		target.Format = "heatmap"
+	case "gauge", "bargauge", "piechart", "table":
+		target.Instant = true
+		p.Options.ReduceOptions = &Reduce{Calcs: []string{"lastNotNull"}}
+	}
+
+	p.Targets = []Target{target}
+	return p
+}
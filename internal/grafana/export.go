@@ -0,0 +1,246 @@
+package grafana
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// shapeWindow is the range queried to shape each panel's chart suggestion.
+const shapeWindow = time.Hour
+
+// CommonLabels are the labels offered as template variables, in the order
+// they appear on the dashboard.
+var CommonLabels = []string{"cluster", "namespace", "job", "service", "instance"}
+
+var ErrNoQueries = errors.New("no queries to export")
+
+// Query is a dashboard panel request: either a natural language question or
+// a PromQL expression.
+type Query struct {
+	Question string `json:"question,omitempty"`
+	PromQL   string `json:"promql,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+type ExportOptions struct {
+	Options
+	// TemplateVariables adds variables for the CommonLabels every panel's
+	// metrics carry and filters the panels by them.
+	TemplateVariables bool
+	// Datasource converts and shapes every panel on one datasource. Empty
+	// routes each panel by its metric.
+	Datasource string
+}
+
+// Exporter converts questions and shapes panels against the datasources of
+// a pipeline.
+type Exporter struct {
+	pipeline *agent.Pipeline
+}
+
+func NewExporter(pipeline *agent.Pipeline) *Exporter {
+	return &Exporter{pipeline: pipeline}
+}
+
+// Export builds a dashboard with one panel per query. Questions are
+// converted first; each query is then run over the last hour so the chart
+// suggestion can pick the panel type, unit and legend.
+func (e *Exporter) Export(ctx context.Context, queries []Query, opts ExportOptions) (*Dashboard, error) {
+	if len(queries) == 0 {
+		return nil, ErrNoQueries
+	}
+
+	var metrics map[string]prometheus.MetricSchema
+	if opts.TemplateVariables || hasQuestions(queries) {
+		var err error
+		metrics, err = e.pipeline.Metrics(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", agent.ErrSchemaUnavailable, err)
+		}
+	}
+
+	specs := make([]PanelSpec, 0, len(queries))
+	for _, q := range queries {
+		spec, err := e.panelSpec(ctx, q, opts.Datasource, metrics)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	if opts.TemplateVariables {
+		exprs := make([]string, len(specs))
+		for i, spec := range specs {
+			exprs[i] = spec.PromQL
+		}
+		templated, variables, err := Templatize(exprs, metrics)
+		if err != nil {
+			return nil, err
+		}
+		for i := range specs {
+			specs[i].PromQL = templated[i]
+		}
+		opts.Variables = variables
+	}
+
+	return Build(specs, opts.Options), nil
+}
+
+func (e *Exporter) panelSpec(ctx context.Context, q Query, datasource string, metrics map[string]prometheus.MetricSchema) (PanelSpec, error) {
+	spec := PanelSpec{Title: q.Title, PromQL: q.PromQL}
+
+	if spec.PromQL == "" {
+		if q.Question == "" {
+			return spec, errors.New("each query needs a question or a PromQL expression")
+		}
+		result, err := e.pipeline.Convert(ctx, q.Question, agent.ConvertOptions{
+			Datasource: datasource,
+			Lookback:   shapeWindow,
+		}, nil)
+		if err != nil {
+			return spec, fmt.Errorf("converting %q: %w", q.Question, err)
+		}
+		spec.PromQL = result.PromQL
+		spec.Description = result.Explanation
+		datasource = result.Datasource
+	} else if _, err := parser.ParseExpr(spec.PromQL); err != nil {
+		return spec, fmt.Errorf("invalid PromQL %q: %w", spec.PromQL, err)
+	}
+
+	if spec.Title == "" {
+		spec.Title = q.Question
+	}
+	if spec.Title == "" {
+		spec.Title = spec.PromQL
+	}
+
+	ds, err := e.datasource(ctx, datasource, spec.PromQL)
+	if err != nil {
+		return spec, err
+	}
+	end := time.Now()
+	data, err := ds.Client.QueryRange(ctx, spec.PromQL, end.Add(-shapeWindow), end, chart.DefaultStep(shapeWindow))
+	if err != nil {
+		// Without data the suggestion still derives unit and legend from
+		// the query itself.
+		data = &prometheus.QueryResult{}
+		data.Data.ResultType = prometheus.ResultMatrix
+	}
+	spec.Suggestion = chart.Suggest(spec.PromQL, data, metrics)
+	if spec.Suggestion.Type == chart.TypeTable && len(data.Data.Result) == 0 {
+		spec.Suggestion.Type = chart.TypeTimeSeries
+	}
+	return spec, nil
+}
+
+// datasource returns the named datasource, or the one promQL routes to over
+// the shape window when name is empty.
+func (e *Exporter) datasource(ctx context.Context, name, promQL string) (*prometheus.Datasource, error) {
+	sources := e.pipeline.Datasources()
+	if name == "" {
+		ds, _ := sources.RouteQuery(ctx, promQL, shapeWindow)
+		return ds, nil
+	}
+	return sources.Get(name)
+}
+
+func hasQuestions(queries []Query) bool {
+	for _, q := range queries {
+		if q.PromQL == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Templatize picks the CommonLabels carried by every metric the expressions
+// select and adds a label=~"$label" matcher for each to every selector that
+// does not already filter on it. Variables list values from the first
+// metric.
+func Templatize(exprs []string, metrics map[string]prometheus.MetricSchema) ([]string, []LabelVariable, error) {
+	parsed := make([]parser.Expr, len(exprs))
+	var selected []string
+	for i, expr := range exprs {
+		p, err := parser.ParseExpr(expr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid PromQL %q: %w", expr, err)
+		}
+		parsed[i] = p
+		parser.Inspect(p, func(node parser.Node, _ []parser.Node) error {
+			if vs, ok := node.(*parser.VectorSelector); ok && vs.Name != "" {
+				selected = append(selected, vs.Name)
+			}
+			return nil
+		})
+	}
+	if len(selected) == 0 {
+		return exprs, nil, nil
+	}
+
+	var variables []LabelVariable
+	for _, label := range CommonLabels {
+		if carriedByAll(label, selected, metrics) {
+			variables = append(variables, LabelVariable{Label: label, Metric: selected[0]})
+		}
+	}
+	if len(variables) == 0 {
+		return exprs, nil, nil
+	}
+
+	out := make([]string, len(parsed))
+	for i, p := range parsed {
+		parser.Inspect(p, func(node parser.Node, _ []parser.Node) error {
+			if vs, ok := node.(*parser.VectorSelector); ok {
+				addVariableMatchers(vs, variables)
+			}
+			return nil
+		})
+		out[i] = p.String()
+	}
+	return out, variables, nil
+}
+
+func carriedByAll(label string, selected []string, metrics map[string]prometheus.MetricSchema) bool {
+	for _, name := range selected {
+		schema, ok := metrics[name]
+		if !ok {
+			return false
+		}
+		if _, ok := schema.LabelValues[label]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func addVariableMatchers(vs *parser.VectorSelector, variables []LabelVariable) {
+	filtered := make(map[string]bool)
+	for _, m := range vs.LabelMatchers {
+		filtered[m.Name] = true
+	}
+	for _, v := range variables {
+		if filtered[v.Label] {
+			continue
+		}
+		// "$label" is a valid, if odd, regular expression, so the matcher
+		// can be built normally and Grafana substitutes the variable.
+		m, err := labels.NewMatcher(labels.MatchRegexp, v.Label, "$"+v.Label)
+		if err != nil {
+			continue
+		}
+		vs.LabelMatchers = append(vs.LabelMatchers, m)
+	}
+	sort.SliceStable(vs.LabelMatchers, func(i, j int) bool {
+		// Keep the metric name matcher first, as the parser produces it.
+		return vs.LabelMatchers[i].Name == labels.MetricName && vs.LabelMatchers[j].Name != labels.MetricName
+	})
+}
@@ -4,10 +4,17 @@ package prometheus
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/agentkube/txt2promql/internal/resilience"
+	promconfig "github.com/prometheus/common/config"
 	"github.com/spf13/viper"
 )
 
@@ -16,117 +23,155 @@ type Client struct {
 	httpClient *http.Client
 }
 
-type QueryResult struct {
-	Status string `json:"status"`
-	Data   struct {
-		ResultType string `json:"resultType"`
-		Result     []struct {
-			Metric map[string]string `json:"metric"`
-			Values [][]interface{}   `json:"values,omitempty"` // for range queries
-			Value  []interface{}     `json:"value,omitempty"`  // for instant queries
-		} `json:"result"`
-	} `json:"data"`
+// NewClient returns a client for prometheus.address. It ignores
+// prometheus.http_config; LoadRegistry honours it.
+func NewClient() *Client {
+	return NewClientFor(viper.GetString("prometheus.address"), viper.GetDuration("prometheus.timeout"))
 }
 
-func NewClient() *Client {
+// NewClientFor returns a client for the Prometheus at address.
+func NewClientFor(address string, timeout time.Duration) *Client {
 	return &Client{
-		baseURL: viper.GetString("prometheus.address"),
+		baseURL: address,
 		httpClient: &http.Client{
-			Timeout: viper.GetDuration("prometheus.timeout"),
+			Timeout: timeout,
 		},
 	}
 }
 
-func (c *Client) Query(ctx context.Context, query string) (*QueryResult, error) {
-	url := fmt.Sprintf("%s/api/v1/query", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// NewClientWithConfig returns a client for the Prometheus at address that
+// authenticates and connects as httpConfig describes, which may be nil, and
+// retries failed requests as retry says.
+func NewClientWithConfig(name, address string, timeout time.Duration, httpConfig *promconfig.HTTPClientConfig, retry resilience.Config) (*Client, error) {
+	httpClient, err := newHTTPClient(name, httpConfig, timeout, retry)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, err
 	}
+	return &Client{baseURL: address, httpClient: httpClient}, nil
+}
 
-	q := req.URL.Query()
-	q.Add("query", query)
-	req.URL.RawQuery = q.Encode()
+func (c *Client) Query(ctx context.Context, query string) (*QueryResult, error) {
+	return c.query(ctx, "/api/v1/query", url.Values{"query": {query}})
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
-	}
-	defer resp.Body.Close()
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*QueryResult, error) {
+	return c.query(ctx, "/api/v1/query_range", url.Values{
+		"query": {query},
+		"start": {start.Format(time.RFC3339)},
+		"end":   {end.Format(time.RFC3339)},
+		"step":  {step.String()},
+	})
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// QueryInstant executes an instant query at a specific time
+func (c *Client) QueryInstant(ctx context.Context, query string, timestamp *time.Time) (*QueryResult, error) {
+	params := url.Values{"query": {query}}
+	if timestamp != nil {
+		params.Set("time", timestamp.Format(time.RFC3339))
 	}
+	return c.query(ctx, "/api/v1/query", params)
+}
 
-	var result QueryResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+func (c *Client) query(ctx context.Context, path string, params url.Values) (*QueryResult, error) {
+	resp, err := c.get(ctx, path, params)
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Status: resp.Status, Warnings: resp.Warnings, Infos: resp.Infos}
+	if err := json.Unmarshal(resp.Data, &result.Data); err != nil {
 		return nil, fmt.Errorf("decoding response: %w", err)
 	}
+	return result, nil
+}
 
-	return &result, nil
+// apiResponse is the envelope of every Prometheus API response.
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType ErrorType       `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings"`
+	Infos     []string        `json:"infos"`
 }
 
-func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*QueryResult, error) {
-	url := fmt.Sprintf("%s/api/v1/query_range", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// get calls an API endpoint. Failures are returned as *APIError with the
+// error type and message Prometheus reported.
+func (c *Client) get(ctx context.Context, path string, params url.Values) (*apiResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
-
-	q := req.URL.Query()
-	q.Add("query", query)
-	q.Add("start", start.Format(time.RFC3339))
-	q.Add("end", end.Format(time.RFC3339))
-	q.Add("step", step.String())
-	req.URL.RawQuery = q.Encode()
+	req.URL.RawQuery = params.Encode()
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
+		return nil, transportError(err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, transportError(err)
 	}
 
-	var result QueryResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
+	var result apiResponse
+	if err := json.Unmarshal(body, &result); err != nil || result.Status == "" {
+		if resp.StatusCode == http.StatusOK {
+			if err == nil {
+				return nil, errors.New("decoding response: missing status")
+			}
+			return nil, fmt.Errorf("decoding response: %w", err)
+		}
+		msg := truncate(strings.TrimSpace(string(body)), 200)
+		if msg == "" {
+			msg = resp.Status
+		}
+		return nil, &APIError{Type: errorTypeForStatus(resp.StatusCode), Msg: msg, StatusCode: resp.StatusCode}
+	}
+	if result.Status != "success" || resp.StatusCode != http.StatusOK {
+		typ := result.ErrorType
+		if typ == "" {
+			typ = errorTypeForStatus(resp.StatusCode)
+		}
+		return nil, &APIError{
+			Type:       typ,
+			Msg:        result.Error,
+			StatusCode: resp.StatusCode,
+			Warnings:   result.Warnings,
+			Infos:      result.Infos,
+		}
 	}
-
 	return &result, nil
 }
 
-// QueryInstant executes an instant query at a specific time
-func (c *Client) QueryInstant(ctx context.Context, query string, timestamp *time.Time) (*QueryResult, error) {
-	url := fmt.Sprintf("%s/api/v1/query", c.baseURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-
-	q := req.URL.Query()
-	q.Add("query", query)
-	if timestamp != nil {
-		q.Add("time", timestamp.Format(time.RFC3339))
-	}
-	req.URL.RawQuery = q.Encode()
+// MetricMetadata is the metadata Prometheus reports for a metric family.
+type MetricMetadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
 
-	resp, err := c.httpClient.Do(req)
+// Metadata returns the metadata of every metric family known to Prometheus.
+func (c *Client) Metadata(ctx context.Context) (map[string][]MetricMetadata, error) {
+	resp, err := c.get(ctx, "/api/v1/metadata", nil)
 	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, err
 	}
-
-	var result QueryResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	var metadata map[string][]MetricMetadata
+	if err := json.Unmarshal(resp.Data, &metadata); err != nil {
 		return nil, fmt.Errorf("decoding response: %w", err)
 	}
+	return metadata, nil
+}
 
-	return &result, nil
+// truncate shortens s to at most n bytes without splitting a character,
+// marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
 }
@@ -0,0 +1,348 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/decode"
+	"github.com/agentkube/txt2promql/internal/resilience"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/spf13/viper"
+)
+
+// DefaultDatasource names the datasource built from prometheus.address when
+// no datasources are configured.
+const DefaultDatasource = "default"
+
+var ErrUnknownDatasource = errors.New("unknown datasource")
+
+// DatasourceConfig is one entry of prometheus.datasources.
+type DatasourceConfig struct {
+	Name    string        `mapstructure:"name"`
+	Address string        `mapstructure:"address"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Retention is how far back the datasource keeps data, such as "15d".
+	// Empty means unlimited.
+	Retention string `mapstructure:"retention"`
+	// LongTerm marks storage such as Thanos that queries reaching beyond
+	// the retention of the others are routed to.
+	LongTerm bool `mapstructure:"long_term"`
+	// Default marks the datasource used when routing finds no better one.
+	// Defaults to the first.
+	Default bool `mapstructure:"default"`
+	// HTTPConfig sets authentication, TLS, proxy and headers, with the
+	// keys of Prometheus' http_config.
+	HTTPConfig *promconfig.HTTPClientConfig `mapstructure:"http_config"`
+	// Resilience tunes retries and the circuit breaker.
+	Resilience resilience.Config `mapstructure:"resilience"`
+}
+
+// Datasource is a Prometheus-compatible server with its own schema cache.
+type Datasource struct {
+	Name      string
+	Address   string
+	Client    *Client
+	Schema    *SchemaManager
+	Retention time.Duration
+	LongTerm  bool
+}
+
+// Covers reports whether the datasource still holds data lookback ago.
+func (d *Datasource) Covers(lookback time.Duration) bool {
+	return d.Retention == 0 || lookback <= d.Retention
+}
+
+// Registry holds the configured datasources, in configuration order.
+type Registry struct {
+	datasources []*Datasource
+	byName      map[string]*Datasource
+	def         *Datasource
+}
+
+// NewRegistry builds datasources from configs.
+func NewRegistry(configs []DatasourceConfig) (*Registry, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no datasources configured")
+	}
+	r := &Registry{byName: make(map[string]*Datasource, len(configs))}
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("datasource %d has no name", i+1)
+		}
+		if _, ok := r.byName[cfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate datasource %q", cfg.Name)
+		}
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("datasource %s has no address", cfg.Name)
+		}
+		var retention time.Duration
+		if cfg.Retention != "" {
+			d, err := model.ParseDuration(cfg.Retention)
+			if err != nil {
+				return nil, fmt.Errorf("datasource %s: invalid retention: %w", cfg.Name, err)
+			}
+			retention = time.Duration(d)
+		}
+
+		client, err := NewClientWithConfig(cfg.Name, cfg.Address, cfg.Timeout, cfg.HTTPConfig, cfg.Resilience)
+		if err != nil {
+			return nil, fmt.Errorf("datasource %s: %w", cfg.Name, err)
+		}
+		ds := &Datasource{
+			Name:      cfg.Name,
+			Address:   cfg.Address,
+			Client:    client,
+			Schema:    NewSchemaManager(client),
+			Retention: retention,
+			LongTerm:  cfg.LongTerm,
+		}
+		r.datasources = append(r.datasources, ds)
+		r.byName[ds.Name] = ds
+		if cfg.Default {
+			if r.def != nil {
+				return nil, fmt.Errorf("datasources %s and %s are both marked default", r.def.Name, ds.Name)
+			}
+			r.def = ds
+		}
+	}
+	if r.def == nil {
+		r.def = r.datasources[0]
+	}
+	return r, nil
+}
+
+// SingleRegistry wraps one client as the default datasource.
+func SingleRegistry(client *Client) *Registry {
+	ds := &Datasource{Name: DefaultDatasource, Address: client.baseURL, Client: client, Schema: NewSchemaManager(client)}
+	return &Registry{
+		datasources: []*Datasource{ds},
+		byName:      map[string]*Datasource{ds.Name: ds},
+		def:         ds,
+	}
+}
+
+// LoadRegistry builds the registry from prometheus.datasources, or from
+// prometheus.address and prometheus.http_config when none are listed.
+// Relative file paths in http_config are resolved against the directory of
+// the configuration file.
+func LoadRegistry() (*Registry, error) {
+	var configs []DatasourceConfig
+	if err := decode.UnmarshalKey("prometheus.datasources", &configs); err != nil {
+		return nil, fmt.Errorf("loading datasources: %w", err)
+	}
+	if len(configs) == 0 {
+		var httpConfig *promconfig.HTTPClientConfig
+		if err := decode.UnmarshalKey("prometheus.http_config", &httpConfig); err != nil {
+			return nil, fmt.Errorf("loading prometheus.http_config: %w", err)
+		}
+		httpConfig.SetDirectory(configDir())
+		var retry resilience.Config
+		if err := decode.UnmarshalKey("prometheus.resilience", &retry); err != nil {
+			return nil, fmt.Errorf("loading prometheus.resilience: %w", err)
+		}
+		client, err := NewClientWithConfig(DefaultDatasource, viper.GetString("prometheus.address"), viper.GetDuration("prometheus.timeout"), httpConfig, retry)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus.http_config: %w", err)
+		}
+		return SingleRegistry(client), nil
+	}
+	for i := range configs {
+		if configs[i].Timeout == 0 {
+			configs[i].Timeout = viper.GetDuration("prometheus.timeout")
+		}
+		configs[i].HTTPConfig.SetDirectory(configDir())
+	}
+	return NewRegistry(configs)
+}
+
+// Get returns the named datasource, or the default one for an empty name.
+func (r *Registry) Get(name string) (*Datasource, error) {
+	if name == "" {
+		return r.def, nil
+	}
+	ds, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDatasource, name)
+	}
+	return ds, nil
+}
+
+func (r *Registry) Default() *Datasource {
+	return r.def
+}
+
+// List returns the datasources in configuration order.
+func (r *Registry) List() []*Datasource {
+	return append([]*Datasource(nil), r.datasources...)
+}
+
+// Metrics merges the schemas of every datasource. Datasources that cannot
+// be reached are left out; it fails only when none can.
+func (r *Registry) Metrics(ctx context.Context) (map[string]MetricSchema, error) {
+	if len(r.datasources) == 1 {
+		return r.def.Schema.Metrics(ctx)
+	}
+
+	merged := make(map[string]MetricSchema)
+	var firstErr error
+	reached := 0
+	for _, ds := range r.datasources {
+		metrics, err := ds.Schema.Metrics(ctx)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("datasource %s: %w", ds.Name, err)
+			}
+			continue
+		}
+		reached++
+		for name, schema := range metrics {
+			if existing, ok := merged[name]; ok {
+				schema = mergeSchema(existing, schema)
+			}
+			merged[name] = schema
+		}
+	}
+	if reached == 0 {
+		return nil, firstErr
+	}
+	return merged, nil
+}
+
+// mergeSchema combines the schema of a metric found on two datasources. The
+// first one seen keeps its type and help.
+func mergeSchema(a, b MetricSchema) MetricSchema {
+	out := a
+	out.Series = a.Series + b.Series
+	out.LabelValues = make(map[string][]string, len(a.LabelValues))
+	for label, values := range a.LabelValues {
+		out.LabelValues[label] = values
+	}
+	for label, values := range b.LabelValues {
+		seen := make(map[string]bool)
+		var union []string
+		for _, v := range append(append([]string(nil), out.LabelValues[label]...), values...) {
+			if !seen[v] {
+				seen[v] = true
+				union = append(union, v)
+			}
+		}
+		sort.Strings(union)
+		out.LabelValues[label] = union
+	}
+	if out.Help == "" {
+		out.Help = b.Help
+	}
+	if out.Unit == "" {
+		out.Unit = b.Unit
+	}
+	return out
+}
+
+// Route picks the datasource for a query on metric that reaches lookback
+// into the past:
+//
+//   - when lookback is beyond the retention of every datasource that has
+//     the metric, long-term storage, preferring one that has the metric;
+//   - otherwise the first datasource whose schema has the metric, the
+//     default one first;
+//   - otherwise the default datasource.
+//
+// The reason explains the choice.
+func (r *Registry) Route(ctx context.Context, metric string, lookback time.Duration) (*Datasource, string) {
+	if len(r.datasources) == 1 {
+		return r.def, "only datasource"
+	}
+
+	var having []*Datasource
+	for _, ds := range r.ordered() {
+		if metric == "" {
+			break
+		}
+		metrics, err := ds.Schema.Metrics(ctx)
+		if err != nil {
+			continue
+		}
+		if _, ok := metrics[metric]; ok {
+			having = append(having, ds)
+		}
+	}
+
+	if lookback > 0 {
+		covered := false
+		for _, ds := range having {
+			if ds.Covers(lookback) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			if ds := longTerm(having, lookback); ds != nil {
+				return ds, fmt.Sprintf("%s is beyond local retention", model.Duration(lookback))
+			}
+			if ds := longTerm(r.datasources, lookback); ds != nil {
+				return ds, fmt.Sprintf("%s is beyond local retention", model.Duration(lookback))
+			}
+		}
+	}
+
+	for _, ds := range having {
+		if ds.Covers(lookback) {
+			return ds, fmt.Sprintf("has metric %s", metric)
+		}
+	}
+	if len(having) > 0 {
+		return having[0], fmt.Sprintf("has metric %s", metric)
+	}
+	return r.def, "default datasource"
+}
+
+// RouteQuery routes a PromQL query by the first metric it selects. The
+// lookback is extended by the longest range and offset in the query.
+func (r *Registry) RouteQuery(ctx context.Context, query string, lookback time.Duration) (*Datasource, string) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return r.def, "default datasource"
+	}
+	metric := ""
+	var reach time.Duration
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			if metric == "" {
+				metric = n.Name
+			}
+			reach = max(reach, n.OriginalOffset)
+		case *parser.MatrixSelector:
+			if vs, ok := n.VectorSelector.(*parser.VectorSelector); ok {
+				reach = max(reach, n.Range+vs.OriginalOffset)
+			}
+		}
+		return nil
+	})
+	return r.Route(ctx, metric, lookback+reach)
+}
+
+// ordered lists the default datasource first, then the rest in order.
+func (r *Registry) ordered() []*Datasource {
+	out := []*Datasource{r.def}
+	for _, ds := range r.datasources {
+		if ds != r.def {
+			out = append(out, ds)
+		}
+	}
+	return out
+}
+
+func longTerm(datasources []*Datasource, lookback time.Duration) *Datasource {
+	for _, ds := range datasources {
+		if ds.LongTerm && ds.Covers(lookback) {
+			return ds
+		}
+	}
+	return nil
+}
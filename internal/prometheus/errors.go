@@ -0,0 +1,102 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorType is the errorType of a Prometheus API error response.
+type ErrorType string
+
+const (
+	ErrBadData     ErrorType = "bad_data"
+	ErrTimeout     ErrorType = "timeout"
+	ErrCanceled    ErrorType = "canceled"
+	ErrExecution   ErrorType = "execution"
+	ErrInternal    ErrorType = "internal"
+	ErrUnavailable ErrorType = "unavailable"
+	ErrNotFound    ErrorType = "not_found"
+)
+
+// APIError is a failed Prometheus API call: an error response, or a server
+// that could not be reached or answered with something else than the API.
+type APIError struct {
+	Type ErrorType `json:"errorType"`
+	Msg  string    `json:"error"`
+	// StatusCode is the HTTP status Prometheus answered with, zero when it
+	// was not reached.
+	StatusCode int      `json:"-"`
+	Warnings   []string `json:"warnings,omitempty"`
+	Infos      []string `json:"infos,omitempty"`
+	// Err is the transport error when Prometheus was not reached.
+	Err error `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Msg)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// QueryError reports whether the query itself is at fault, so that
+// rewriting it may help, as opposed to Prometheus failing to answer.
+func (e *APIError) QueryError() bool {
+	return e.Type == ErrBadData || e.Type == ErrExecution
+}
+
+// HTTPStatus is the status a handler should answer with when a Prometheus
+// call it depends on failed with err.
+func HTTPStatus(err error) int {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return http.StatusInternalServerError
+	}
+	switch apiErr.Type {
+	case ErrBadData:
+		return http.StatusBadRequest
+	case ErrExecution:
+		return http.StatusUnprocessableEntity
+	case ErrTimeout:
+		return http.StatusGatewayTimeout
+	case ErrCanceled, ErrUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// errorTypeForStatus guesses the error type of a response without an error
+// envelope, such as one from a proxy in front of Prometheus.
+func errorTypeForStatus(code int) ErrorType {
+	switch {
+	case code == http.StatusBadRequest:
+		return ErrBadData
+	case code == http.StatusUnprocessableEntity:
+		return ErrExecution
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case code == http.StatusServiceUnavailable, code == http.StatusBadGateway, code == http.StatusTooManyRequests:
+		return ErrUnavailable
+	default:
+		return ErrInternal
+	}
+}
+
+// transportError wraps a failed request: timeouts and cancellations keep
+// their type, anything else means Prometheus is unavailable.
+func transportError(err error) *APIError {
+	typ := ErrUnavailable
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		typ = ErrTimeout
+	case errors.Is(err, context.Canceled):
+		typ = ErrCanceled
+	}
+	return &APIError{Type: typ, Msg: err.Error(), Err: err}
+}
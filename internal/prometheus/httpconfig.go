@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/resilience"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/spf13/viper"
+)
+
+// newHTTPClient builds the HTTP client of a datasource. Credentials and
+// certificates read from files are re-read as the files change, so rotated
+// tokens are picked up without a restart. Requests are retried and circuit
+// broken as retry says; timeout bounds all attempts together.
+func newHTTPClient(name string, cfg *promconfig.HTTPClientConfig, timeout time.Duration, retry resilience.Config) (*http.Client, error) {
+	client := &http.Client{}
+	if cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		var err error
+		client, err = promconfig.NewClientFromConfig(*cfg, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client.Transport = resilience.NewTransport(UpstreamName(name), retry, client.Transport)
+	client.Timeout = timeout
+	return client, nil
+}
+
+// UpstreamName is the name the resilience layer reports a datasource under.
+func UpstreamName(datasource string) string {
+	return "prometheus/" + datasource
+}
+
+// configDir is the directory relative file paths in http_config are
+// resolved against: that of the configuration file, like Prometheus does.
+func configDir() string {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return filepath.Dir(file)
+	}
+	return ""
+}
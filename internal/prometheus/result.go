@@ -0,0 +1,370 @@
+package prometheus
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Result types of the query API.
+const (
+	ResultVector = "vector"
+	ResultMatrix = "matrix"
+	ResultScalar = "scalar"
+	ResultString = "string"
+)
+
+// QueryResult is a decoded query or query_range response. It marshals back
+// to the JSON Prometheus sent.
+type QueryResult struct {
+	Status string     `json:"status"`
+	Data   ResultData `json:"data"`
+	// Warnings and Infos are the annotations Prometheus attached to the
+	// result, such as a rate over a metric that is not a counter.
+	Warnings []string `json:"warnings,omitempty"`
+	Infos    []string `json:"infos,omitempty"`
+}
+
+// ResultData holds the result of one of the four result types: vector and
+// matrix results fill Result, scalar results Scalar and string results
+// String.
+type ResultData struct {
+	ResultType string
+	Result     []SampleStream
+	Scalar     *Sample
+	String     *StringSample
+}
+
+// SampleStream is one series of a vector or matrix result. Vector results
+// set Value or Histogram, matrix results Values and Histograms.
+type SampleStream struct {
+	Metric     map[string]string `json:"metric"`
+	Values     []Sample          `json:"values,omitempty"`
+	Histograms []HistogramSample `json:"histograms,omitempty"`
+	Value      *Sample           `json:"value,omitempty"`
+	Histogram  *HistogramSample  `json:"histogram,omitempty"`
+}
+
+// Sample is a single float value of a result. Value may be NaN or
+// infinite.
+type Sample struct {
+	At    time.Time
+	Value float64
+}
+
+// Finite reports whether the value is neither NaN nor infinite.
+func (s Sample) Finite() bool {
+	return !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0)
+}
+
+// StringSample is the value of a string result.
+type StringSample struct {
+	At    time.Time
+	Value string
+}
+
+// HistogramSample is a single native histogram value of a result.
+type HistogramSample struct {
+	At        time.Time
+	Histogram Histogram
+}
+
+// Histogram is a native histogram with its populated buckets.
+type Histogram struct {
+	Count   float64           `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets []HistogramBucket `json:"buckets,omitempty"`
+}
+
+// HistogramBucket is one bucket of a native histogram. Boundaries tells
+// which ends are inclusive, as in the API: 0 upper only, 1 lower only,
+// 2 neither, 3 both.
+type HistogramBucket struct {
+	Boundaries int     `json:"boundaries"`
+	Lower      float64 `json:"lower"`
+	Upper      float64 `json:"upper"`
+	Count      float64 `json:"count"`
+}
+
+// FormatValue renders a sample value the way Prometheus does, including
+// NaN, +Inf and -Inf.
+func FormatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Series decodes the samples of a vector, matrix or scalar result. NaN and
+// infinite samples are skipped, and series without any finite sample are
+// left out, as are native histograms.
+func (r *QueryResult) Series() []Series {
+	var out []Series
+	if r.Data.Scalar != nil && r.Data.Scalar.Finite() {
+		out = append(out, Series{Name: SeriesName(nil), Labels: map[string]string{}, Samples: []Sample{*r.Data.Scalar}})
+	}
+	for _, series := range r.Data.Result {
+		var samples []Sample
+		for _, s := range series.samples() {
+			if s.Finite() {
+				samples = append(samples, s)
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		out = append(out, Series{Name: SeriesName(series.Metric), Labels: series.Metric, Samples: samples})
+	}
+	return out
+}
+
+// HasHistograms reports whether any series holds native histograms.
+func (r *QueryResult) HasHistograms() bool {
+	for _, s := range r.Data.Result {
+		if s.Histogram != nil || len(s.Histograms) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s SampleStream) samples() []Sample {
+	if s.Value != nil {
+		return []Sample{*s.Value}
+	}
+	return s.Values
+}
+
+// Table lays the result out with one row per sample: the label names of
+// every series, then timestamp and value. Unlike Series it keeps NaN and
+// infinite values; native histograms show their count and sum.
+func (r *QueryResult) Table() (columns []string, rows [][]string) {
+	labelSet := make(map[string]bool)
+	for _, s := range r.Data.Result {
+		for k := range s.Metric {
+			labelSet[k] = true
+		}
+	}
+	labels := make([]string, 0, len(labelSet))
+	for k := range labelSet {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	columns = append(labels, "timestamp", "value")
+
+	row := func(metric map[string]string, at time.Time, value string) []string {
+		out := make([]string, 0, len(columns))
+		for _, l := range labels {
+			out = append(out, metric[l])
+		}
+		return append(out, at.Format(time.RFC3339), value)
+	}
+
+	switch {
+	case r.Data.Scalar != nil:
+		rows = append(rows, row(nil, r.Data.Scalar.At, FormatValue(r.Data.Scalar.Value)))
+	case r.Data.String != nil:
+		rows = append(rows, row(nil, r.Data.String.At, r.Data.String.Value))
+	}
+	for _, s := range r.Data.Result {
+		for _, sample := range s.samples() {
+			rows = append(rows, row(s.Metric, sample.At, FormatValue(sample.Value)))
+		}
+		histograms := s.Histograms
+		if s.Histogram != nil {
+			histograms = []HistogramSample{*s.Histogram}
+		}
+		for _, h := range histograms {
+			rows = append(rows, row(s.Metric, h.At, fmt.Sprintf("count=%s sum=%s", FormatValue(h.Histogram.Count), FormatValue(h.Histogram.Sum))))
+		}
+	}
+	return columns, rows
+}
+
+// WriteCSV writes the result as CSV, laid out as Table.
+func (r *QueryResult) WriteCSV(w io.Writer) error {
+	columns, rows := r.Table()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func (d ResultData) MarshalJSON() ([]byte, error) {
+	var result interface{} = d.Result
+	switch {
+	case d.Scalar != nil:
+		result = d.Scalar
+	case d.String != nil:
+		result = d.String
+	case d.Result == nil:
+		result = []SampleStream{}
+	}
+	return json.Marshal(struct {
+		ResultType string      `json:"resultType"`
+		Result     interface{} `json:"result"`
+	}{d.ResultType, result})
+}
+
+func (d *ResultData) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*d = ResultData{ResultType: raw.ResultType}
+	if len(raw.Result) == 0 || string(raw.Result) == "null" {
+		return nil
+	}
+	switch raw.ResultType {
+	case ResultScalar:
+		d.Scalar = new(Sample)
+		return json.Unmarshal(raw.Result, d.Scalar)
+	case ResultString:
+		d.String = new(StringSample)
+		return json.Unmarshal(raw.Result, d.String)
+	default:
+		return json.Unmarshal(raw.Result, &d.Result)
+	}
+}
+
+// Samples travel as [timestamp, "value"] pairs, with the timestamp in
+// seconds and the value as a string so that NaN and infinities survive.
+
+func (s Sample) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{json.Number(formatTimestamp(s.At)), FormatValue(s.Value)})
+}
+
+func (s *Sample) UnmarshalJSON(b []byte) error {
+	var value string
+	at, err := unmarshalPair(b, &value)
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sample value %q", value)
+	}
+	*s = Sample{At: at, Value: v}
+	return nil
+}
+
+func (s StringSample) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{json.Number(formatTimestamp(s.At)), s.Value})
+}
+
+func (s *StringSample) UnmarshalJSON(b []byte) error {
+	var value string
+	at, err := unmarshalPair(b, &value)
+	if err != nil {
+		return err
+	}
+	*s = StringSample{At: at, Value: value}
+	return nil
+}
+
+func (h HistogramSample) MarshalJSON() ([]byte, error) {
+	buckets := make([][]interface{}, 0, len(h.Histogram.Buckets))
+	for _, b := range h.Histogram.Buckets {
+		buckets = append(buckets, []interface{}{b.Boundaries, FormatValue(b.Lower), FormatValue(b.Upper), FormatValue(b.Count)})
+	}
+	return json.Marshal([]interface{}{
+		json.Number(formatTimestamp(h.At)),
+		map[string]interface{}{
+			"count":   FormatValue(h.Histogram.Count),
+			"sum":     FormatValue(h.Histogram.Sum),
+			"buckets": buckets,
+		},
+	})
+}
+
+func (h *HistogramSample) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Count   string              `json:"count"`
+		Sum     string              `json:"sum"`
+		Buckets [][]json.RawMessage `json:"buckets"`
+	}
+	at, err := unmarshalPair(b, &raw)
+	if err != nil {
+		return err
+	}
+	hist := Histogram{}
+	if hist.Count, err = parseValue(raw.Count); err != nil {
+		return err
+	}
+	if hist.Sum, err = parseValue(raw.Sum); err != nil {
+		return err
+	}
+	for _, rb := range raw.Buckets {
+		if len(rb) != 4 {
+			return fmt.Errorf("invalid histogram bucket of %d fields", len(rb))
+		}
+		var bucket HistogramBucket
+		var lower, upper, count string
+		for i, dst := range []interface{}{&bucket.Boundaries, &lower, &upper, &count} {
+			if err := json.Unmarshal(rb[i], dst); err != nil {
+				return fmt.Errorf("invalid histogram bucket: %w", err)
+			}
+		}
+		if bucket.Lower, err = parseValue(lower); err != nil {
+			return err
+		}
+		if bucket.Upper, err = parseValue(upper); err != nil {
+			return err
+		}
+		if bucket.Count, err = parseValue(count); err != nil {
+			return err
+		}
+		hist.Buckets = append(hist.Buckets, bucket)
+	}
+	*h = HistogramSample{At: at, Histogram: hist}
+	return nil
+}
+
+// unmarshalPair decodes a [timestamp, value] pair, the value into v.
+func unmarshalPair(b []byte, v interface{}) (time.Time, error) {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return time.Time{}, err
+	}
+	if len(pair) != 2 {
+		return time.Time{}, fmt.Errorf("expected [timestamp, value], got %d elements", len(pair))
+	}
+	var ts float64
+	if err := json.Unmarshal(pair[0], &ts); err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if err := json.Unmarshal(pair[1], v); err != nil {
+		return time.Time{}, fmt.Errorf("invalid value: %w", err)
+	}
+	// Prometheus timestamps have millisecond precision.
+	return time.UnixMilli(int64(math.Round(ts * 1000))).UTC(), nil
+}
+
+func parseValue(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
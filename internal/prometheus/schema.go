@@ -4,26 +4,45 @@ package prometheus
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// defaultSchemaTTL is how long a discovered schema is reused before
+// SchemaManager queries Prometheus again.
+const defaultSchemaTTL = 5 * time.Minute
+
 type MetricSchema struct {
 	Name       string            `json:"name"`
 	Type       string            `json:"type"` // counter, gauge, histogram
 	Help       string            `json:"help"`
+	Unit       string            `json:"unit,omitempty"`
 	Labels     map[string]string `json:"labels"`
 	LastScrape time.Time         `json:"last_scrape"`
+	// LabelValues holds every value seen for each label across all series
+	// of the metric, sorted.
+	LabelValues map[string][]string `json:"label_values,omitempty"`
+	// Series is the number of series of the metric seen at discovery.
+	Series int `json:"series,omitempty"`
 }
 
 type SchemaManager struct {
-	client *Client
-	cache  map[string]MetricSchema
+	client      *Client
+	cache       map[string]MetricSchema
+	ttl         time.Duration
+	lastRefresh time.Time
+	// pinned schemas are never refreshed from Prometheus.
+	pinned bool
+	mu     sync.RWMutex
 }
 
 func NewSchemaManager(client *Client) *SchemaManager {
 	return &SchemaManager{
 		client: client,
 		cache:  make(map[string]MetricSchema),
+		ttl:    defaultSchemaTTL,
 	}
 }
 
@@ -33,14 +52,135 @@ func (sm *SchemaManager) RefreshMetrics(ctx context.Context) error {
 		return fmt.Errorf("querying metrics: %w", err)
 	}
 
+	cache := make(map[string]MetricSchema)
+	seen := make(map[string]map[string]map[string]struct{})
+	series := make(map[string]int)
 	for _, metric := range result.Data.Result {
-		name := metric.Metric["__name__"]
-		sm.cache[name] = MetricSchema{
+		name, ok := metric.Metric["__name__"]
+		if !ok {
+			continue
+		}
+		series[name]++
+		cache[name] = MetricSchema{
 			Name:       name,
 			Labels:     metric.Metric,
 			LastScrape: time.Now(),
 		}
+
+		if seen[name] == nil {
+			seen[name] = make(map[string]map[string]struct{})
+		}
+		for label, value := range metric.Metric {
+			if label == "__name__" {
+				continue
+			}
+			if seen[name][label] == nil {
+				seen[name][label] = make(map[string]struct{})
+			}
+			seen[name][label][value] = struct{}{}
+		}
 	}
 
+	// Metadata is best effort: older Prometheus versions and some
+	// compatible backends do not implement the endpoint.
+	metadata, _ := sm.client.Metadata(ctx)
+
+	for name, labels := range seen {
+		schema := cache[name]
+		schema.Type = InferMetricType(name)
+		schema.Series = series[name]
+		if family, ok := metadata[metricFamily(name)]; ok && len(family) > 0 {
+			schema.Help = family[0].Help
+			schema.Unit = family[0].Unit
+			if t := seriesType(name, family[0].Type); t != "" {
+				schema.Type = t
+			}
+		}
+		schema.LabelValues = make(map[string][]string, len(labels))
+		for label, values := range labels {
+			list := make([]string, 0, len(values))
+			for value := range values {
+				list = append(list, value)
+			}
+			sort.Strings(list)
+			schema.LabelValues[label] = list
+		}
+		cache[name] = schema
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.cache = cache
+	sm.lastRefresh = time.Now()
+
 	return nil
 }
+
+// Metrics returns the cached schema, refreshing it first when it is older
+// than the cache TTL.
+func (sm *SchemaManager) Metrics(ctx context.Context) (map[string]MetricSchema, error) {
+	sm.mu.RLock()
+	fresh := sm.pinned || time.Since(sm.lastRefresh) < sm.ttl
+	sm.mu.RUnlock()
+
+	if !fresh {
+		if err := sm.RefreshMetrics(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.cache, nil
+}
+
+// Pin replaces the cache with metrics and stops refreshing it, so
+// conversions run against a fixed schema.
+func (sm *SchemaManager) Pin(metrics map[string]MetricSchema) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.cache = metrics
+	sm.pinned = true
+	sm.lastRefresh = time.Now()
+}
+
+// InferMetricType guesses a metric's type from the Prometheus naming
+// conventions when no metadata is available.
+func InferMetricType(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_bucket"):
+		return "histogram"
+	case strings.HasSuffix(name, "_total"),
+		strings.HasSuffix(name, "_count"),
+		strings.HasSuffix(name, "_sum"):
+		return "counter"
+	default:
+		return "gauge"
+	}
+}
+
+// seriesType maps the type metadata reports for a family onto one of its
+// series. Histograms and summaries expose _sum and _count as plain counters;
+// only the buckets (or the quantiles of a summary) carry the family type.
+func seriesType(name, familyType string) string {
+	switch familyType {
+	case "", "unknown":
+		return ""
+	case "histogram", "gaugehistogram", "summary":
+		if strings.HasSuffix(name, "_sum") || strings.HasSuffix(name, "_count") {
+			return "counter"
+		}
+	}
+	return familyType
+}
+
+// metricFamily strips the series suffixes histograms and summaries add to
+// their family name.
+func metricFamily(name string) string {
+	for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
@@ -0,0 +1,334 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotVersion is the version of the snapshot format written by this
+// build. Loading accepts every version up to it.
+const SnapshotVersion = 1
+
+// DefaultSnapshotValues is how many values of each label a snapshot keeps.
+const DefaultSnapshotValues = 50
+
+var ErrSnapshotVersion = errors.New("unsupported schema snapshot version")
+
+// Snapshot is a discovered schema saved to a file, so conversions can run
+// where Prometheus cannot be reached.
+type Snapshot struct {
+	Version   int              `json:"version" yaml:"version"`
+	CreatedAt time.Time        `json:"created_at" yaml:"created_at"`
+	Source    string           `json:"source,omitempty" yaml:"source,omitempty"`
+	Metrics   []SnapshotMetric `json:"metrics" yaml:"metrics"`
+}
+
+// SnapshotMetric is one metric of a snapshot.
+type SnapshotMetric struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+	Help string `json:"help,omitempty" yaml:"help,omitempty"`
+	Unit string `json:"unit,omitempty" yaml:"unit,omitempty"`
+	// Series is the number of series of the metric at export.
+	Series int             `json:"series" yaml:"series"`
+	Labels []SnapshotLabel `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// SnapshotLabel is a label of a snapshot metric. Values is a sample of at
+// most the export's value limit; Cardinality counts all of them.
+type SnapshotLabel struct {
+	Name        string   `json:"name" yaml:"name"`
+	Cardinality int      `json:"cardinality" yaml:"cardinality"`
+	Values      []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// NewSnapshot captures metrics, keeping at most maxValues values per label.
+// A maxValues of zero or less keeps DefaultSnapshotValues.
+func NewSnapshot(metrics map[string]MetricSchema, source string, maxValues int) *Snapshot {
+	if maxValues <= 0 {
+		maxValues = DefaultSnapshotValues
+	}
+	s := &Snapshot{Version: SnapshotVersion, CreatedAt: time.Now().UTC(), Source: source}
+	for _, name := range sortedNames(metrics) {
+		schema := metrics[name]
+		m := SnapshotMetric{
+			Name:   name,
+			Type:   schema.Type,
+			Help:   schema.Help,
+			Unit:   schema.Unit,
+			Series: schema.Series,
+		}
+		labels := make([]string, 0, len(schema.LabelValues))
+		for label := range schema.LabelValues {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			values := schema.LabelValues[label]
+			m.Labels = append(m.Labels, SnapshotLabel{
+				Name:        label,
+				Cardinality: len(values),
+				Values:      append([]string(nil), values[:min(len(values), maxValues)]...),
+			})
+		}
+		s.Metrics = append(s.Metrics, m)
+	}
+	return s
+}
+
+func sortedNames(metrics map[string]MetricSchema) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Schema returns the snapshot in the form discovery produces.
+func (s *Snapshot) Schema() map[string]MetricSchema {
+	out := make(map[string]MetricSchema, len(s.Metrics))
+	for _, m := range s.Metrics {
+		schema := MetricSchema{
+			Name:        m.Name,
+			Type:        m.Type,
+			Help:        m.Help,
+			Unit:        m.Unit,
+			Series:      m.Series,
+			Labels:      map[string]string{"__name__": m.Name},
+			LastScrape:  s.CreatedAt,
+			LabelValues: make(map[string][]string, len(m.Labels)),
+		}
+		if schema.Type == "" {
+			schema.Type = InferMetricType(m.Name)
+		}
+		for _, l := range m.Labels {
+			schema.LabelValues[l.Name] = append([]string(nil), l.Values...)
+			if len(l.Values) > 0 {
+				schema.Labels[l.Name] = l.Values[0]
+			}
+		}
+		out[m.Name] = schema
+	}
+	return out
+}
+
+// Encode writes the snapshot as json or yaml.
+func (s *Snapshot) Encode(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown snapshot format %q (want json or yaml)", format)
+	}
+}
+
+// SnapshotFormat picks the format of a snapshot file from its extension.
+func SnapshotFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// LoadSnapshot reads a JSON or YAML snapshot file.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseSnapshot(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseSnapshot decodes a snapshot in either format.
+func ParseSnapshot(content []byte) (*Snapshot, error) {
+	var s Snapshot
+	var err error
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(content, &s)
+	} else {
+		err = yaml.Unmarshal(content, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema snapshot: %w", err)
+	}
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("%w: %d (this build reads up to %d)", ErrSnapshotVersion, s.Version, SnapshotVersion)
+	}
+	return &s, nil
+}
+
+// SnapshotDiff is what changed between two snapshots.
+type SnapshotDiff struct {
+	Added   []string     `json:"added,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Changed []MetricDiff `json:"changed,omitempty"`
+}
+
+// MetricDiff is how a metric present in both snapshots changed. Unchanged
+// fields are left empty.
+type MetricDiff struct {
+	Name          string               `json:"name"`
+	Type          *StringChange        `json:"type,omitempty"`
+	Unit          *StringChange        `json:"unit,omitempty"`
+	Series        *IntChange           `json:"series,omitempty"`
+	AddedLabels   []string             `json:"added_labels,omitempty"`
+	RemovedLabels []string             `json:"removed_labels,omitempty"`
+	Cardinality   map[string]IntChange `json:"cardinality,omitempty"`
+}
+
+type StringChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type IntChange struct {
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// Empty reports whether the snapshots describe the same schema.
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffSnapshots compares from to to. HELP text and sampled values are not
+// compared; series counts and cardinalities are.
+func DiffSnapshots(from, to *Snapshot) *SnapshotDiff {
+	before := make(map[string]SnapshotMetric, len(from.Metrics))
+	for _, m := range from.Metrics {
+		before[m.Name] = m
+	}
+	after := make(map[string]SnapshotMetric, len(to.Metrics))
+	for _, m := range to.Metrics {
+		after[m.Name] = m
+	}
+
+	d := &SnapshotDiff{}
+	for _, m := range from.Metrics {
+		if _, ok := after[m.Name]; !ok {
+			d.Removed = append(d.Removed, m.Name)
+		}
+	}
+	for _, m := range to.Metrics {
+		prev, ok := before[m.Name]
+		if !ok {
+			d.Added = append(d.Added, m.Name)
+			continue
+		}
+		if diff, changed := diffMetric(prev, m); changed {
+			d.Changed = append(d.Changed, diff)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+	return d
+}
+
+func diffMetric(from, to SnapshotMetric) (MetricDiff, bool) {
+	d := MetricDiff{Name: to.Name}
+	if from.Type != to.Type {
+		d.Type = &StringChange{from.Type, to.Type}
+	}
+	if from.Unit != to.Unit {
+		d.Unit = &StringChange{from.Unit, to.Unit}
+	}
+	if from.Series != to.Series {
+		d.Series = &IntChange{from.Series, to.Series}
+	}
+
+	before := make(map[string]int, len(from.Labels))
+	for _, l := range from.Labels {
+		before[l.Name] = l.Cardinality
+	}
+	after := make(map[string]bool, len(to.Labels))
+	for _, l := range to.Labels {
+		after[l.Name] = true
+		prev, ok := before[l.Name]
+		switch {
+		case !ok:
+			d.AddedLabels = append(d.AddedLabels, l.Name)
+		case prev != l.Cardinality:
+			if d.Cardinality == nil {
+				d.Cardinality = make(map[string]IntChange)
+			}
+			d.Cardinality[l.Name] = IntChange{prev, l.Cardinality}
+		}
+	}
+	for _, l := range from.Labels {
+		if !after[l.Name] {
+			d.RemovedLabels = append(d.RemovedLabels, l.Name)
+		}
+	}
+	changed := d.Type != nil || d.Unit != nil || d.Series != nil ||
+		len(d.AddedLabels) > 0 || len(d.RemovedLabels) > 0 || len(d.Cardinality) > 0
+	return d, changed
+}
+
+// Write prints the diff for people, one line per change.
+func (d *SnapshotDiff) Write(w io.Writer) error {
+	var b strings.Builder
+	for _, name := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", name)
+	}
+	for _, m := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", m.Name)
+		if m.Type != nil {
+			fmt.Fprintf(&b, "    type %s -> %s\n", m.Type.Old, m.Type.New)
+		}
+		if m.Unit != nil {
+			fmt.Fprintf(&b, "    unit %q -> %q\n", m.Unit.Old, m.Unit.New)
+		}
+		if m.Series != nil {
+			fmt.Fprintf(&b, "    series %d -> %d\n", m.Series.Old, m.Series.New)
+		}
+		for _, l := range m.AddedLabels {
+			fmt.Fprintf(&b, "    + label %s\n", l)
+		}
+		for _, l := range m.RemovedLabels {
+			fmt.Fprintf(&b, "    - label %s\n", l)
+		}
+		labels := make([]string, 0, len(m.Cardinality))
+		for l := range m.Cardinality {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			fmt.Fprintf(&b, "    label %s cardinality %d -> %d\n", l, m.Cardinality[l].Old, m.Cardinality[l].New)
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("No schema changes.\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
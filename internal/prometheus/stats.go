@@ -0,0 +1,149 @@
+// internal/prometheus/stats.go
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// spikeZScore is how many standard deviations from the mean a sample must
+// be to count as a spike.
+const spikeZScore = 3
+
+// minSpikeSamples is the number of samples needed before spikes are
+// reported. A single outlier among n samples is at most (n-1)/sqrt(n)
+// standard deviations from the mean, which first reaches spikeZScore at 11.
+const minSpikeSamples = 11
+
+// SeriesStats summarises the samples of a single result series.
+type SeriesStats struct {
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels"`
+	Samples int               `json:"samples"`
+	FirstAt time.Time         `json:"first_at"`
+	Min     float64           `json:"min"`
+	MinAt   time.Time         `json:"min_at"`
+	Max     float64           `json:"max"`
+	MaxAt   time.Time         `json:"max_at"`
+	Mean    float64           `json:"mean"`
+	Last    float64           `json:"last"`
+	LastAt  time.Time         `json:"last_at"`
+	// Slope is the least-squares trend in units per second.
+	Slope  float64 `json:"slope"`
+	Spikes []Spike `json:"spikes,omitempty"`
+}
+
+// Spike is a sample far outside the series' usual range.
+type Spike struct {
+	At     time.Time `json:"at"`
+	Value  float64   `json:"value"`
+	ZScore float64   `json:"z_score"`
+}
+
+// Series is a result series with its samples decoded.
+type Series struct {
+	Name    string
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Stats computes per-series statistics for a vector or matrix result.
+func (r *QueryResult) Stats() []SeriesStats {
+	var stats []SeriesStats
+	for _, series := range r.Series() {
+		stats = append(stats, computeStats(series.Labels, series.Samples))
+	}
+	return stats
+}
+
+func computeStats(labels map[string]string, samples []Sample) SeriesStats {
+	st := SeriesStats{
+		Name:    SeriesName(labels),
+		Labels:  labels,
+		Samples: len(samples),
+		FirstAt: samples[0].At,
+		Min:     samples[0].Value,
+		MinAt:   samples[0].At,
+		Max:     samples[0].Value,
+		MaxAt:   samples[0].At,
+		Last:    samples[len(samples)-1].Value,
+		LastAt:  samples[len(samples)-1].At,
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s.Value
+		if s.Value < st.Min {
+			st.Min, st.MinAt = s.Value, s.At
+		}
+		if s.Value > st.Max {
+			st.Max, st.MaxAt = s.Value, s.At
+		}
+	}
+	st.Mean = sum / float64(len(samples))
+
+	if len(samples) < 2 {
+		return st
+	}
+
+	// Least-squares slope against seconds since the first sample.
+	t0 := samples[0].At
+	var sx, sy, sxx, sxy float64
+	for _, s := range samples {
+		x := s.At.Sub(t0).Seconds()
+		sx += x
+		sy += s.Value
+		sxx += x * x
+		sxy += x * s.Value
+	}
+	n := float64(len(samples))
+	if denom := n*sxx - sx*sx; denom != 0 {
+		st.Slope = (n*sxy - sx*sy) / denom
+	}
+
+	if len(samples) < minSpikeSamples {
+		return st
+	}
+	var variance float64
+	for _, s := range samples {
+		variance += (s.Value - st.Mean) * (s.Value - st.Mean)
+	}
+	stddev := math.Sqrt(variance / n)
+	if stddev == 0 {
+		return st
+	}
+	for _, s := range samples {
+		if z := (s.Value - st.Mean) / stddev; math.Abs(z) >= spikeZScore {
+			st.Spikes = append(st.Spikes, Spike{At: s.At, Value: s.Value, ZScore: math.Round(z*100) / 100})
+		}
+	}
+	return st
+}
+
+// SeriesName renders a series' labels the way Prometheus prints them, for
+// example up{job="api"}.
+func SeriesName(labels map[string]string) string {
+	name := labels["__name__"]
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	if len(pairs) == 0 {
+		if name == "" {
+			return "{}"
+		}
+		return name
+	}
+	return name + "{" + strings.Join(pairs, ", ") + "}"
+}
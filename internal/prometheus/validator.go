@@ -3,16 +3,35 @@ package prometheus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
 )
 
 type ValidationResult struct {
 	Valid    bool     `json:"valid"`
 	Warnings []string `json:"warnings"`
 	Error    string   `json:"error,omitempty"`
+	// ErrorType is the Prometheus error type of Error, such as bad_data
+	// for a query that does not parse.
+	ErrorType ErrorType `json:"error_type,omitempty"`
+	// Infos are the informational annotations Prometheus returned.
+	Infos []string `json:"infos,omitempty"`
+	// Series is the number of series the query returned when it was run.
+	Series int `json:"series"`
+	// Offline is set when the query was checked against a schema snapshot
+	// instead of run; Series is then the snapshot's count for the selected
+	// metrics.
+	Offline bool `json:"offline,omitempty"`
+	// Datasource is where the query was run.
+	Datasource string `json:"datasource,omitempty"`
 }
 
+// ValidateQuery runs query to check it. A query Prometheus rejects is
+// reported as invalid; failing to reach Prometheus, or any other error it
+// answers with, is returned as the error.
 func (c *Client) ValidateQuery(ctx context.Context, query string) (*ValidationResult, error) {
 	result := &ValidationResult{Valid: true}
 
@@ -22,12 +41,22 @@ func (c *Client) ValidateQuery(ctx context.Context, query string) (*ValidationRe
 		return result, nil
 	}
 
-	_, err := c.Query(ctx, query)
+	queryResult, err := c.Query(ctx, query)
 	if err != nil {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.QueryError() {
+			return nil, err
+		}
 		result.Valid = false
-		result.Error = fmt.Sprintf("invalid query: %v", err)
+		result.Error = apiErr.Msg
+		result.ErrorType = apiErr.Type
+		result.Warnings = append(result.Warnings, apiErr.Warnings...)
+		result.Infos = apiErr.Infos
 		return result, nil
 	}
+	result.Series = len(queryResult.Data.Result)
+	result.Warnings = append(result.Warnings, queryResult.Warnings...)
+	result.Infos = queryResult.Infos
 
 	if len(query) > 1000 {
 		result.Warnings = append(result.Warnings, "query exceeds recommended length")
@@ -39,3 +68,48 @@ func (c *Client) ValidateQuery(ctx context.Context, query string) (*ValidationRe
 
 	return result, nil
 }
+
+// ValidateAgainstSchema checks a query without Prometheus: it must parse and
+// select only metrics of the schema. Labels the schema does not know are
+// reported as warnings, since snapshots keep only a sample of values.
+func ValidateAgainstSchema(query string, metrics map[string]MetricSchema) *ValidationResult {
+	result := &ValidationResult{Valid: true, Offline: true}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		result.Valid = false
+		result.Error = fmt.Sprintf("invalid query: %v", err)
+		result.ErrorType = ErrBadData
+		return result
+	}
+
+	var unknown []string
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		schema, ok := metrics[vs.Name]
+		if !ok {
+			if vs.Name != "" {
+				unknown = append(unknown, vs.Name)
+			}
+			return nil
+		}
+		result.Series += schema.Series
+		for _, m := range vs.LabelMatchers {
+			if m.Name == "__name__" {
+				continue
+			}
+			if _, ok := schema.LabelValues[m.Name]; !ok {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("label %s is not in the schema of %s", m.Name, vs.Name))
+			}
+		}
+		return nil
+	})
+	if len(unknown) > 0 {
+		result.Valid = false
+		result.Error = fmt.Sprintf("unknown metric %s", strings.Join(unknown, ", "))
+	}
+	return result
+}
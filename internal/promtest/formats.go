@@ -0,0 +1,198 @@
+package promtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata is what the metadata API reports for a metric family.
+type Metadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// SetMetadata records the metadata of a metric family.
+func (s *Storage) SetMetadata(metric string, md Metadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metadata[metric] = md
+}
+
+// Metadata returns the metadata recorded by SetMetadata and exposition
+// loads, by metric family.
+func (s *Storage) Metadata() map[string]Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Metadata, len(s.metadata))
+	for name, md := range s.metadata {
+		out[name] = md
+	}
+	return out
+}
+
+// testFile is a promtool rule test file, or just its input series.
+type testFile struct {
+	Interval    model.Duration `yaml:"interval"`
+	InputSeries []inputSeries  `yaml:"input_series"`
+	Tests       []struct {
+		Interval    model.Duration `yaml:"interval"`
+		InputSeries []inputSeries  `yaml:"input_series"`
+	} `yaml:"tests"`
+	EvaluationInterval model.Duration `yaml:"evaluation_interval"`
+}
+
+type inputSeries struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+// LoadTestFile appends the input_series of a promtool rule test file:
+//
+//	interval: 1m
+//	input_series:
+//	  - series: 'up{job="api"}'
+//	    values: '1x30 0x30'
+//
+// Files with a tests list load the series of every test. The interval
+// defaults to evaluation_interval, then to 1m, as in promtool.
+func (s *Storage) LoadTestFile(content []byte) error {
+	var f testFile
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return fmt.Errorf("parsing test file: %w", err)
+	}
+	fallback := time.Minute
+	if f.EvaluationInterval > 0 {
+		fallback = time.Duration(f.EvaluationInterval)
+	}
+	load := func(interval model.Duration, series []inputSeries) error {
+		d := fallback
+		if interval > 0 {
+			d = time.Duration(interval)
+		}
+		app := s.db.Appender(context.Background())
+		for _, in := range series {
+			if err := appendSeries(app, in.Series+" "+in.Values, d); err != nil {
+				app.Rollback()
+				return fmt.Errorf("series %s: %w", in.Series, err)
+			}
+		}
+		return app.Commit()
+	}
+
+	if err := load(f.Interval, f.InputSeries); err != nil {
+		return err
+	}
+	for i, t := range f.Tests {
+		if err := load(t.Interval, t.InputSeries); err != nil {
+			return fmt.Errorf("test %d: %w", i+1, err)
+		}
+	}
+	if len(f.InputSeries) == 0 && len(f.Tests) == 0 {
+		return errors.New("test file has no input_series")
+	}
+	return nil
+}
+
+// LoadExposition appends the samples of a scrape in the Prometheus text
+// format, or OpenMetrics when openMetrics is set, and records the HELP, TYPE
+// and UNIT it declares. Samples without a timestamp are written at ts.
+func (s *Storage) LoadExposition(content []byte, openMetrics bool, ts time.Time) error {
+	var p textparse.Parser
+	if openMetrics {
+		// The parser insists on the terminating marker, which hand-written
+		// fixtures tend to leave out.
+		if !bytes.Contains(content, []byte("# EOF")) {
+			content = append(append([]byte(nil), content...), "# EOF\n"...)
+		}
+		p = textparse.NewOpenMetricsParser(content, labels.NewSymbolTable())
+	} else {
+		p = textparse.NewPromParser(content, labels.NewSymbolTable())
+	}
+
+	metadata := make(map[string]Metadata)
+	app := s.db.Appender(context.Background())
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.Rollback()
+			return fmt.Errorf("parsing exposition: %w", err)
+		}
+		switch entry {
+		case textparse.EntryType:
+			name, typ := p.Type()
+			md := metadata[string(name)]
+			md.Type = string(typ)
+			metadata[string(name)] = md
+		case textparse.EntryHelp:
+			name, help := p.Help()
+			md := metadata[string(name)]
+			md.Help = string(help)
+			metadata[string(name)] = md
+		case textparse.EntryUnit:
+			name, unit := p.Unit()
+			md := metadata[string(name)]
+			md.Unit = string(unit)
+			metadata[string(name)] = md
+		case textparse.EntrySeries:
+			_, sampleTS, v := p.Series()
+			t := ts.UnixMilli()
+			if sampleTS != nil {
+				t = *sampleTS
+			}
+			var lset labels.Labels
+			p.Metric(&lset)
+			if _, err := app.Append(0, lset, t, v); err != nil {
+				app.Rollback()
+				return fmt.Errorf("appending %s: %w", lset, err)
+			}
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return err
+	}
+
+	for name, md := range metadata {
+		s.SetMetadata(name, md)
+	}
+	return nil
+}
+
+// LoadFile loads a file by its extension: .yaml and .yml are promtool test
+// files, .prom and .txt the text format, .om OpenMetrics, and anything else
+// the "load" notation.
+func (s *Storage) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = s.LoadTestFile(content)
+	case ".prom", ".txt":
+		err = s.LoadExposition(content, false, Start)
+	case ".om":
+		err = s.LoadExposition(content, true, Start)
+	default:
+		err = s.Load(string(content))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package promtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/annotations"
+)
+
+// Server answers the parts of the Prometheus HTTP API txt2promql uses from a
+// Storage, so the client, discovery, validation and execution can run
+// without a Prometheus:
+//
+//	/api/v1/query
+//	/api/v1/query_range
+//	/api/v1/series
+//	/api/v1/labels
+//	/api/v1/label/<name>/values
+//	/api/v1/metadata
+type Server struct {
+	*Storage
+
+	// Now is the evaluation time of instant queries without a time
+	// parameter. The zero value means the newest loaded sample, so queries
+	// see the loaded data rather than the wall clock.
+	Now time.Time
+
+	mux *http.ServeMux
+	srv *httptest.Server
+}
+
+// NewServer returns a server over empty storage. Load series, then Start it
+// or use it as an http.Handler.
+func NewServer() (*Server, error) {
+	st, err := NewStorage()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Storage: st, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/v1/query", s.handleQuery)
+	s.mux.HandleFunc("/api/v1/query_range", s.handleQueryRange)
+	s.mux.HandleFunc("/api/v1/series", s.handleSeries)
+	s.mux.HandleFunc("/api/v1/labels", s.handleLabels)
+	s.mux.HandleFunc("/api/v1/label/", s.handleLabelValues)
+	s.mux.HandleFunc("/api/v1/metadata", s.handleMetadata)
+	s.mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "Healthy.") })
+	s.mux.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "Ready.") })
+	return s, nil
+}
+
+// Start listens on a random local port and returns the server's URL.
+func (s *Server) Start() string {
+	if s.srv == nil {
+		s.srv = httptest.NewServer(s)
+	}
+	return s.srv.URL
+}
+
+// URL is the address of a started server.
+func (s *Server) URL() string {
+	if s.srv == nil {
+		return ""
+	}
+	return s.srv.URL
+}
+
+// Close stops the server and removes its storage.
+func (s *Server) Close() error {
+	if s.srv != nil {
+		s.srv.Close()
+	}
+	return s.Storage.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// now is the default evaluation time.
+func (s *Server) now() time.Time {
+	if !s.Now.IsZero() {
+		return s.Now
+	}
+	if maxt := s.db.Head().MaxTime(); maxt != math.MinInt64 {
+		return time.UnixMilli(maxt).UTC()
+	}
+	return Start
+}
+
+// apiError is an error response as Prometheus sends it.
+type apiError struct {
+	status    int
+	errorType string
+	err       error
+}
+
+func badData(err error) *apiError {
+	return &apiError{http.StatusBadRequest, "bad_data", err}
+}
+
+type response struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Warnings  []string    `json:"warnings,omitempty"`
+	Infos     []string    `json:"infos,omitempty"`
+}
+
+func respond(w http.ResponseWriter, data interface{}, warnings annotations.Annotations, query string) {
+	res := response{Status: "success", Data: data}
+	res.Warnings, res.Infos = warnings.AsStrings(query, 10, 10)
+	writeJSON(w, http.StatusOK, res)
+}
+
+func respondError(w http.ResponseWriter, e *apiError) {
+	writeJSON(w, e.status, response{Status: "error", ErrorType: e.errorType, Error: e.err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// queryResult is the data of a query response.
+type queryResult struct {
+	ResultType parser.ValueType `json:"resultType"`
+	Result     interface{}      `json:"result"`
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	ts, err := parseTime(r.FormValue("time"), s.now())
+	if err != nil {
+		respondError(w, badData(fmt.Errorf("invalid parameter \"time\": %w", err)))
+		return
+	}
+	query := r.FormValue("query")
+	q, err := s.engine.NewInstantQuery(r.Context(), s.db, nil, query, ts)
+	if err != nil {
+		respondError(w, badData(err))
+		return
+	}
+	s.exec(w, r.Context(), q, query)
+}
+
+func (s *Server) handleQueryRange(w http.ResponseWriter, r *http.Request) {
+	start, err := parseTime(r.FormValue("start"), time.Time{})
+	if err != nil {
+		respondError(w, badData(fmt.Errorf("invalid parameter \"start\": %w", err)))
+		return
+	}
+	end, err := parseTime(r.FormValue("end"), time.Time{})
+	if err != nil {
+		respondError(w, badData(fmt.Errorf("invalid parameter \"end\": %w", err)))
+		return
+	}
+	if end.Before(start) {
+		respondError(w, badData(errors.New("end timestamp must not be before start time")))
+		return
+	}
+	step, err := parseDuration(r.FormValue("step"))
+	if err != nil || step <= 0 {
+		respondError(w, badData(errors.New("invalid parameter \"step\": zero or negative query resolution step widths are not accepted")))
+		return
+	}
+	if end.Sub(start)/step > 11000 {
+		respondError(w, badData(errors.New("exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")))
+		return
+	}
+
+	query := r.FormValue("query")
+	q, err := s.engine.NewRangeQuery(r.Context(), s.db, nil, query, start, end, step)
+	if err != nil {
+		respondError(w, badData(err))
+		return
+	}
+	s.exec(w, r.Context(), q, query)
+}
+
+func (s *Server) exec(w http.ResponseWriter, ctx context.Context, q promql.Query, query string) {
+	defer q.Close()
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		respondError(w, execError(res.Err))
+		return
+	}
+	respond(w, queryResult{ResultType: res.Value.Type(), Result: marshalValue(res.Value)}, res.Warnings, query)
+}
+
+// execError classifies an engine error the way the Prometheus API does.
+func execError(err error) *apiError {
+	var (
+		timeout  promql.ErrQueryTimeout
+		canceled promql.ErrQueryCanceled
+		storage  promql.ErrStorage
+	)
+	switch {
+	case errors.As(err, &timeout):
+		return &apiError{http.StatusServiceUnavailable, "timeout", err}
+	case errors.As(err, &canceled):
+		return &apiError{http.StatusServiceUnavailable, "canceled", err}
+	case errors.As(err, &storage):
+		return &apiError{http.StatusInternalServerError, "internal", err}
+	}
+	return &apiError{http.StatusUnprocessableEntity, "execution", err}
+}
+
+// matrixSeries is a range query series in API form.
+type matrixSeries struct {
+	Metric     labels.Labels   `json:"metric"`
+	Values     []promql.FPoint `json:"values,omitempty"`
+	Histograms []promql.HPoint `json:"histograms,omitempty"`
+}
+
+func marshalValue(v parser.Value) interface{} {
+	switch v := v.(type) {
+	case promql.Matrix:
+		out := make([]matrixSeries, len(v))
+		for i, series := range v {
+			out[i] = matrixSeries{Metric: series.Metric, Values: series.Floats, Histograms: series.Histograms}
+		}
+		return out
+	case promql.Vector:
+		if v == nil {
+			return promql.Vector{}
+		}
+	}
+	return v
+}
+
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if len(r.Form["match[]"]) == 0 {
+		respondError(w, badData(errors.New("no match[] parameter provided")))
+		return
+	}
+	sets, start, end, apiErr := s.selectors(r)
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+
+	seen := make(map[string]bool)
+	out := []labels.Labels{}
+	for _, matchers := range sets {
+		series, err := s.Series(r.Context(), start, end, matchers...)
+		if err != nil {
+			respondError(w, &apiError{http.StatusInternalServerError, "internal", err})
+			return
+		}
+		for _, lset := range series {
+			if key := lset.String(); !seen[key] {
+				seen[key] = true
+				out = append(out, lset)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return labels.Compare(out[i], out[j]) < 0 })
+	respond(w, out, nil, "")
+}
+
+func (s *Server) handleLabels(w http.ResponseWriter, r *http.Request) {
+	s.labelQuery(w, r, func(q storage.Querier, matchers []*labels.Matcher) ([]string, annotations.Annotations, error) {
+		return q.LabelNames(r.Context(), nil, matchers...)
+	})
+}
+
+func (s *Server) handleLabelValues(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/label/"), "/values")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if !model.LabelName(name).IsValid() {
+		respondError(w, badData(fmt.Errorf("invalid label name: %q", name)))
+		return
+	}
+	s.labelQuery(w, r, func(q storage.Querier, matchers []*labels.Matcher) ([]string, annotations.Annotations, error) {
+		return q.LabelValues(r.Context(), name, nil, matchers...)
+	})
+}
+
+// labelQuery answers labels and label values requests, merging the results
+// of every match[] selector.
+func (s *Server) labelQuery(w http.ResponseWriter, r *http.Request, fn func(storage.Querier, []*labels.Matcher) ([]string, annotations.Annotations, error)) {
+	r.ParseForm()
+	sets, start, end, apiErr := s.selectors(r)
+	if apiErr != nil {
+		respondError(w, apiErr)
+		return
+	}
+	if len(sets) == 0 {
+		sets = [][]*labels.Matcher{nil}
+	}
+
+	q, err := s.db.Querier(start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		respondError(w, &apiError{http.StatusInternalServerError, "internal", err})
+		return
+	}
+	defer q.Close()
+
+	var warnings annotations.Annotations
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, matchers := range sets {
+		names, warns, err := fn(q, matchers)
+		if err != nil {
+			respondError(w, &apiError{http.StatusInternalServerError, "internal", err})
+			return
+		}
+		warnings.Merge(warns)
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	respond(w, out, warnings, "")
+}
+
+// selectors parses the match[], start and end parameters shared by the
+// series and label endpoints. Without start and end they cover all data.
+func (s *Server) selectors(r *http.Request) ([][]*labels.Matcher, time.Time, time.Time, *apiError) {
+	start, err := parseTime(r.Form.Get("start"), minTime)
+	if err != nil {
+		return nil, start, start, badData(fmt.Errorf("invalid parameter \"start\": %w", err))
+	}
+	end, err := parseTime(r.Form.Get("end"), maxTime)
+	if err != nil {
+		return nil, start, end, badData(fmt.Errorf("invalid parameter \"end\": %w", err))
+	}
+	var sets [][]*labels.Matcher
+	for _, m := range r.Form["match[]"] {
+		matchers, err := parser.ParseMetricSelector(m)
+		if err != nil {
+			return nil, start, end, badData(err)
+		}
+		sets = append(sets, matchers)
+	}
+	return sets, start, end, nil
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	metric := r.FormValue("metric")
+	limit := -1
+	if v := r.FormValue("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, badData(errors.New("limit must be a number")))
+			return
+		}
+		limit = n
+	}
+
+	names := make([]string, 0)
+	metadata := s.Metadata()
+	for name := range metadata {
+		if metric == "" || name == metric {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if limit >= 0 && len(names) > limit {
+		names = names[:limit]
+	}
+
+	out := make(map[string][]Metadata, len(names))
+	for _, name := range names {
+		out[name] = []Metadata{metadata[name]}
+	}
+	respond(w, out, nil, "")
+}
+
+// minTime and maxTime are the widest range the API accepts, as in Prometheus.
+var (
+	minTime = time.Unix(math.MinInt64/1000+62135596801, 0).UTC()
+	maxTime = time.Unix(math.MaxInt64/1000-62135596801, 999999999).UTC()
+)
+
+// parseTime accepts RFC 3339 and Unix seconds, as Prometheus does.
+func parseTime(s string, fallback time.Time) (time.Time, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", s)
+}
+
+// parseDuration accepts float seconds and both Prometheus ("1m") and Go
+// ("1m0s") durations.
+func parseDuration(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", s)
+}
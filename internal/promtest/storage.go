@@ -0,0 +1,226 @@
+// Package promtest evaluates PromQL in memory with the upstream engine,
+// against series loaded from the promql test "load" notation:
+//
+//	load 1m
+//	  http_requests_total{job="api"} 0+10x60
+//	  up{job="api"} 1x60
+//
+// Series can also come from promtool rule test files and scrapes in the
+// text or OpenMetrics format, and Server serves them over the Prometheus
+// HTTP API.
+package promtest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// Start is the timestamp of the first loaded sample, as in promql tests.
+var Start = time.Unix(0, 0).UTC()
+
+// Storage is a temporary TSDB with a query engine on top.
+type Storage struct {
+	db     *tsdb.DB
+	dir    string
+	engine *promql.Engine
+
+	mu       sync.Mutex
+	metadata map[string]Metadata
+}
+
+func NewStorage() (*Storage, error) {
+	dir, err := os.MkdirTemp("", "txt2promql-promtest")
+	if err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+
+	// Series are loaded one after the other, so the head must accept the
+	// whole loaded range.
+	opts := tsdb.DefaultOptions()
+	opts.MinBlockDuration = int64(24 * time.Hour / time.Millisecond)
+	opts.MaxBlockDuration = opts.MinBlockDuration
+	opts.RetentionDuration = 0
+	opts.EnableNativeHistograms = true
+	db, err := tsdb.Open(dir, nil, nil, opts, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("opening storage: %w", err)
+	}
+
+	engine := promql.NewEngine(promql.EngineOpts{
+		MaxSamples:               50_000_000,
+		Timeout:                  time.Minute,
+		LookbackDelta:            5 * time.Minute,
+		EnableAtModifier:         true,
+		EnableNegativeOffset:     true,
+		NoStepSubqueryIntervalFn: func(int64) int64 { return time.Minute.Milliseconds() },
+	})
+	return &Storage{db: db, dir: dir, engine: engine, metadata: make(map[string]Metadata)}, nil
+}
+
+// Close releases the storage and removes its files.
+func (s *Storage) Close() error {
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// Queryable exposes the loaded series, for example to a custom engine.
+func (s *Storage) Queryable() storage.Queryable {
+	return s.db
+}
+
+// Load appends the series of every "load <interval>" block in input. Sample
+// i of a series is written at Start + i*interval. Blank lines and lines
+// starting with # are ignored.
+func (s *Storage) Load(input string) error {
+	app := s.db.Appender(context.Background())
+	var interval time.Duration
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "load "); ok {
+			d, err := model.ParseDuration(strings.TrimSpace(rest))
+			if err != nil || d <= 0 {
+				app.Rollback()
+				return fmt.Errorf("line %d: invalid load interval %q", n, rest)
+			}
+			interval = time.Duration(d)
+			continue
+		}
+		if interval == 0 {
+			app.Rollback()
+			return fmt.Errorf("line %d: series outside a load block", n)
+		}
+		if err := appendSeries(app, line, interval); err != nil {
+			app.Rollback()
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		app.Rollback()
+		return err
+	}
+	return app.Commit()
+}
+
+// AddSeries appends one series given in "metric{labels} values" notation.
+func (s *Storage) AddSeries(series string, interval time.Duration) error {
+	app := s.db.Appender(context.Background())
+	if err := appendSeries(app, series, interval); err != nil {
+		app.Rollback()
+		return err
+	}
+	return app.Commit()
+}
+
+func appendSeries(app storage.Appender, line string, interval time.Duration) error {
+	lset, values, err := parser.ParseSeriesDesc(line)
+	if err != nil {
+		return err
+	}
+	for i, v := range values {
+		if v.Omitted {
+			continue
+		}
+		ts := Start.Add(time.Duration(i) * interval).UnixMilli()
+		if v.Histogram != nil {
+			_, err = app.AppendHistogram(0, lset, ts, nil, v.Histogram)
+		} else {
+			_, err = app.Append(0, lset, ts, v.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("appending %s: %w", lset, err)
+		}
+	}
+	return nil
+}
+
+// Query evaluates expr at ts.
+func (s *Storage) Query(ctx context.Context, expr string, ts time.Time) (parser.Value, error) {
+	q, err := s.engine.NewInstantQuery(ctx, s.db, nil, expr, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return clone(res.Value), nil
+}
+
+// QueryRange evaluates expr from start to end every step.
+func (s *Storage) QueryRange(ctx context.Context, expr string, start, end time.Time, step time.Duration) (promql.Matrix, error) {
+	q, err := s.engine.NewRangeQuery(ctx, s.db, nil, expr, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	m, err := res.Matrix()
+	if err != nil {
+		return nil, err
+	}
+	return clone(m).(promql.Matrix), nil
+}
+
+// clone copies a result out of the engine's pooled buffers, which are reused
+// once the query is closed.
+func clone(v parser.Value) parser.Value {
+	switch v := v.(type) {
+	case promql.Matrix:
+		out := make(promql.Matrix, len(v))
+		for i, s := range v {
+			out[i] = promql.Series{
+				Metric:     s.Metric.Copy(),
+				Floats:     append([]promql.FPoint(nil), s.Floats...),
+				Histograms: append([]promql.HPoint(nil), s.Histograms...),
+			}
+		}
+		return out
+	case promql.Vector:
+		out := make(promql.Vector, len(v))
+		for i, s := range v {
+			out[i] = s
+			out[i].Metric = s.Metric.Copy()
+		}
+		return out
+	}
+	return v
+}
+
+// Series returns the label sets of every loaded series matching matchers.
+func (s *Storage) Series(ctx context.Context, start, end time.Time, matchers ...*labels.Matcher) ([]labels.Labels, error) {
+	q, err := s.db.Querier(start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	set := q.Select(ctx, false, nil, matchers...)
+	var out []labels.Labels
+	for set.Next() {
+		out = append(out, set.At().Labels())
+	}
+	return out, set.Err()
+}
@@ -0,0 +1,75 @@
+// Package factory builds the LLM provider selected by the ai section of the
+// configuration. It lives apart from provider because the implementations
+// import provider.
+package factory
+
+import (
+	"fmt"
+
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/provider/openai"
+	"github.com/spf13/viper"
+)
+
+// Provider names accepted in ai.provider.
+const (
+	OpenAI = "openai"
+	Mock   = "mock"
+)
+
+// Config selects and configures a provider.
+type Config struct {
+	// Provider is openai (default) or mock.
+	Provider string
+	OpenAI   openai.Config
+	Mock     mock.Config
+}
+
+// LoadConfig reads the ai section of the configuration.
+func LoadConfig() (Config, error) {
+	cfg := Config{Provider: viper.GetString("ai.provider")}
+	if err := viper.UnmarshalKey("ai", &cfg.OpenAI); err != nil {
+		return cfg, fmt.Errorf("loading AI configuration: %w", err)
+	}
+	if err := viper.UnmarshalKey("ai.mock", &cfg.Mock); err != nil {
+		return cfg, fmt.Errorf("loading mock provider configuration: %w", err)
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = OpenAI
+	}
+	return cfg, nil
+}
+
+// Offline reports whether the provider answers without a model API, so
+// needs no API key.
+func (c Config) Offline() bool {
+	return c.Provider == Mock && c.Mock.Mode != mock.ModeRecord
+}
+
+// New builds the configured provider. In mock record mode the OpenAI client
+// answers and every exchange is recorded into the fixture file.
+func New(cfg Config) (provider.Provider, error) {
+	switch cfg.Provider {
+	case OpenAI:
+		return openai.NewClient(&cfg.OpenAI)
+	case Mock:
+		switch cfg.Mock.Mode {
+		case "", mock.ModeReplay:
+			return mock.NewFromConfig(cfg.Mock)
+		case mock.ModeRecord:
+			if cfg.Mock.Fixtures == "" {
+				return nil, fmt.Errorf("ai.mock.fixtures is required to record")
+			}
+			client, err := openai.NewClient(&cfg.OpenAI)
+			if err != nil {
+				return nil, err
+			}
+			return mock.NewRecorder(client, cfg.Mock.Fixtures)
+		default:
+			return nil, fmt.Errorf("unknown ai.mock.mode %q (want %s or %s)", cfg.Mock.Mode, mock.ModeReplay, mock.ModeRecord)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ai.provider %q (want %s or %s)", cfg.Provider, OpenAI, Mock)
+	}
+}
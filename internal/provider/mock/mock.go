@@ -0,0 +1,187 @@
+// Package mock is an LLM provider that answers from recorded fixtures and
+// scripted rules instead of a model, so conversions run offline and
+// deterministically in tests, CI and demos.
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/agentkube/txt2promql/internal/provider"
+	"gopkg.in/yaml.v3"
+)
+
+// Modes.
+const (
+	// ModeReplay answers from fixtures and rules only.
+	ModeReplay = "replay"
+	// ModeRecord forwards prompts to a real provider and records the
+	// exchanges into the fixture file.
+	ModeRecord = "record"
+)
+
+var ErrNoResponse = errors.New("mock provider has no response for prompt")
+
+// Config is the ai.mock section of the configuration.
+type Config struct {
+	Mode string `mapstructure:"mode" yaml:"mode"`
+	// Fixtures is the file exchanges are replayed from or recorded into.
+	Fixtures string `mapstructure:"fixtures" yaml:"fixtures"`
+	Rules    []Rule `mapstructure:"rules" yaml:"rules"`
+	// Fallback answers prompts nothing else matches. Empty makes them fail
+	// with ErrNoResponse.
+	Fallback string `mapstructure:"fallback" yaml:"fallback"`
+}
+
+// Rule answers every prompt matching Pattern with Response. Response may
+// refer to submatches as $1 or ${name}. Prompts end with "Query: <question>",
+// so rules usually match on that.
+type Rule struct {
+	Pattern  string `mapstructure:"pattern" yaml:"pattern"`
+	Response string `mapstructure:"response" yaml:"response"`
+}
+
+// Exchange is a recorded prompt and the response it got.
+type Exchange struct {
+	Prompt   string `yaml:"prompt"`
+	Response string `yaml:"response"`
+}
+
+type fixtureFile struct {
+	Exchanges []Exchange `yaml:"exchanges"`
+}
+
+type compiledRule struct {
+	pattern  *regexp.Regexp
+	response string
+}
+
+// Provider answers a prompt with the fixture recorded for exactly that
+// prompt, else with the first matching rule, else with the fallback.
+type Provider struct {
+	mu       sync.Mutex
+	fixtures map[string]string
+	rules    []compiledRule
+	fallback string
+	calls    []string
+}
+
+func New(rules []Rule, fixtures []Exchange, fallback string) (*Provider, error) {
+	p := &Provider{fixtures: make(map[string]string, len(fixtures)), fallback: fallback}
+	for _, e := range fixtures {
+		p.fixtures[e.Prompt] = e.Response
+	}
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("mock rule %d: %w", i+1, err)
+		}
+		p.rules = append(p.rules, compiledRule{pattern: re, response: r.Response})
+	}
+	return p, nil
+}
+
+// NewFromConfig builds a replaying provider from cfg, loading its fixture
+// file when one is set.
+func NewFromConfig(cfg Config) (*Provider, error) {
+	var fixtures []Exchange
+	if cfg.Fixtures != "" {
+		var err error
+		if fixtures, err = LoadFixtures(cfg.Fixtures); err != nil {
+			return nil, err
+		}
+	}
+	return New(cfg.Rules, fixtures, cfg.Fallback)
+}
+
+func (p *Provider) Complete(ctx context.Context, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, prompt)
+
+	if response, ok := p.fixtures[prompt]; ok {
+		return response, nil
+	}
+	for _, r := range p.rules {
+		if m := r.pattern.FindStringSubmatchIndex(prompt); m != nil {
+			return string(r.pattern.ExpandString(nil, r.response, prompt, m)), nil
+		}
+	}
+	if p.fallback != "" {
+		return p.fallback, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoResponse, preview(prompt))
+}
+
+// CompleteStream delivers the response word by word.
+func (p *Provider) CompleteStream(ctx context.Context, prompt string, onToken provider.TokenFunc) (string, error) {
+	response, err := p.Complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	if onToken != nil {
+		for _, token := range strings.SplitAfter(response, " ") {
+			if token != "" {
+				onToken(token)
+			}
+		}
+	}
+	return response, nil
+}
+
+// Calls returns the prompts received so far, for assertions in tests.
+func (p *Provider) Calls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.calls...)
+}
+
+// preview identifies a prompt in errors by its question, or its end.
+func preview(prompt string) string {
+	if i := strings.LastIndex(prompt, "Query: "); i >= 0 {
+		return strings.TrimSpace(prompt[i:])
+	}
+	if len(prompt) > 120 {
+		return "..." + prompt[len(prompt)-120:]
+	}
+	return prompt
+}
+
+// LoadFixtures reads a fixture file. A missing file has no exchanges.
+func LoadFixtures(path string) ([]Exchange, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f fixtureFile
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("parsing fixtures %s: %w", path, err)
+	}
+	return f.Exchanges, nil
+}
+
+// SaveFixtures writes exchanges to path.
+func SaveFixtures(path string, exchanges []Exchange) error {
+	content, err := yaml.Marshal(fixtureFile{Exchanges: exchanges})
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so an interrupted recording never
+	// leaves a truncated fixture file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return fmt.Errorf("writing fixtures: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,63 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/agentkube/txt2promql/internal/provider"
+)
+
+// Recorder forwards prompts to a real provider and records every successful
+// exchange into a fixture file, which a replaying Provider answers from
+// later. A prompt recorded again replaces the earlier exchange.
+type Recorder struct {
+	provider provider.Provider
+	path     string
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	index     map[string]int
+}
+
+// NewRecorder records into path, keeping the exchanges already in it.
+func NewRecorder(p provider.Provider, path string) (*Recorder, error) {
+	exchanges, err := LoadFixtures(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{provider: p, path: path, exchanges: exchanges, index: make(map[string]int, len(exchanges))}
+	for i, e := range exchanges {
+		r.index[e.Prompt] = i
+	}
+	return r, nil
+}
+
+func (r *Recorder) Complete(ctx context.Context, prompt string) (string, error) {
+	response, err := r.provider.Complete(ctx, prompt)
+	if err != nil {
+		return response, err
+	}
+	return response, r.record(prompt, response)
+}
+
+func (r *Recorder) CompleteStream(ctx context.Context, prompt string, onToken provider.TokenFunc) (string, error) {
+	response, err := r.provider.CompleteStream(ctx, prompt, onToken)
+	if err != nil {
+		return response, err
+	}
+	return response, r.record(prompt, response)
+}
+
+// record saves the file after every exchange so an interrupted run keeps
+// what it recorded.
+func (r *Recorder) record(prompt, response string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i, ok := r.index[prompt]; ok {
+		r.exchanges[i].Response = response
+	} else {
+		r.index[prompt] = len(r.exchanges)
+		r.exchanges = append(r.exchanges, Exchange{Prompt: prompt, Response: response})
+	}
+	return SaveFixtures(r.path, r.exchanges)
+}
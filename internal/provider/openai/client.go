@@ -4,12 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/resilience"
 	"github.com/sashabaranov/go-openai"
 )
 
+// Upstream is the name the resilience layer reports the model API under.
+const Upstream = "llm/openai"
+
 const (
 	maxToken         = 512
 	presencePenalty  = 0.0
@@ -49,10 +56,10 @@ func NewClient(cfg IAIConfig) (*OpenAIClient, error) {
 	// Configure custom headers if provided
 	customHeaders := cfg.GetCustomHeaders()
 	config.HTTPClient = &http.Client{
-		Transport: &headerTransport{
+		Transport: resilience.NewTransport(Upstream, cfg.GetResilience(), &headerTransport{
 			origin:  transport,
 			headers: customHeaders,
-		},
+		}),
 	}
 
 	client := openai.NewClientWithConfig(config)
@@ -69,29 +76,63 @@ func NewClient(cfg IAIConfig) (*OpenAIClient, error) {
 }
 
 func (c *OpenAIClient) Complete(ctx context.Context, prompt string) (string, error) {
-	resp, err := c.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: c.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			Temperature:      c.temperature,
-			MaxTokens:        maxToken,
-			PresencePenalty:  presencePenalty,
-			FrequencyPenalty: frequencyPenalty,
-			TopP:             c.topP,
-		},
-	)
+	resp, err := c.client.CreateChatCompletion(ctx, c.newRequest(prompt))
 	if err != nil {
 		return "", fmt.Errorf("AI completion error: %w", err)
 	}
 	return resp.Choices[0].Message.Content, nil
 }
 
+// CompleteStream streams the completion, passing each token to onToken as it
+// arrives, and returns the full text once the stream is finished.
+func (c *OpenAIClient) CompleteStream(ctx context.Context, prompt string, onToken provider.TokenFunc) (string, error) {
+	stream, err := c.client.CreateChatCompletionStream(ctx, c.newRequest(prompt))
+	if err != nil {
+		return "", fmt.Errorf("AI completion error: %w", err)
+	}
+	defer stream.Close()
+
+	var sb strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return sb.String(), fmt.Errorf("AI stream error: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		token := resp.Choices[0].Delta.Content
+		if token == "" {
+			continue
+		}
+		sb.WriteString(token)
+		if onToken != nil {
+			onToken(token)
+		}
+	}
+	return sb.String(), nil
+}
+
+func (c *OpenAIClient) newRequest(prompt string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		Temperature:      c.temperature,
+		MaxTokens:        maxToken,
+		PresencePenalty:  presencePenalty,
+		FrequencyPenalty: frequencyPenalty,
+		TopP:             c.topP,
+	}
+}
+
 // headerTransport adds custom headers to requests
 type headerTransport struct {
 	origin  http.RoundTripper
@@ -2,6 +2,8 @@ package openai
 
 import (
 	"net/http"
+
+	"github.com/agentkube/txt2promql/internal/resilience"
 )
 
 // IAIConfig interface defines configuration methods for AI providers
@@ -14,6 +16,7 @@ type IAIConfig interface {
 	GetTemperature() float32
 	GetTopP() float32
 	GetCustomHeaders() []http.Header
+	GetResilience() resilience.Config
 }
 
 // Config implements IAIConfig interface
@@ -26,15 +29,17 @@ type Config struct {
 	Temperature   float32             `mapstructure:"temperature"`
 	TopP          float32             `mapstructure:"top_p"`
 	CustomHeaders map[string][]string `mapstructure:"custom_headers"`
+	Resilience    resilience.Config   `mapstructure:"resilience"`
 }
 
-func (c *Config) GetPassword() string       { return c.APIKey }
-func (c *Config) GetModel() string          { return c.Model }
-func (c *Config) GetBaseURL() string        { return c.BaseURL }
-func (c *Config) GetProxyEndpoint() string  { return c.ProxyEndpoint }
-func (c *Config) GetOrganizationId() string { return c.OrgID }
-func (c *Config) GetTemperature() float32   { return c.Temperature }
-func (c *Config) GetTopP() float32          { return c.TopP }
+func (c *Config) GetPassword() string              { return c.APIKey }
+func (c *Config) GetModel() string                 { return c.Model }
+func (c *Config) GetBaseURL() string               { return c.BaseURL }
+func (c *Config) GetProxyEndpoint() string         { return c.ProxyEndpoint }
+func (c *Config) GetOrganizationId() string        { return c.OrgID }
+func (c *Config) GetTemperature() float32          { return c.Temperature }
+func (c *Config) GetTopP() float32                 { return c.TopP }
+func (c *Config) GetResilience() resilience.Config { return c.Resilience }
 func (c *Config) GetCustomHeaders() []http.Header {
 	var headers []http.Header
 	for key, values := range c.CustomHeaders {
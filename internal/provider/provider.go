@@ -0,0 +1,13 @@
+// internal/provider/provider.go
+package provider
+
+import "context"
+
+// TokenFunc receives completion tokens as they arrive from a streaming call.
+type TokenFunc func(token string)
+
+// Provider is implemented by the LLM backends used by the agent.
+type Provider interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+	CompleteStream(ctx context.Context, prompt string, onToken TokenFunc) (string, error)
+}
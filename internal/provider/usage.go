@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"sync"
+)
+
+// Usage counts the calls made to a provider and the tokens they used.
+type Usage struct {
+	Calls            int `json:"calls"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Sub returns the usage since an earlier reading.
+func (u Usage) Sub(earlier Usage) Usage {
+	return Usage{
+		Calls:            u.Calls - earlier.Calls,
+		PromptTokens:     u.PromptTokens - earlier.PromptTokens,
+		CompletionTokens: u.CompletionTokens - earlier.CompletionTokens,
+	}
+}
+
+// Metered wraps a Provider and counts its usage. Tokens are estimated from
+// the text length, which is close enough to compare runs of the same model.
+type Metered struct {
+	provider Provider
+
+	mu    sync.Mutex
+	usage Usage
+}
+
+func NewMetered(p Provider) *Metered {
+	return &Metered{provider: p}
+}
+
+func (m *Metered) Complete(ctx context.Context, prompt string) (string, error) {
+	out, err := m.provider.Complete(ctx, prompt)
+	m.record(prompt, out)
+	return out, err
+}
+
+func (m *Metered) CompleteStream(ctx context.Context, prompt string, onToken TokenFunc) (string, error) {
+	out, err := m.provider.CompleteStream(ctx, prompt, onToken)
+	m.record(prompt, out)
+	return out, err
+}
+
+// Usage returns the usage so far.
+func (m *Metered) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+func (m *Metered) record(prompt, completion string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.Calls++
+	m.usage.PromptTokens += EstimateTokens(prompt)
+	m.usage.CompletionTokens += EstimateTokens(completion)
+}
+
+// EstimateTokens approximates the token count of English text and code at
+// four characters per token.
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
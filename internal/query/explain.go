@@ -0,0 +1,350 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Step is the structural explanation of a single AST node.
+type Step struct {
+	Expr  string `json:"expr"`
+	Kind  string `json:"kind"`
+	Text  string `json:"text"`
+	Depth int    `json:"depth"`
+}
+
+// Explanation describes a PromQL expression node by node, in the order
+// Prometheus evaluates them (innermost first).
+type Explanation struct {
+	Query   string `json:"query"`
+	Type    string `json:"type"`
+	Steps   []Step `json:"steps"`
+	Summary string `json:"summary"`
+}
+
+var functionDescriptions = map[string]string{
+	"rate":               "computes the per-second average rate of increase of each series over its %s window, accounting for counter resets",
+	"irate":              "computes the per-second instant rate of each series from the last two samples in its %s window, accounting for counter resets",
+	"increase":           "computes how much each series increased over its %s window, accounting for counter resets",
+	"delta":              "computes the difference between the first and last value of each series over its %s window",
+	"idelta":             "computes the difference between the last two samples of each series in its %s window",
+	"deriv":              "estimates the per-second derivative of each series over its %s window using linear regression",
+	"predict_linear":     "predicts the value of each series in the future from the trend over its %s window",
+	"changes":            "counts how many times each series changed value over its %s window",
+	"resets":             "counts the counter resets of each series over its %s window",
+	"avg_over_time":      "averages each series over its %s window",
+	"sum_over_time":      "sums each series over its %s window",
+	"min_over_time":      "takes the minimum of each series over its %s window",
+	"max_over_time":      "takes the maximum of each series over its %s window",
+	"count_over_time":    "counts the samples of each series in its %s window",
+	"last_over_time":     "takes the most recent sample of each series in its %s window",
+	"quantile_over_time": "computes a quantile of each series over its %s window",
+	"stddev_over_time":   "computes the standard deviation of each series over its %s window",
+	"absent_over_time":   "returns 1 if no series matched during the %s window, and nothing otherwise",
+	"histogram_quantile": "estimates a quantile from histogram buckets, per remaining label set",
+	"absent":             "returns 1 if the selector matches no series, and nothing otherwise",
+	"abs":                "takes the absolute value of each sample",
+	"ceil":               "rounds each sample up to the nearest integer",
+	"floor":              "rounds each sample down to the nearest integer",
+	"round":              "rounds each sample to the nearest integer",
+	"clamp":              "limits each sample to a minimum and maximum",
+	"clamp_min":          "raises each sample to at least a minimum",
+	"clamp_max":          "caps each sample at a maximum",
+	"label_replace":      "rewrites a label using a regular expression",
+	"label_join":         "joins several label values into a new label",
+	"sort":               "sorts the series by value, ascending",
+	"sort_desc":          "sorts the series by value, descending",
+	"scalar":             "turns a single-series vector into a scalar",
+	"vector":             "turns a scalar into a single-series vector",
+	"time":               "returns the evaluation timestamp in seconds",
+	"timestamp":          "returns the timestamp of each sample",
+}
+
+var aggregationDescriptions = map[string]string{
+	"sum":          "adding their values",
+	"avg":          "averaging their values",
+	"min":          "keeping the smallest value",
+	"max":          "keeping the largest value",
+	"count":        "counting the series",
+	"group":        "keeping the value 1",
+	"stddev":       "computing the standard deviation",
+	"stdvar":       "computing the variance",
+	"quantile":     "computing a quantile",
+	"count_values": "counting series per distinct value",
+}
+
+var binaryDescriptions = map[string]string{
+	"+":      "adds the right side to the left side",
+	"-":      "subtracts the right side from the left side",
+	"*":      "multiplies the left side by the right side",
+	"/":      "divides the left side by the right side",
+	"%":      "takes the left side modulo the right side",
+	"^":      "raises the left side to the power of the right side",
+	"atan2":  "computes the arc tangent of the left side over the right side",
+	"and":    "keeps left-hand series that also exist on the right (intersection)",
+	"or":     "combines series from both sides (union)",
+	"unless": "keeps left-hand series that do not exist on the right",
+}
+
+// Explain parses promQL and returns a deterministic, node by node
+// explanation of what it does.
+func Explain(promQL string) (*Explanation, error) {
+	expr, err := parser.ParseExpr(promQL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing query: %w", err)
+	}
+
+	e := &Explanation{
+		Query: expr.String(),
+		Type:  string(expr.Type()),
+	}
+	e.walk(expr, 0)
+
+	if len(e.Steps) > 0 {
+		top := e.Steps[len(e.Steps)-1]
+		e.Summary = fmt.Sprintf("The query %s and returns a %s.", top.Text, expr.Type())
+	}
+	return e, nil
+}
+
+// walk appends the steps for node's children before node itself so the
+// steps read in evaluation order.
+func (e *Explanation) walk(node parser.Node, depth int) {
+	switch n := node.(type) {
+	case *parser.ParenExpr:
+		e.walk(n.Expr, depth)
+		return
+	case *parser.StepInvariantExpr:
+		e.walk(n.Expr, depth)
+		return
+	case *parser.MatrixSelector:
+		// The range is described together with its selector.
+		text := fmt.Sprintf("selects %s with all samples from the last %s", n.VectorSelector, model.Duration(n.Range))
+		if vs, ok := n.VectorSelector.(*parser.VectorSelector); ok {
+			text = describeSelector(vs, n.Range)
+		}
+		e.add(n, "matrix_selector", text, depth)
+		return
+	}
+
+	for _, child := range parser.Children(node) {
+		e.walk(child, depth+1)
+	}
+
+	switch n := node.(type) {
+	case *parser.VectorSelector:
+		e.add(n, "selector", describeSelector(n, 0), depth)
+	case *parser.Call:
+		e.add(n, "function", describeCall(n), depth)
+	case *parser.AggregateExpr:
+		e.add(n, "aggregation", describeAggregation(n), depth)
+	case *parser.BinaryExpr:
+		e.add(n, "binary", describeBinary(n), depth)
+	case *parser.SubqueryExpr:
+		e.add(n, "subquery", fmt.Sprintf("evaluates %s every %s over the last %s",
+			n.Expr, stepOrDefault(n.Step), model.Duration(n.Range)), depth)
+	case *parser.UnaryExpr:
+		e.add(n, "unary", "negates the value of "+n.Expr.String(), depth)
+	case *parser.NumberLiteral, *parser.StringLiteral:
+		// Literals are explained as part of the expression using them,
+		// unless they are the whole query.
+		if depth == 0 {
+			e.add(n, "literal", "is the constant "+n.String(), depth)
+		}
+	}
+}
+
+func (e *Explanation) add(node parser.Node, kind, text string, depth int) {
+	e.Steps = append(e.Steps, Step{
+		Expr:  node.String(),
+		Kind:  kind,
+		Text:  text,
+		Depth: depth,
+	})
+}
+
+func describeSelector(vs *parser.VectorSelector, window time.Duration) string {
+	var filters []string
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName {
+			continue
+		}
+		filters = append(filters, describeMatcher(m))
+	}
+
+	subject := "every series"
+	if vs.Name != "" {
+		subject = "every series of " + vs.Name
+	}
+	text := "selects " + subject
+	if len(filters) > 0 {
+		text += " where " + strings.Join(filters, " and ")
+	}
+	if window > 0 {
+		text += fmt.Sprintf(", with all samples from the last %s", model.Duration(window))
+	}
+	if vs.OriginalOffset > 0 {
+		text += fmt.Sprintf(", shifted %s into the past", model.Duration(vs.OriginalOffset))
+	}
+	if vs.Timestamp != nil {
+		text += fmt.Sprintf(", evaluated at %s", time.UnixMilli(*vs.Timestamp).UTC().Format(time.RFC3339))
+	}
+	return text
+}
+
+func describeMatcher(m *labels.Matcher) string {
+	switch m.Type {
+	case labels.MatchEqual:
+		if m.Value == "" {
+			return fmt.Sprintf("%s is not set", m.Name)
+		}
+		return fmt.Sprintf("%s equals %q", m.Name, m.Value)
+	case labels.MatchNotEqual:
+		return fmt.Sprintf("%s is not %q", m.Name, m.Value)
+	case labels.MatchRegexp:
+		return fmt.Sprintf("%s matches /%s/", m.Name, m.Value)
+	default:
+		return fmt.Sprintf("%s does not match /%s/", m.Name, m.Value)
+	}
+}
+
+func describeCall(call *parser.Call) string {
+	window := ""
+	for _, arg := range call.Args {
+		if ms, ok := arg.(*parser.MatrixSelector); ok {
+			window = model.Duration(ms.Range).String()
+		}
+		if sq, ok := arg.(*parser.SubqueryExpr); ok {
+			window = model.Duration(sq.Range).String()
+		}
+	}
+
+	desc, ok := functionDescriptions[call.Func.Name]
+	if !ok {
+		return fmt.Sprintf("applies the %s function", call.Func.Name)
+	}
+	if strings.Contains(desc, "%s") {
+		desc = fmt.Sprintf(desc, window)
+	}
+	if call.Func.Name == "histogram_quantile" && len(call.Args) > 0 {
+		if q, ok := call.Args[0].(*parser.NumberLiteral); ok {
+			desc = fmt.Sprintf("estimates the %s percentile from histogram buckets, per remaining label set", percentile(q.Val))
+		}
+	}
+	return desc
+}
+
+func describeAggregation(agg *parser.AggregateExpr) string {
+	op := agg.Op.String()
+
+	var text string
+	switch agg.Op {
+	case parser.TOPK, parser.BOTTOMK:
+		order := "largest"
+		if agg.Op == parser.BOTTOMK {
+			order = "smallest"
+		}
+		text = fmt.Sprintf("keeps the %s %s series", paramString(agg.Param), order)
+		if len(agg.Grouping) > 0 && !agg.Without {
+			text += " per " + strings.Join(agg.Grouping, ", ")
+		}
+		return text
+	}
+
+	how := aggregationDescriptions[op]
+	if how == "" {
+		how = "applying " + op
+	}
+	if agg.Op == parser.QUANTILE {
+		if q, ok := agg.Param.(*parser.NumberLiteral); ok {
+			how = fmt.Sprintf("computing the %s percentile", percentile(q.Val))
+		}
+	}
+
+	switch {
+	case agg.Without:
+		text = fmt.Sprintf("collapses series that differ only in %s, %s", strings.Join(agg.Grouping, ", "), how)
+	case len(agg.Grouping) > 0:
+		text = fmt.Sprintf("collapses the series into one per distinct %s, %s", strings.Join(agg.Grouping, ", "), how)
+	default:
+		text = fmt.Sprintf("collapses all series into a single value, %s", how)
+	}
+	return text
+}
+
+func describeBinary(b *parser.BinaryExpr) string {
+	op := b.Op.String()
+
+	var text string
+	switch {
+	case b.Op.IsComparisonOperator() && b.ReturnBool:
+		text = fmt.Sprintf("returns 1 where the left side %s the right side and 0 elsewhere", op)
+	case b.Op.IsComparisonOperator():
+		text = fmt.Sprintf("keeps only the samples where the left side %s the right side", op)
+	default:
+		text = binaryDescriptions[op]
+		if text == "" {
+			text = fmt.Sprintf("applies %s to both sides", op)
+		}
+	}
+
+	if vm := b.VectorMatching; vm != nil && b.LHS.Type() == parser.ValueTypeVector && b.RHS.Type() == parser.ValueTypeVector {
+		switch {
+		case vm.On && len(vm.MatchingLabels) > 0:
+			text += ", matching series on " + strings.Join(vm.MatchingLabels, ", ")
+		case !vm.On && len(vm.MatchingLabels) > 0:
+			text += ", matching series on all labels except " + strings.Join(vm.MatchingLabels, ", ")
+		case !b.Op.IsSetOperator():
+			text += ", matching series with identical labels"
+		}
+		switch vm.Card {
+		case parser.CardManyToOne:
+			text += " (many-to-one)"
+		case parser.CardOneToMany:
+			text += " (one-to-many)"
+		}
+	}
+	return text
+}
+
+func paramString(param parser.Expr) string {
+	if param == nil {
+		return ""
+	}
+	return param.String()
+}
+
+// percentile names quantile q as a percentile, such as "99th" or "99.9th",
+// rounding away floating point noise like 0.29*100 = 28.999999999999996.
+func percentile(q float64) string {
+	p := math.Round(q*100*1000) / 1000
+	s := strconv.FormatFloat(p, 'f', -1, 64)
+	if p != math.Trunc(p) {
+		return s + "th"
+	}
+	switch n := int64(math.Abs(p)) % 100; {
+	case n >= 11 && n <= 13:
+		return s + "th"
+	case n%10 == 1:
+		return s + "st"
+	case n%10 == 2:
+		return s + "nd"
+	case n%10 == 3:
+		return s + "rd"
+	}
+	return s + "th"
+}
+
+func stepOrDefault(step time.Duration) string {
+	if step == 0 {
+		return "evaluation interval"
+	}
+	return model.Duration(step).String()
+}
@@ -1 +1,78 @@
 package query
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Normalize returns a canonical form of a PromQL expression so that queries
+// differing only in formatting, label matcher order, grouping label order or
+// redundant parentheses compare equal.
+func Normalize(promQL string) (string, error) {
+	expr, err := parser.ParseExpr(promQL)
+	if err != nil {
+		return "", fmt.Errorf("parsing query: %w", err)
+	}
+	return normalize(expr).String(), nil
+}
+
+func normalize(expr parser.Expr) parser.Expr {
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		inner := normalize(e.Expr)
+		if atomic(inner) {
+			return inner
+		}
+		e.Expr = inner
+	case *parser.BinaryExpr:
+		e.LHS, e.RHS = normalize(e.LHS), normalize(e.RHS)
+		if e.VectorMatching != nil {
+			sort.Strings(e.VectorMatching.MatchingLabels)
+			sort.Strings(e.VectorMatching.Include)
+		}
+	case *parser.UnaryExpr:
+		e.Expr = normalize(e.Expr)
+	case *parser.AggregateExpr:
+		e.Expr = normalize(e.Expr)
+		if e.Param != nil {
+			e.Param = normalize(e.Param)
+		}
+		sort.Strings(e.Grouping)
+	case *parser.Call:
+		for i, arg := range e.Args {
+			e.Args[i] = normalize(arg)
+		}
+	case *parser.SubqueryExpr:
+		e.Expr = normalize(e.Expr)
+	case *parser.StepInvariantExpr:
+		e.Expr = normalize(e.Expr)
+	case *parser.MatrixSelector:
+		e.VectorSelector = normalize(e.VectorSelector)
+	case *parser.VectorSelector:
+		sort.SliceStable(e.LabelMatchers, func(i, j int) bool {
+			a, b := e.LabelMatchers[i], e.LabelMatchers[j]
+			if (a.Name == labels.MetricName) != (b.Name == labels.MetricName) {
+				return a.Name == labels.MetricName
+			}
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.String() < b.String()
+		})
+	}
+	return expr
+}
+
+// atomic reports whether expr binds tighter than any operator, so
+// parentheses around it never matter.
+func atomic(expr parser.Expr) bool {
+	switch expr.(type) {
+	case *parser.VectorSelector, *parser.MatrixSelector, *parser.Call, *parser.AggregateExpr,
+		*parser.NumberLiteral, *parser.StringLiteral, *parser.ParenExpr:
+		return true
+	}
+	return false
+}
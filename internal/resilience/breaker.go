@@ -0,0 +1,130 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed lets every request through.
+	Closed State = iota
+	// HalfOpen lets one trial request through after OpenTimeout; its
+	// outcome closes or re-opens the circuit.
+	HalfOpen
+	// Open rejects requests without calling the upstream.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// breaker is a consecutive-failure circuit breaker.
+type breaker struct {
+	threshold int
+	timeout   time.Duration
+	// onChange is called with the new state, with mu held.
+	onChange func(State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow reports whether a request may be sent now.
+func (b *breaker) allow(now time.Time) bool {
+	if b.threshold < 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.timeout {
+			return false
+		}
+		b.set(HalfOpen)
+		b.trial = true
+		return true
+	case HalfOpen:
+		// Only the trial request goes through until it completes.
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// done records the outcome of a request allow let through.
+func (b *breaker) done(ok bool, now time.Time) {
+	if b.threshold < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if ok {
+		b.failures = 0
+		if b.state != Closed {
+			b.set(Closed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.openedAt = now
+		b.set(Open)
+	}
+}
+
+// release ends a request allow let through without an outcome, such as one
+// the caller cancelled.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *breaker) set(s State) {
+	b.state = s
+	if b.onChange != nil {
+		b.onChange(s)
+	}
+}
+
+// Status is the breaker state of an upstream as reported on /health.
+type Status struct {
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+func (b *breaker) status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
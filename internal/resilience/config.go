@@ -0,0 +1,69 @@
+// Package resilience retries failed calls to upstreams such as Prometheus
+// and the LLM provider, and stops calling an upstream for a while when it
+// keeps failing. It works as an http.RoundTripper so every client built on
+// net/http can share it.
+package resilience
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Config tunes retries and the circuit breaker of one upstream. Zero fields
+// take the value of DefaultConfig.
+type Config struct {
+	// MaxAttempts is the number of tries per request, the first included.
+	// 1 disables retries.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialBackoff is the wait before the first retry; it doubles with
+	// every retry up to MaxBackoff. Each wait is jittered down by up to half.
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// FailureThreshold is the number of consecutive failed requests that
+	// opens the circuit. Negative disables the breaker.
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// OpenTimeout is how long an open circuit rejects requests before one
+	// trial request is let through.
+	OpenTimeout time.Duration `mapstructure:"open_timeout"`
+}
+
+// DefaultConfig is used for upstreams without a resilience section.
+var DefaultConfig = Config{
+	MaxAttempts:      3,
+	InitialBackoff:   200 * time.Millisecond,
+	MaxBackoff:       10 * time.Second,
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+}
+
+// withDefaults fills the zero fields of c from DefaultConfig.
+func (c Config) withDefaults() Config {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultConfig.MaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = DefaultConfig.InitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultConfig.MaxBackoff
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = DefaultConfig.FailureThreshold
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = DefaultConfig.OpenTimeout
+	}
+	return c
+}
+
+// backoff is the wait before retry number retry, counting from 1: the
+// exponential delay capped at MaxBackoff, less a random part of up to half
+// of it so that clients failing together do not retry together.
+func (c Config) backoff(retry int) time.Duration {
+	d := c.InitialBackoff
+	for i := 1; i < retry && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, c.MaxBackoff)
+	return d - time.Duration(rand.Int63n(int64(d)/2+1))
+}
@@ -0,0 +1,226 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrCircuitOpen is returned without calling the upstream while its circuit
+// is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+var (
+	retriesTotal = promauto.NewCounterVec(
+		prom.CounterOpts{
+			Name: "text2promql_upstream_retries_total",
+			Help: "Requests to an upstream that were retried",
+		},
+		[]string{"upstream"},
+	)
+
+	rejectedTotal = promauto.NewCounterVec(
+		prom.CounterOpts{
+			Name: "text2promql_upstream_rejected_total",
+			Help: "Requests to an upstream rejected by its open circuit breaker",
+		},
+		[]string{"upstream"},
+	)
+
+	circuitState = promauto.NewGaugeVec(
+		prom.GaugeOpts{
+			Name: "text2promql_upstream_circuit_state",
+			Help: "Circuit breaker state of an upstream: 0 closed, 1 half-open, 2 open",
+		},
+		[]string{"upstream"},
+	)
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Transport)
+)
+
+// Transport retries failed requests to one upstream and breaks the circuit
+// when it keeps failing.
+//
+// Connection errors and 502 and 504 responses are retried for idempotent
+// requests only, since the upstream may have acted on them. 429 and 503
+// responses are retried for any request, waiting as long as Retry-After
+// asks when it is no longer than MaxBackoff. A request counts as failed
+// for the breaker when all its attempts failed with one of these.
+type Transport struct {
+	name    string
+	cfg     Config
+	next    http.RoundTripper
+	breaker *breaker
+}
+
+// NewTransport wraps next, or http.DefaultTransport when nil, for the
+// upstream called name. Its breaker is reported by Statuses under that
+// name, replacing any earlier transport of the same name.
+func NewTransport(name string, cfg Config, next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	cfg = cfg.withDefaults()
+	gauge := circuitState.WithLabelValues(name)
+	gauge.Set(float64(Closed))
+	t := &Transport{
+		name: name,
+		cfg:  cfg,
+		next: next,
+		breaker: &breaker{
+			threshold: cfg.FailureThreshold,
+			timeout:   cfg.OpenTimeout,
+			onChange:  func(s State) { gauge.Set(float64(s)) },
+		},
+	}
+
+	registryMu.Lock()
+	registry[name] = t
+	registryMu.Unlock()
+	return t
+}
+
+// Statuses returns the breaker status of every upstream.
+func Statuses() map[string]Status {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	statuses := make(map[string]Status, len(registry))
+	for name, t := range registry {
+		statuses[name] = t.breaker.status()
+	}
+	return statuses
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow(time.Now()) {
+		rejectedTotal.WithLabelValues(t.name).Inc()
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, t.name)
+	}
+
+	resp, err := t.roundTrip(req)
+	if req.Context().Err() != nil {
+		// Cancelled by the caller: says nothing about the upstream.
+		t.breaker.release()
+	} else {
+		t.breaker.done(!failed(resp, err), time.Now())
+	}
+	return resp, err
+}
+
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		wait, ok := t.retry(req, resp, err, attempt)
+		if !ok {
+			return resp, err
+		}
+		if deadline, set := ctx.Deadline(); set && time.Until(deadline) < wait {
+			return resp, err
+		}
+		next, rewindErr := rewind(req)
+		if rewindErr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		retriesTotal.WithLabelValues(t.name).Inc()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		req = next
+	}
+}
+
+// retry decides whether attempt is followed by another and how long to
+// wait before it.
+func (t *Transport) retry(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= t.cfg.MaxAttempts || req.Context().Err() != nil {
+		return 0, false
+	}
+	if err != nil {
+		return t.cfg.backoff(attempt), idempotent(req)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return after, after <= t.cfg.MaxBackoff
+		}
+		return t.cfg.backoff(attempt), true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return t.cfg.backoff(attempt), idempotent(req)
+	default:
+		return 0, false
+	}
+}
+
+// failed reports whether a request failed in a way that counts against the
+// upstream.
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent follows net/http: safe methods, PUT and DELETE, and requests
+// carrying an idempotency key may be sent twice.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// rewind returns a copy of req with a fresh body to send again.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be sent again")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next := req.Clone(req.Context())
+	next.Body = body
+	return next, nil
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
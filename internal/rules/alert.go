@@ -0,0 +1,323 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/pkg/ai"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Severities.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// DefaultAlertGroup is the rule group generated alerts are placed in.
+const DefaultAlertGroup = "txt2promql-alerts"
+
+var ErrNoCondition = errors.New("no alert condition found; describe it like \"alert when checkout error rate is above 5% for 10 minutes\"")
+
+var (
+	conditionPattern = regexp.MustCompile(`(?i)^(?:(?:alert|notify|page|warn)(?:\s+(?:me|us))?\s+(?:when|if)\s+)?(.+?)\s+(?:is\s+|are\s+|goes\s+|stays\s+|rises\s+|drops\s+|falls\s+)?(above|over|greater than|more than|exceeds|higher than|below|under|less than|lower than|>=|<=|>|<|==)\s*(-?\d+(?:\.\d+)?)\s*(%|percent\b|ms\b|milliseconds?\b|s\b|seconds?\b)?`)
+	forPattern       = regexp.MustCompile(`(?i)\bfor\s+(?:at least\s+|more than\s+|over\s+)?(\d+)\s*(s|secs?|seconds?|m|mins?|minutes?|h|hours?|d|days?)\b`)
+	severityPattern  = regexp.MustCompile(`(?i)\b(critical|page|paging|warning|info)\b`)
+)
+
+var operators = map[string]string{
+	"above": ">", "over": ">", "greater than": ">", "more than": ">", "exceeds": ">", "higher than": ">",
+	"below": "<", "under": "<", "less than": "<", "lower than": "<",
+	">=": ">=", "<=": "<=", ">": ">", "<": "<", "==": "==",
+}
+
+// AlertSpec is the condition extracted from an alert description.
+type AlertSpec struct {
+	Name      string        `json:"name"`
+	Measure   string        `json:"measure"`
+	Operator  string        `json:"operator"`
+	Threshold float64       `json:"threshold"`
+	Percent   bool          `json:"percent,omitempty"`
+	For       time.Duration `json:"for"`
+	Severity  string        `json:"severity"`
+}
+
+// ParseAlert extracts what to measure, the comparison and how long it must
+// hold from a description such as "alert when checkout error rate is above
+// 5% for 10 minutes".
+func ParseAlert(text string) (*AlertSpec, error) {
+	text = strings.TrimSpace(text)
+	m := conditionPattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil, ErrNoCondition
+	}
+
+	threshold, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold %q: %w", m[3], err)
+	}
+
+	spec := &AlertSpec{
+		Measure:   strings.TrimSpace(m[1]),
+		Operator:  operators[strings.ToLower(m[2])],
+		Threshold: threshold,
+		Severity:  SeverityWarning,
+	}
+	switch unit := strings.ToLower(m[4]); {
+	case unit == "%" || unit == "percent":
+		spec.Percent = true
+	case strings.HasPrefix(unit, "m"):
+		// Prometheus measures durations in seconds.
+		spec.Threshold /= 1000
+	}
+
+	if f := forPattern.FindStringSubmatch(text); f != nil {
+		n, _ := strconv.Atoi(f[1])
+		spec.For = time.Duration(n) * durationUnit(f[2])
+	}
+
+	if s := severityPattern.FindString(text); s != "" {
+		switch strings.ToLower(s) {
+		case "critical", "page", "paging":
+			spec.Severity = SeverityCritical
+		default:
+			spec.Severity = strings.ToLower(s)
+		}
+	}
+
+	direction := "High"
+	if spec.Operator == "<" || spec.Operator == "<=" {
+		direction = "Low"
+	}
+	spec.Name = alertName(spec.Measure) + direction
+	return spec, nil
+}
+
+func durationUnit(unit string) time.Duration {
+	switch strings.ToLower(unit)[0] {
+	case 's':
+		return time.Second
+	case 'h':
+		return time.Hour
+	case 'd':
+		return 24 * time.Hour
+	}
+	return time.Minute
+}
+
+// alertName turns a measure such as "the checkout error rate" into
+// CheckoutErrorRate.
+func alertName(measure string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(measure, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		switch strings.ToLower(word) {
+		case "the", "a", "an", "of", "for", "in", "on":
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	if b.Len() == 0 {
+		return "Generated"
+	}
+	return b.String()
+}
+
+// AlertOptions overrides parts of the generated rule.
+type AlertOptions struct {
+	Group    string
+	Severity string
+}
+
+// AlertResult is a generated alerting rule with its rule file and the
+// problems Prometheus would report when loading it.
+type AlertResult struct {
+	Spec             *AlertSpec `json:"spec"`
+	PromQL           string     `json:"promql"`
+	Rule             Rule       `json:"rule"`
+	File             *File      `json:"-"`
+	YAML             string     `json:"yaml"`
+	ValidationErrors []string   `json:"validation_errors,omitempty"`
+}
+
+// AlertGenerator turns alert descriptions into alerting rules, converting
+// the measured quantity with the same pipeline as /convert.
+type AlertGenerator struct {
+	pipeline *agent.Pipeline
+	llm      provider.Provider
+}
+
+func NewAlertGenerator(pipeline *agent.Pipeline, llm provider.Provider) *AlertGenerator {
+	return &AlertGenerator{pipeline: pipeline, llm: llm}
+}
+
+func (g *AlertGenerator) Generate(ctx context.Context, text string, opts AlertOptions) (*AlertResult, error) {
+	spec, err := ParseAlert(text)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Severity != "" {
+		spec.Severity = opts.Severity
+	}
+	group := opts.Group
+	if group == "" {
+		group = DefaultAlertGroup
+	}
+
+	converted, err := g.pipeline.Convert(ctx, spec.Measure, agent.ConvertOptions{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("converting %q: %w", spec.Measure, err)
+	}
+
+	expr, err := parser.ParseExpr(converted.PromQL)
+	if err != nil {
+		return nil, fmt.Errorf("generated query does not parse: %w", err)
+	}
+
+	// Suggest only looks at the query here, for its unit and grouping.
+	empty := &prometheus.QueryResult{}
+	metrics, _ := g.pipeline.Metrics(ctx)
+	unit := chart.Suggest(converted.PromQL, empty, metrics).Unit
+	threshold := spec.Threshold
+	if spec.Percent && unit != "percent" {
+		threshold /= 100
+	}
+
+	lhs := converted.PromQL
+	if _, ok := expr.(*parser.BinaryExpr); ok {
+		lhs = "(" + lhs + ")"
+	}
+
+	rule := Rule{
+		Alert:  spec.Name,
+		Expr:   fmt.Sprintf("%s %s %s", lhs, spec.Operator, strconv.FormatFloat(threshold, 'g', -1, 64)),
+		For:    model.Duration(spec.For),
+		Labels: map[string]string{"severity": spec.Severity},
+	}
+	rule.Annotations = g.annotations(ctx, spec, rule, unit, groupingLabels(expr))
+
+	file := &File{Groups: []Group{{Name: group, Rules: []Rule{rule}}}}
+	content, err := file.YAML()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AlertResult{
+		Spec:             spec,
+		PromQL:           converted.PromQL,
+		Rule:             rule,
+		File:             file,
+		YAML:             string(content),
+		ValidationErrors: file.Validate(),
+	}, nil
+}
+
+// annotations writes the summary and a runbook-style description. Label
+// values are filled in by Prometheus through $labels templating.
+func (g *AlertGenerator) annotations(ctx context.Context, spec *AlertSpec, rule Rule, unit string, labels []string) map[string]string {
+	value := "{{ $value | humanize }}"
+	threshold := strconv.FormatFloat(spec.Threshold, 'g', -1, 64)
+	switch {
+	case unit == "percentunit":
+		value = "{{ $value | humanizePercentage }}"
+		threshold += "%"
+	case unit == "s":
+		value = "{{ $value | humanizeDuration }}"
+	case spec.Percent:
+		threshold += "%"
+	}
+
+	subject := spec.Measure
+	if len(labels) > 0 {
+		parts := make([]string, len(labels))
+		for i, l := range labels {
+			parts[i] = fmt.Sprintf("%s {{ $labels.%s }}", l, l)
+		}
+		subject = fmt.Sprintf("%s for %s", spec.Measure, strings.Join(parts, ", "))
+	}
+
+	comparison := "above"
+	if spec.Operator == "<" || spec.Operator == "<=" {
+		comparison = "below"
+	}
+	summary := fmt.Sprintf("%s is %s %s", upperFirst(subject), comparison, threshold)
+
+	description := fmt.Sprintf("%s is %s, %s the threshold of %s", upperFirst(subject), value, comparison, threshold)
+	if spec.For > 0 {
+		description += fmt.Sprintf(", for more than %s", model.Duration(spec.For))
+	}
+	description += ".\n\n" + g.runbook(ctx, spec, rule, labels)
+
+	return map[string]string{
+		"summary":     summary,
+		"description": description,
+	}
+}
+
+// runbook asks the LLM for first investigation steps and falls back to
+// generic ones.
+func (g *AlertGenerator) runbook(ctx context.Context, spec *AlertSpec, rule Rule, labels []string) string {
+	if g.llm != nil {
+		prompt := fmt.Sprintf(ai.PromptMap["AlertRunbook"], rule.Alert, spec.Measure, rule.Expr)
+		if steps, err := g.llm.Complete(ctx, prompt); err == nil && strings.TrimSpace(steps) != "" {
+			// Go templates would try to expand stray braces.
+			steps = strings.NewReplacer("{{", "{ {", "}}", "} }").Replace(strings.TrimSpace(steps))
+			return "Runbook:\n" + steps
+		}
+	}
+
+	scope := "the affected series"
+	if len(labels) > 0 {
+		scope = "the affected " + strings.Join(labels, ", ")
+	}
+	return strings.Join([]string{
+		"Runbook:",
+		fmt.Sprintf("1. Confirm the alert by graphing: %s", rule.Expr),
+		fmt.Sprintf("2. Check whether %s changed recently, such as a deploy or config change.", scope),
+		"3. Compare with dependent services and infrastructure metrics over the same window.",
+		"4. Mitigate (roll back, scale out or fail over), then tune the threshold if the alert was noise.",
+	}, "\n")
+}
+
+// groupingLabels returns the labels the query's outer aggregation keeps.
+func groupingLabels(expr parser.Expr) []string {
+	for {
+		switch e := expr.(type) {
+		case *parser.ParenExpr:
+			expr = e.Expr
+		case *parser.BinaryExpr:
+			expr = e.LHS
+		case *parser.AggregateExpr:
+			if e.Without {
+				return nil
+			}
+			return e.Grouping
+		default:
+			return nil
+		}
+	}
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
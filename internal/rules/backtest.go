@@ -0,0 +1,99 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Backtest reports how often an alerting rule would have fired over a past
+// range.
+type Backtest struct {
+	Start   time.Time        `json:"start"`
+	End     time.Time        `json:"end"`
+	Step    model.Duration   `json:"step"`
+	Firings int              `json:"firings"`
+	Series  []SeriesBacktest `json:"series,omitempty"`
+}
+
+type SeriesBacktest struct {
+	Labels   map[string]string `json:"labels"`
+	Episodes []Episode         `json:"episodes"`
+}
+
+// Episode is one period during which the alert would have been firing.
+type Episode struct {
+	Start time.Time      `json:"start"`
+	End   time.Time      `json:"end"`
+	For   model.Duration `json:"for"`
+}
+
+// maxBacktestPoints stays below the 11,000 points per series Prometheus
+// allows in a range query.
+const maxBacktestPoints = 10000
+
+// BacktestStep picks a resolution fine enough to resolve holdFor, within the
+// points Prometheus returns for window.
+func BacktestStep(window, holdFor time.Duration) time.Duration {
+	step := time.Minute
+	if holdFor > 0 && holdFor/2 < step {
+		step = holdFor / 2
+	}
+	if min := window / maxBacktestPoints; step < min {
+		step = min
+	}
+	if step < 15*time.Second {
+		step = 15 * time.Second
+	}
+	return step.Truncate(time.Second)
+}
+
+// BacktestAlert evaluates rule.Expr over [start, end] and replays the
+// pending-then-firing logic of the rule manager at the given step: a series
+// fires once its expression has returned a value continuously for rule.For.
+func BacktestAlert(ctx context.Context, client *prometheus.Client, rule Rule, start, end time.Time, step time.Duration) (*Backtest, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	result, err := client.QueryRange(ctx, rule.Expr, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("backtest query failed: %w", err)
+	}
+
+	bt := &Backtest{Start: start, End: end, Step: model.Duration(step)}
+	holdFor := time.Duration(rule.For)
+	for _, series := range result.Series() {
+		episodes := firingEpisodes(series.Samples, step, holdFor)
+		if len(episodes) == 0 {
+			continue
+		}
+		bt.Firings += len(episodes)
+		bt.Series = append(bt.Series, SeriesBacktest{Labels: series.Labels, Episodes: episodes})
+	}
+	return bt, nil
+}
+
+// firingEpisodes splits samples into runs without gaps and keeps the runs
+// that lasted at least holdFor.
+func firingEpisodes(samples []prometheus.Sample, step, holdFor time.Duration) []Episode {
+	var episodes []Episode
+	runStart := 0
+	for i := 1; i <= len(samples); i++ {
+		if i < len(samples) && samples[i].At.Sub(samples[i-1].At) <= step {
+			continue
+		}
+		first, last := samples[runStart].At, samples[i-1].At
+		if last.Sub(first) >= holdFor {
+			episodes = append(episodes, Episode{
+				Start: first.Add(holdFor),
+				End:   last,
+				For:   model.Duration(last.Sub(first.Add(holdFor))),
+			})
+		}
+		runStart = i
+	}
+	return episodes
+}
@@ -0,0 +1,372 @@
+package rules
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/query"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// DefaultRecordingGroup is the rule group suggested recording rules are
+// placed in.
+const DefaultRecordingGroup = "txt2promql-recording"
+
+// minRecordingCost is the cost above which a single aggregation is worth
+// recording even if it appears only once. An aggregated 5m rate scores 6.
+const minRecordingCost = 6
+
+var nameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// RecordingSuggestion is a recording rule proposed for a subexpression,
+// with how often it was seen and what it costs to evaluate.
+type RecordingSuggestion struct {
+	Rule        Rule    `json:"rule"`
+	Occurrences int     `json:"occurrences"`
+	Cost        float64 `json:"cost"`
+}
+
+// Rewrite is a query rewritten to use recorded series.
+type Rewrite struct {
+	Original  string `json:"original"`
+	Rewritten string `json:"rewritten"`
+}
+
+// RecordingAnalysis is the result of analysing a set of queries.
+type RecordingAnalysis struct {
+	Suggestions []RecordingSuggestion `json:"suggestions"`
+	Rewrites    []Rewrite             `json:"rewrites"`
+	File        *File                 `json:"-"`
+	YAML        string                `json:"yaml"`
+	// Skipped lists queries that could not be parsed.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+type RecordingOptions struct {
+	Group    string
+	Interval time.Duration
+	// MinOccurrences is how often a cheap subexpression must repeat to be
+	// recorded. Defaults to 2.
+	MinOccurrences int
+}
+
+type candidate struct {
+	expr string
+	// key is the normalized expression, so that occurrences differing only
+	// in matcher or grouping order are counted together.
+	key         string
+	name        string
+	cost        float64
+	occurrences int
+}
+
+// AnalyzeRecording finds aggregations over range functions that are either
+// expensive or repeated across queries, proposes recording rules for them
+// named after the level:metric:operations convention, and rewrites the
+// queries to use the recorded series.
+func AnalyzeRecording(queries []string, opts RecordingOptions) (*RecordingAnalysis, error) {
+	if opts.MinOccurrences <= 0 {
+		opts.MinOccurrences = 2
+	}
+	if opts.Group == "" {
+		opts.Group = DefaultRecordingGroup
+	}
+
+	analysis := &RecordingAnalysis{Suggestions: []RecordingSuggestion{}, Rewrites: []Rewrite{}}
+	candidates := make(map[string]*candidate)
+	var parsed []parser.Expr
+	for _, q := range queries {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			continue
+		}
+		expr, err := parser.ParseExpr(q)
+		if err != nil {
+			analysis.Skipped = append(analysis.Skipped, q)
+			continue
+		}
+		parsed = append(parsed, expr)
+
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			agg, ok := node.(*parser.AggregateExpr)
+			if !ok || !recordable(agg) {
+				return nil
+			}
+			key := normalizedKey(agg)
+			if c, ok := candidates[key]; ok {
+				c.occurrences++
+				return nil
+			}
+			candidates[key] = &candidate{expr: agg.String(), key: key, name: recordingName(agg), cost: evaluationCost(agg), occurrences: 1}
+			return nil
+		})
+	}
+
+	var chosen []*candidate
+	for _, c := range candidates {
+		if c.occurrences >= opts.MinOccurrences || c.cost >= minRecordingCost {
+			chosen = append(chosen, c)
+		}
+	}
+	sort.Slice(chosen, func(i, j int) bool {
+		si, sj := float64(chosen[i].occurrences)*chosen[i].cost, float64(chosen[j].occurrences)*chosen[j].cost
+		if si != sj {
+			return si > sj
+		}
+		return chosen[i].expr < chosen[j].expr
+	})
+	uniqueNames(chosen)
+
+	group := Group{Name: opts.Group, Interval: model.Duration(opts.Interval)}
+	for _, c := range chosen {
+		rule := Rule{Record: c.name, Expr: c.expr}
+		group.Rules = append(group.Rules, rule)
+		analysis.Suggestions = append(analysis.Suggestions, RecordingSuggestion{
+			Rule:        rule,
+			Occurrences: c.occurrences,
+			Cost:        c.cost,
+		})
+	}
+
+	names := make(map[string]string, len(chosen))
+	for _, c := range chosen {
+		names[c.key] = c.name
+	}
+	for _, expr := range parsed {
+		original := expr.String()
+		rewritten, ok := rewriteRecorded(expr, names)
+		if !ok {
+			continue
+		}
+		analysis.Rewrites = append(analysis.Rewrites, Rewrite{Original: original, Rewritten: rewritten.String()})
+	}
+
+	if len(group.Rules) == 0 {
+		return analysis, nil
+	}
+	analysis.File = &File{Groups: []Group{group}}
+	content, err := analysis.File.YAML()
+	if err != nil {
+		return nil, err
+	}
+	analysis.YAML = string(content)
+	return analysis, nil
+}
+
+// normalizedKey identifies an aggregation by its normalized expression.
+func normalizedKey(agg *parser.AggregateExpr) string {
+	key, err := query.Normalize(agg.String())
+	if err != nil {
+		return agg.String()
+	}
+	return key
+}
+
+// rewriteRecorded replaces the aggregations in expr that names records with
+// their recorded series. Outer aggregations are matched first, so one is
+// replaced as a whole rather than around a recorded inner one. expr is
+// modified in place; ok reports whether anything was replaced.
+func rewriteRecorded(expr parser.Expr, names map[string]string) (rewritten parser.Expr, ok bool) {
+	if agg, isAgg := expr.(*parser.AggregateExpr); isAgg {
+		if name, recorded := names[normalizedKey(agg)]; recorded {
+			return &parser.VectorSelector{
+				Name:          name,
+				LabelMatchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, name)},
+			}, true
+		}
+	}
+
+	replace := func(child *parser.Expr) {
+		if *child == nil {
+			return
+		}
+		if r, replaced := rewriteRecorded(*child, names); replaced {
+			*child, ok = r, true
+		}
+	}
+	switch n := expr.(type) {
+	case *parser.AggregateExpr:
+		replace(&n.Param)
+		replace(&n.Expr)
+	case *parser.BinaryExpr:
+		replace(&n.LHS)
+		replace(&n.RHS)
+	case *parser.Call:
+		for i := range n.Args {
+			replace(&n.Args[i])
+		}
+	case *parser.ParenExpr:
+		replace(&n.Expr)
+	case *parser.UnaryExpr:
+		replace(&n.Expr)
+	case *parser.SubqueryExpr:
+		replace(&n.Expr)
+	case *parser.StepInvariantExpr:
+		replace(&n.Expr)
+	}
+	return expr, ok
+}
+
+// recordable reports whether agg aggregates a range function such as rate
+// over a plain selector, which is what recording rules are for. Queries
+// pinned with @ are left alone.
+func recordable(agg *parser.AggregateExpr) bool {
+	if agg.Op == parser.TOPK || agg.Op == parser.BOTTOMK || agg.Op == parser.COUNT_VALUES || agg.Op == parser.QUANTILE {
+		return false
+	}
+	hasRange, pinned := false, false
+	parser.Inspect(agg, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.MatrixSelector:
+			hasRange = true
+		case *parser.SubqueryExpr:
+			hasRange = true
+		case *parser.VectorSelector:
+			if n.Timestamp != nil || n.StartOrEnd != 0 {
+				pinned = true
+			}
+		}
+		return nil
+	})
+	return hasRange && !pinned
+}
+
+// evaluationCost estimates the work of evaluating expr: one point per
+// minute of every range read, plus one per aggregation.
+func evaluationCost(expr parser.Node) float64 {
+	var cost float64
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.MatrixSelector:
+			cost += n.Range.Minutes()
+		case *parser.SubqueryExpr:
+			step := n.Step
+			if step == 0 {
+				step = time.Minute
+			}
+			// Every subquery step evaluates the inner expression again.
+			cost += float64(n.Range/step) * evaluationCost(n.Expr)
+		case *parser.AggregateExpr:
+			cost++
+		}
+		return nil
+	})
+	return cost
+}
+
+// recordingName follows the level:metric:operations convention: level is
+// the labels kept by the aggregation ("global" when none), metric is the
+// selected metric without _total for rates, and operations lists what was
+// applied, newest first, leaving out sum.
+func recordingName(agg *parser.AggregateExpr) string {
+	level := "global"
+	switch {
+	case agg.Without && len(agg.Grouping) > 0:
+		level = "without_" + strings.Join(agg.Grouping, "_")
+	case len(agg.Grouping) > 0:
+		level = strings.Join(agg.Grouping, "_")
+	}
+
+	var metric string
+	var ops []string
+	parser.Inspect(agg, func(node parser.Node, path []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			if metric == "" {
+				metric = n.Name + matcherSuffix(n.LabelMatchers)
+			}
+		case *parser.Call:
+			op := n.Func.Name
+			for _, arg := range n.Args {
+				if ms, ok := arg.(*parser.MatrixSelector); ok {
+					op += model.Duration(ms.Range).String()
+				}
+			}
+			ops = append(ops, op)
+		case *parser.AggregateExpr:
+			if n.Op != parser.SUM {
+				ops = append(ops, n.Op.String())
+			}
+		}
+		return nil
+	})
+
+	for _, op := range ops {
+		if strings.HasPrefix(op, "rate") || strings.HasPrefix(op, "irate") || strings.HasPrefix(op, "increase") {
+			metric = strings.Replace(metric, "_total", "", 1)
+			break
+		}
+	}
+
+	// Inspect visits outer nodes first, so ops already lists the newest
+	// operation first.
+	parts := []string{level, metric, strings.Join(ops, "_")}
+	for i, part := range parts {
+		parts[i] = nameSanitizer.ReplaceAllString(part, "_")
+	}
+	return strings.Join(parts, ":")
+}
+
+// matcherSuffix folds equality matchers into the metric part of a name so
+// that differently filtered expressions get different names.
+func matcherSuffix(matchers []*labels.Matcher) string {
+	var parts []string
+	for _, m := range matchers {
+		if m.Name == labels.MetricName || m.Type != labels.MatchEqual || m.Value == "" {
+			continue
+		}
+		parts = append(parts, m.Value)
+	}
+	sort.Strings(parts)
+	if len(parts) == 0 {
+		return ""
+	}
+	return "_" + strings.Join(parts, "_")
+}
+
+// uniqueNames numbers the names of candidates that would otherwise record
+// different expressions under the same name.
+func uniqueNames(candidates []*candidate) {
+	seen := make(map[string]int)
+	for _, c := range candidates {
+		seen[c.name]++
+		if n := seen[c.name]; n > 1 {
+			c.name = fmt.Sprintf("%s_%d", c.name, n)
+		}
+	}
+}
+
+// ReadQueries reads one query per line, or Prometheus query log entries
+// (JSON lines with params.query), skipping blank lines and # comments.
+func ReadQueries(r io.Reader) ([]string, error) {
+	var queries []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{\"") {
+			var entry struct {
+				Params struct {
+					Query string `json:"query"`
+				} `json:"params"`
+			}
+			if err := json.Unmarshal([]byte(line), &entry); err == nil && entry.Params.Query != "" {
+				queries = append(queries, entry.Params.Query)
+				continue
+			}
+		}
+		queries = append(queries, line)
+	}
+	return queries, scanner.Err()
+}
@@ -0,0 +1,64 @@
+// Package rules generates Prometheus alerting and recording rules.
+package rules
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a Prometheus rule file.
+type File struct {
+	Groups []Group `yaml:"groups" json:"groups"`
+}
+
+type Group struct {
+	Name     string         `yaml:"name" json:"name"`
+	Interval model.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Rules    []Rule         `yaml:"rules" json:"rules"`
+}
+
+// Rule is an alerting rule when Alert is set and a recording rule when
+// Record is set.
+type Rule struct {
+	Record      string            `yaml:"record,omitempty" json:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty" json:"alert,omitempty"`
+	Expr        string            `yaml:"expr" json:"expr"`
+	For         model.Duration    `yaml:"for,omitempty" json:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+}
+
+// YAML renders the file in the format Prometheus loads.
+func (f *File) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return nil, fmt.Errorf("encoding rule file: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding rule file: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Validate checks the file with the same parser Prometheus uses when it
+// loads rules, including expressions and annotation templates, and returns
+// the problems found.
+func (f *File) Validate() []string {
+	content, err := f.YAML()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	_, errs := rulefmt.Parse(content)
+	problems := make([]string, 0, len(errs))
+	for _, err := range errs {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
@@ -0,0 +1,537 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// SLI kinds.
+const (
+	SLIAvailability = "availability"
+	SLILatency      = "latency"
+)
+
+// defaultSLOWindow is the compliance window when the description names none.
+const defaultSLOWindow = 30 * 24 * time.Hour
+
+var (
+	ErrNoObjective  = errors.New("no objective found; describe the SLO like \"99.9% of checkout requests succeed over 30 days\"")
+	ErrNoSLIMetrics = errors.New("no success/total or latency histogram metrics found for the SLO")
+)
+
+var (
+	objectivePattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*%`)
+	sloWindowPattern = regexp.MustCompile(`(?i)\b(?:over|in|across|per|within)\s+(?:a\s+|the\s+)?(?:last\s+|rolling\s+|past\s+)?(\d+)\s*(d|days?|w|weeks?|h|hours?)\b`)
+	latencyPattern   = regexp.MustCompile(`(?i)\b(?:within|under|below|faster than|in less than|less than|in under)\s+(\d+(?:\.\d+)?)\s*(ms|milliseconds?|s|secs?|seconds?)\b`)
+	servicePattern   = regexp.MustCompile(`(?i)%\s+of\s+(?:all\s+|the\s+)?(.+?)\s+(?:requests?|calls?|queries|operations|rpcs?)\b`)
+	sloNameSanitizer = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// statusLabels are labels carrying a response status, with the matcher
+// selecting failed requests.
+var statusLabels = []struct{ label, errors string }{
+	{"code", `=~"5.."`},
+	{"status_code", `=~"5.."`},
+	{"status", `=~"5..|error|failed|failure"`},
+	{"response_code", `=~"5.."`},
+	{"grpc_code", `=~"Unknown|DeadlineExceeded|Unimplemented|Internal|Unavailable|DataLoss"`},
+}
+
+// serviceLabels are searched, in order, for the value naming the service.
+var serviceLabels = []string{"service", "job", "app", "application", "handler", "route", "namespace"}
+
+// burnRateWindows are the multi-window, multi-burn-rate alerts from the SRE
+// workbook. An alert fires when both windows burn faster than the rate that
+// would consume BudgetConsumed of the budget within the long window.
+var burnRateWindows = []BurnRateAlert{
+	{Severity: SeverityCritical, Long: model.Duration(time.Hour), Short: model.Duration(5 * time.Minute), BudgetConsumed: 0.02},
+	{Severity: SeverityCritical, Long: model.Duration(6 * time.Hour), Short: model.Duration(30 * time.Minute), BudgetConsumed: 0.05},
+	{Severity: SeverityWarning, Long: model.Duration(24 * time.Hour), Short: model.Duration(2 * time.Hour), BudgetConsumed: 0.1},
+	{Severity: SeverityWarning, Long: model.Duration(72 * time.Hour), Short: model.Duration(6 * time.Hour), BudgetConsumed: 0.1},
+}
+
+// SLOSpec is the objective extracted from an SLO description.
+type SLOSpec struct {
+	Name      string         `json:"name"`
+	Service   string         `json:"service"`
+	Kind      string         `json:"kind"`
+	Objective float64        `json:"objective"`
+	Window    model.Duration `json:"window"`
+	// Latency is the threshold requests must complete within, for latency
+	// SLOs.
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+// ParseSLO extracts the objective, window and service from a description
+// such as "99.9% of checkout requests succeed over 30 days" or "99% of
+// search requests complete within 300ms".
+func ParseSLO(text string) (*SLOSpec, error) {
+	m := objectivePattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil, ErrNoObjective
+	}
+	percent, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return nil, fmt.Errorf("objective must be between 0%% and 100%%, got %s%%", m[1])
+	}
+
+	spec := &SLOSpec{
+		Kind:      SLIAvailability,
+		Objective: round(percent / 100),
+		Window:    model.Duration(defaultSLOWindow),
+	}
+	if w := sloWindowPattern.FindStringSubmatch(text); w != nil {
+		n, _ := strconv.Atoi(w[1])
+		unit := durationUnit(w[2])
+		if strings.HasPrefix(strings.ToLower(w[2]), "w") {
+			unit = 7 * 24 * time.Hour
+		}
+		spec.Window = model.Duration(time.Duration(n) * unit)
+	}
+	if l := latencyPattern.FindStringSubmatch(text); l != nil {
+		v, _ := strconv.ParseFloat(l[1], 64)
+		unit := time.Second
+		if strings.HasPrefix(strings.ToLower(l[2]), "m") {
+			unit = time.Millisecond
+		}
+		spec.Kind = SLILatency
+		spec.Latency = time.Duration(v * float64(unit))
+	}
+	if s := servicePattern.FindStringSubmatch(text); s != nil {
+		spec.Service = strings.ToLower(strings.TrimSpace(s[1]))
+	}
+
+	spec.Name = sloName(spec.Service, spec.Kind)
+	return spec, nil
+}
+
+// sloName names an SLO after its service and kind, e.g.
+// checkout-availability.
+func sloName(service, kind string) string {
+	if service == "" {
+		service = "service"
+	}
+	return sloNameSanitizer.ReplaceAllString(strings.ReplaceAll(service, " ", "-"), "-") + "-" + kind
+}
+
+// SLI is the pair of series an SLO is measured with. Availability SLIs count
+// Errors against Total; latency SLIs count Good requests, those within the
+// threshold, against Total.
+type SLI struct {
+	Errors string   `json:"errors,omitempty"`
+	Good   string   `json:"good,omitempty"`
+	Total  string   `json:"total"`
+	Notes  []string `json:"notes,omitempty"`
+}
+
+// DiscoverSLI picks the request counter or latency histogram for spec from
+// the schema, filtered to the service when a label names it.
+func DiscoverSLI(spec *SLOSpec, metrics map[string]prometheus.MetricSchema) (*SLI, error) {
+	if spec.Kind == SLILatency {
+		return discoverLatencySLI(spec, metrics)
+	}
+	return discoverAvailabilitySLI(spec, metrics)
+}
+
+func discoverAvailabilitySLI(spec *SLOSpec, metrics map[string]prometheus.MetricSchema) (*SLI, error) {
+	type scored struct {
+		name, status string
+		score        int
+	}
+	var ranked []scored
+	for name, schema := range metrics {
+		if !strings.HasSuffix(name, "_total") || strings.Contains(name, "error") || strings.Contains(name, "fail") {
+			continue
+		}
+		if !strings.Contains(name, "request") && !strings.Contains(name, "handled") {
+			continue
+		}
+		s := scored{name: name, score: serviceScore(spec.Service, name, schema)}
+		for _, sl := range statusLabels {
+			if _, ok := schema.LabelValues[sl.label]; ok {
+				s.status = sl.label
+				s.score += 2
+				break
+			}
+		}
+		if s.status == "" && companionErrors(name, metrics) == "" {
+			continue
+		}
+		ranked = append(ranked, s)
+	}
+	if len(ranked) == 0 {
+		return nil, ErrNoSLIMetrics
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].name < ranked[j].name
+	})
+
+	best := ranked[0]
+	matchers, notes := serviceMatchers(spec.Service, metrics[best.name])
+	sli := &SLI{Total: selector(best.name, matchers...), Notes: notes}
+	if best.status != "" {
+		for _, sl := range statusLabels {
+			if sl.label == best.status {
+				sli.Errors = selector(best.name, append(matchers, sl.label+sl.errors)...)
+			}
+		}
+	} else {
+		errorsMetric := companionErrors(best.name, metrics)
+		sli.Errors = selector(errorsMetric, matchers...)
+	}
+	return sli, nil
+}
+
+// companionErrors returns the error counter published next to a request
+// counter, such as http_requests_failed_total for http_requests_total.
+func companionErrors(name string, metrics map[string]prometheus.MetricSchema) string {
+	base := strings.TrimSuffix(name, "_total")
+	for _, candidate := range []string{
+		base + "_errors_total", base + "_failed_total", base + "_failures_total",
+		strings.TrimSuffix(base, "s") + "_errors_total",
+		strings.Replace(base, "requests", "errors", 1) + "_total",
+	} {
+		if _, ok := metrics[candidate]; ok && candidate != name {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func discoverLatencySLI(spec *SLOSpec, metrics map[string]prometheus.MetricSchema) (*SLI, error) {
+	best, bestScore := "", -1
+	for name, schema := range metrics {
+		if !strings.HasSuffix(name, "_bucket") {
+			continue
+		}
+		if !strings.Contains(name, "duration") && !strings.Contains(name, "latency") {
+			continue
+		}
+		score := serviceScore(spec.Service, name, schema)
+		if strings.Contains(name, "request") {
+			score++
+		}
+		if score > bestScore || score == bestScore && name < best {
+			best, bestScore = name, score
+		}
+	}
+	if best == "" {
+		return nil, ErrNoSLIMetrics
+	}
+
+	schema := metrics[best]
+	matchers, notes := serviceMatchers(spec.Service, schema)
+
+	threshold := spec.Latency.Seconds()
+	le := strconv.FormatFloat(threshold, 'g', -1, 64)
+	if bucket, ok := nearestBucket(schema.LabelValues["le"], threshold); ok && bucket != threshold {
+		le = strconv.FormatFloat(bucket, 'g', -1, 64)
+		notes = append(notes, fmt.Sprintf("%s has no bucket at %gs; using the next larger bucket, %ss", best, threshold, le))
+	} else if ok {
+		// Use the value exactly as exported; "0.3" and "0.30" are different
+		// label values.
+		for _, v := range schema.LabelValues["le"] {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f == threshold {
+				le = v
+			}
+		}
+	}
+
+	total := strings.TrimSuffix(best, "_bucket") + "_count"
+	return &SLI{
+		Good:  selector(best, append(matchers, `le="`+le+`"`)...),
+		Total: selector(total, matchers...),
+		Notes: notes,
+	}, nil
+}
+
+// nearestBucket returns the smallest bucket bound at or above threshold.
+func nearestBucket(values []string, threshold float64) (float64, bool) {
+	best, found := math.Inf(1), false
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 1) || f < threshold {
+			continue
+		}
+		if f < best {
+			best, found = f, true
+		}
+	}
+	return best, found
+}
+
+func serviceScore(service, name string, schema prometheus.MetricSchema) int {
+	if service == "" {
+		return 0
+	}
+	score := 0
+	for _, word := range strings.Fields(service) {
+		if strings.Contains(name, word) {
+			score += 3
+		}
+	}
+	if m, _ := serviceMatchers(service, schema); len(m) > 0 {
+		score += 2
+	}
+	return score
+}
+
+// serviceMatchers filters to the service through the first label whose
+// values mention it.
+func serviceMatchers(service string, schema prometheus.MetricSchema) ([]string, []string) {
+	if service == "" {
+		return nil, nil
+	}
+	word := strings.ReplaceAll(service, " ", "-")
+	for _, label := range serviceLabels {
+		var matched []string
+		for _, v := range schema.LabelValues[label] {
+			if strings.EqualFold(v, word) {
+				return []string{label + `="` + v + `"`}, nil
+			}
+			if strings.Contains(strings.ToLower(v), word) {
+				matched = append(matched, v)
+			}
+		}
+		if len(matched) == 1 {
+			return []string{label + `="` + matched[0] + `"`}, nil
+		}
+		if len(matched) > 1 {
+			return []string{label + `=~".*` + regexp.QuoteMeta(word) + `.*"`},
+				[]string{fmt.Sprintf("%s matches several %s values: %s", service, label, strings.Join(matched, ", "))}
+		}
+	}
+	return nil, []string{fmt.Sprintf("no label of %s names %q; the SLI covers every series", schema.Name, service)}
+}
+
+func selector(name string, matchers ...string) string {
+	if len(matchers) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// BurnRateAlert is one window pair of the multi-window burn-rate alerts.
+type BurnRateAlert struct {
+	Severity       string         `json:"severity"`
+	Long           model.Duration `json:"long_window"`
+	Short          model.Duration `json:"short_window"`
+	BudgetConsumed float64        `json:"budget_consumed"`
+	// Factor is the burn rate, relative to the sustainable one, the alert
+	// fires at.
+	Factor float64 `json:"factor"`
+}
+
+// SLOQueries are ad hoc queries that work before the rules are loaded.
+type SLOQueries struct {
+	SLI                  string `json:"sli"`
+	ErrorRatio           string `json:"error_ratio"`
+	ErrorBudgetRemaining string `json:"error_budget_remaining"`
+	BurnRate             string `json:"burn_rate"`
+}
+
+// SLOResult holds the queries and rule file generated for an SLO.
+type SLOResult struct {
+	Spec             *SLOSpec        `json:"spec"`
+	SLI              *SLI            `json:"sli"`
+	Queries          SLOQueries      `json:"queries"`
+	BurnRates        []BurnRateAlert `json:"burn_rates"`
+	File             *File           `json:"-"`
+	YAML             string          `json:"yaml"`
+	ValidationErrors []string        `json:"validation_errors,omitempty"`
+}
+
+// BuildSLO generates the SLI, error budget and burn-rate queries for spec,
+// the recording rules for every window the alerts read, and the alerts.
+// Recorded series are named slo:sli_error:ratio_rate<window> and carry an
+// slo label.
+func BuildSLO(spec *SLOSpec, sli *SLI) (*SLOResult, error) {
+	budget := round(1 - spec.Objective)
+	window := time.Duration(spec.Window)
+
+	errorRatio := func(w model.Duration) string {
+		if sli.Good != "" {
+			return fmt.Sprintf("1 - (sum(rate(%s[%s])) / sum(rate(%s[%s])))", sli.Good, w, sli.Total, w)
+		}
+		return fmt.Sprintf("sum(rate(%s[%s])) / sum(rate(%s[%s]))", sli.Errors, w, sli.Total, w)
+	}
+	recorded := func(w model.Duration) string {
+		return fmt.Sprintf(`slo:sli_error:ratio_rate%s{slo="%s"}`, w, spec.Name)
+	}
+
+	result := &SLOResult{
+		Spec: spec,
+		SLI:  sli,
+		Queries: SLOQueries{
+			SLI:                  fmt.Sprintf("1 - (%s)", errorRatio(model.Duration(5*time.Minute))),
+			ErrorRatio:           errorRatio(spec.Window),
+			ErrorBudgetRemaining: fmt.Sprintf("1 - ((%s) / %s)", errorRatio(spec.Window), formatFloat(budget)),
+			BurnRate:             fmt.Sprintf("(%s) / %s", errorRatio(model.Duration(time.Hour)), formatFloat(budget)),
+		},
+	}
+
+	windows := map[model.Duration]bool{}
+	for _, br := range burnRateWindows {
+		if time.Duration(br.Long) >= window {
+			continue
+		}
+		br.Factor = round(br.BudgetConsumed * window.Hours() / time.Duration(br.Long).Hours())
+		result.BurnRates = append(result.BurnRates, br)
+		windows[br.Long], windows[br.Short] = true, true
+	}
+	if len(result.BurnRates) == 0 {
+		return nil, fmt.Errorf("SLO window %s is too short for burn-rate alerts", spec.Window)
+	}
+
+	sorted := make([]model.Duration, 0, len(windows))
+	for w := range windows {
+		sorted = append(sorted, w)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	sloLabel := map[string]string{"slo": spec.Name}
+	sliGroup := Group{Name: "slo:" + spec.Name + ":sli"}
+	for _, w := range sorted {
+		sliGroup.Rules = append(sliGroup.Rules, Rule{
+			Record: "slo:sli_error:ratio_rate" + w.String(),
+			Expr:   errorRatio(w),
+			Labels: sloLabel,
+		})
+	}
+
+	// Reading the whole window of raw counters on every evaluation is
+	// expensive, so the window ratio averages the shortest recorded ratio.
+	shortest := recorded(sorted[0])
+	budgetGroup := Group{
+		Name:     "slo:" + spec.Name + ":budget",
+		Interval: model.Duration(5 * time.Minute),
+		Rules: []Rule{
+			{
+				Record: "slo:sli_error:ratio_rate" + spec.Window.String(),
+				Expr:   fmt.Sprintf("sum_over_time(%s[%s]) / count_over_time(%s[%s])", shortest, spec.Window, shortest, spec.Window),
+				Labels: sloLabel,
+			},
+			{
+				Record: "slo:objective:ratio",
+				Expr:   fmt.Sprintf("vector(%s)", formatFloat(spec.Objective)),
+				Labels: sloLabel,
+			},
+			{
+				Record: "slo:error_budget_remaining:ratio",
+				Expr:   fmt.Sprintf("1 - (%s / %s)", recorded(spec.Window), formatFloat(budget)),
+				Labels: sloLabel,
+			},
+		},
+	}
+
+	alertGroup := Group{Name: "slo:" + spec.Name + ":alerts"}
+	for _, severity := range []string{SeverityCritical, SeverityWarning} {
+		var conditions []string
+		var windowNames []string
+		for _, br := range result.BurnRates {
+			if br.Severity != severity {
+				continue
+			}
+			threshold := fmt.Sprintf("(%s * %s)", formatFloat(br.Factor), formatFloat(budget))
+			conditions = append(conditions, fmt.Sprintf("(%s > %s and %s > %s)",
+				recorded(br.Long), threshold, recorded(br.Short), threshold))
+			windowNames = append(windowNames, fmt.Sprintf("%s/%s at %gx", br.Long, br.Short, br.Factor))
+		}
+		if len(conditions) == 0 {
+			continue
+		}
+
+		name := alertName(spec.Name) + "BurnRateCritical"
+		burning := "fast"
+		if severity == SeverityWarning {
+			name = alertName(spec.Name) + "BurnRateWarning"
+			burning = "steadily"
+		}
+		alertGroup.Rules = append(alertGroup.Rules, Rule{
+			Alert:  name,
+			Expr:   strings.Join(conditions, "\nor\n"),
+			Labels: map[string]string{"severity": severity, "slo": spec.Name},
+			Annotations: map[string]string{
+				"summary": fmt.Sprintf("%s SLO is burning its error budget %s", spec.Name, burning),
+				"description": fmt.Sprintf("The %s SLO (%s over %s) is consuming its error budget too quickly (windows %s). "+
+					"Error budget remaining: {{ with printf `slo:error_budget_remaining:ratio{slo=\"%s\"}` | query }}{{ . | first | value | humanizePercentage }}{{ end }}.",
+					spec.Name, formatFloat(spec.Objective*100)+"%", spec.Window, strings.Join(windowNames, ", "), spec.Name),
+			},
+		})
+	}
+
+	result.File = &File{Groups: []Group{sliGroup, budgetGroup, alertGroup}}
+	content, err := result.File.YAML()
+	if err != nil {
+		return nil, err
+	}
+	result.YAML = string(content)
+	result.ValidationErrors = result.File.Validate()
+	return result, nil
+}
+
+// SLOOptions overrides SLI discovery with explicit selectors.
+type SLOOptions struct {
+	Errors string
+	Good   string
+	Total  string
+}
+
+// SLOGenerator turns SLO descriptions into queries and rules, discovering
+// the SLI metrics from the pipeline's schema.
+type SLOGenerator struct {
+	pipeline *agent.Pipeline
+}
+
+func NewSLOGenerator(pipeline *agent.Pipeline) *SLOGenerator {
+	return &SLOGenerator{pipeline: pipeline}
+}
+
+func (g *SLOGenerator) Generate(ctx context.Context, text string, opts SLOOptions) (*SLOResult, error) {
+	spec, err := ParseSLO(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sli := &SLI{Errors: opts.Errors, Good: opts.Good, Total: opts.Total}
+	if sli.Total == "" || sli.Errors == "" && sli.Good == "" {
+		metrics, err := g.pipeline.Metrics(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", agent.ErrSchemaUnavailable, err)
+		}
+		if sli, err = DiscoverSLI(spec, metrics); err != nil {
+			return nil, err
+		}
+	} else {
+		// Explicit selectors decide the kind, whatever the text implied.
+		spec.Kind = SLIAvailability
+		if sli.Good != "" {
+			spec.Kind = SLILatency
+		}
+		spec.Name = sloName(spec.Service, spec.Kind)
+	}
+	return BuildSLO(spec, sli)
+}
+
+// round trims floating point noise such as 1 - 0.999 = 0.0010000000000000009.
+func round(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultBacktestWindow is the range an alert is backtested over when the
+// request names none.
+const defaultBacktestWindow = 7 * 24 * time.Hour
+
+type AlertRequest struct {
+	Description string `json:"description"`
+	Group       string `json:"group,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	// Backtest, when set, replays the rule over a past range.
+	Backtest *TimeRangeParams `json:"backtest,omitempty"`
+}
+
+type AlertResponse struct {
+	*rules.AlertResult
+	Backtest      *rules.Backtest `json:"backtest,omitempty"`
+	BacktestError string          `json:"backtest_error,omitempty"`
+}
+
+// HandleAlert generates an alerting rule group from a description such as
+// "alert when checkout error rate is above 5% for 10 minutes".
+func (h *Handlers) HandleAlert(c echo.Context) error {
+	var req AlertRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Description cannot be empty")
+	}
+
+	ctx := c.Request().Context()
+	result, err := h.alerts.Generate(ctx, req.Description, rules.AlertOptions{
+		Group:    req.Group,
+		Severity: req.Severity,
+	})
+	var apiErr *prometheus.APIError
+	switch {
+	case errors.Is(err, agent.ErrSchemaUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, convertErrorMessage(err))
+	case errors.As(err, &apiErr):
+		return prometheusError(err)
+	case errors.Is(err, agent.ErrContextExtraction), errors.Is(err, agent.ErrNoPromQL):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, convertErrorMessage(err))
+	case err != nil:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	resp := AlertResponse{AlertResult: result}
+	if req.Backtest != nil && len(result.ValidationErrors) == 0 {
+		start, end, step, err := req.Backtest.timeRange(time.Now(), defaultBacktestWindow)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if req.Backtest.Step == "" {
+			step = rules.BacktestStep(end.Sub(start), time.Duration(result.Rule.For))
+		}
+		ds, err := h.datasource(ctx, "", result.Rule.Expr, end.Sub(start))
+		if err != nil {
+			return err
+		}
+		resp.Backtest, err = rules.BacktestAlert(ctx, ds.Client, result.Rule, start, end, step)
+		if err != nil {
+			resp.BacktestError = err.Error()
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/session"
+)
+
+func TestAlertBacktestRoutesToDatasource(t *testing.T) {
+	sources, err := prometheus.NewRegistry([]prometheus.DatasourceConfig{
+		{Name: "eu", Address: startFake(t, "load 1m\n  up{job=\"api\"} 1x60\n"), Default: true},
+		{Name: "us", Address: startFake(t, "load 1m\n  node_load1{instance=\"n1\"} 2x60\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm, _ := mock.New([]mock.Rule{{
+		Pattern:  `Query: node load$`,
+		Response: `{"metric": "node_load1", "labels": {}}`,
+	}}, nil, "explanation")
+	h := New(sources, llm, session.NewMemoryStore(time.Hour))
+
+	start := promtest.Start.Format(time.RFC3339)
+	end := promtest.Start.Add(time.Hour).Format(time.RFC3339)
+	rec, err := call(h.HandleAlert, http.MethodPost, "/api/v1/alert",
+		`{"description": "alert when node load is above 1 for 5 minutes", "backtest": {"start": "`+start+`", "end": "`+end+`"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp AlertResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// The default datasource has no node_load1, so no firing means the
+	// backtest ran there.
+	if resp.BacktestError != "" || resp.Backtest == nil || resp.Backtest.Firings != 1 {
+		t.Fatalf("got backtest %+v (%s), want one firing on us", resp.Backtest, resp.BacktestError)
+	}
+}
+
+func TestAlertErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		wantStatus  int
+	}{
+		{"no condition", "checkout is slow", http.StatusBadRequest},
+		{"no query", "alert when nothing known is above 5", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t)
+			_, err := call(h.HandleAlert, http.MethodPost, "/api/v1/alert", `{"description": "`+tt.description+`"}`)
+			if status := httpStatus(err); err == nil || status != tt.wantStatus {
+				t.Fatalf("got %d (%v), want %d", status, err, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/chart"
+	parser "github.com/agentkube/txt2promql/internal/core/parser"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// defaultAskWindow is the range shown for trend questions that do not name
+// a time frame.
+const defaultAskWindow = time.Hour
+
+var askWindows = map[string]time.Duration{
+	"last_hour": time.Hour,
+	"last_day":  24 * time.Hour,
+	"last_week": 7 * 24 * time.Hour,
+}
+
+type AskRequest struct {
+	Question string     `json:"question"`
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	Step     string     `json:"step,omitempty"`
+	// Timeout bounds the whole request, conversion included. It can only
+	// shorten the server timeout.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type AskResponse struct {
+	Status         string                       `json:"status"`
+	PromQL         string                       `json:"promql"`
+	Explanation    string                       `json:"explanation,omitempty"`
+	Validation     *prometheus.ValidationResult `json:"validation,omitempty"`
+	Confidence     *agent.Confidence            `json:"confidence,omitempty"`
+	QueryType      string                       `json:"query_type,omitempty"`
+	Data           *prometheus.QueryResult      `json:"data,omitempty"`
+	SuggestedChart *chart.Suggestion            `json:"suggestedChart,omitempty"`
+	Answer         string                       `json:"answer"`
+}
+
+// Ask statuses.
+const (
+	StatusConversionFailed = "conversion_failed"
+	StatusInvalidQuery     = "invalid_query"
+	StatusExecutionFailed  = "execution_failed"
+)
+
+// HandleAsk converts a question, validates and executes the query, and
+// answers the question from the result in a single call. Every stage shares
+// one deadline; a timeout anywhere returns 504.
+func (h *Handlers) HandleAsk(c echo.Context) error {
+	var req AskRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+	if strings.TrimSpace(req.Question) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Question cannot be empty")
+	}
+	if (req.Start == nil) != (req.End == nil) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Start and end must be set together")
+	}
+
+	timeout := viper.GetDuration("server.timeout")
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid timeout")
+		}
+		if timeout == 0 || d < timeout {
+			timeout = d
+		}
+	}
+
+	var step time.Duration
+	if req.Step != "" {
+		d, err := time.ParseDuration(req.Step)
+		if err != nil || d <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid step")
+		}
+		step = d
+	}
+
+	ctx := c.Request().Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start, end, isRange := askRange(req, step)
+	result, err := h.pipeline.Convert(ctx, req.Question, agent.ConvertOptions{Lookback: end.Sub(start)}, nil)
+	if err := askContextError(ctx); err != nil {
+		return err
+	}
+	var apiErr *prometheus.APIError
+	switch {
+	case errors.Is(err, agent.ErrSchemaUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, convertErrorMessage(err))
+	case errors.As(err, &apiErr):
+		return prometheusError(err)
+	case err != nil:
+		return c.JSON(http.StatusOK, AskResponse{
+			Status: StatusConversionFailed,
+			Answer: convertErrorMessage(err),
+		})
+	}
+
+	resp := AskResponse{
+		Status:      StatusOK,
+		PromQL:      result.PromQL,
+		Explanation: result.Explanation,
+		Validation:  result.Validation,
+		Confidence:  result.Confidence,
+	}
+	if !result.Validation.Valid {
+		resp.Status = StatusInvalidQuery
+		resp.Answer = fmt.Sprintf("The generated query was rejected by Prometheus: %s", result.Validation.Error)
+		return c.JSON(http.StatusOK, resp)
+	}
+
+	ds, err := h.datasource(ctx, result.Datasource, result.PromQL, end.Sub(start))
+	if err != nil {
+		return err
+	}
+	var data *prometheus.QueryResult
+	if isRange {
+		if step == 0 {
+			step = chart.DefaultStep(end.Sub(start))
+		}
+		resp.QueryType = "range"
+		data, err = ds.Client.QueryRange(ctx, result.PromQL, start, end, step)
+	} else {
+		resp.QueryType = "instant"
+		data, err = ds.Client.QueryInstant(ctx, result.PromQL, nil)
+	}
+	if err := askContextError(ctx); err != nil {
+		return err
+	}
+	if err != nil {
+		resp.Status = StatusExecutionFailed
+		resp.Answer = fmt.Sprintf("Query execution failed: %v", err)
+		return c.JSON(http.StatusOK, resp)
+	}
+
+	suggestion := h.suggestChart(ctx, result.PromQL, data)
+	resp.Data = data
+	resp.SuggestedChart = &suggestion
+	resp.Answer = h.summarizer.Summarize(ctx, req.Question, result.PromQL, data)
+	if err := askContextError(ctx); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// askRange decides between an instant and a range query. An explicit time
+// range or step always means a range query; otherwise the question decides,
+// with trend questions covering the time frame they name.
+func askRange(req AskRequest, step time.Duration) (time.Time, time.Time, bool) {
+	if req.Start != nil {
+		return *req.Start, *req.End, true
+	}
+
+	intent, err := parser.NewIntentParser().Parse(req.Question)
+	if err != nil || (!intent.Range && step == 0) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	window, ok := askWindows[intent.TimeFrame]
+	if !ok {
+		window = defaultAskWindow
+	}
+	end := time.Now()
+	return end.Add(-window), end, true
+}
+
+// askContextError maps an expired or cancelled request context to the
+// error returned to the client. A cancelled request is usually one the
+// client gave up on, so the status is mostly seen in logs and metrics.
+func askContextError(ctx context.Context) error {
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "Request timed out")
+	case err != nil:
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Request cancelled")
+	}
+	return nil
+}
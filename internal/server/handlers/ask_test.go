@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/session"
+	"github.com/labstack/echo/v4"
+)
+
+func askHandlers(t *testing.T) *Handlers {
+	return newTestHandlers(t, mock.Rule{
+		Pattern:  `Query: request rate per job$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate", "groupBy": ["job"]}`,
+	})
+}
+
+func ask(h *Handlers, ctx context.Context, body string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ask", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return rec, h.HandleAsk(echo.New().NewContext(req, rec))
+}
+
+func TestAsk(t *testing.T) {
+	h := askHandlers(t)
+	start := promtest.Start.Format(time.RFC3339)
+	end := promtest.Start.Add(time.Hour).Format(time.RFC3339)
+	monthEnd := promtest.Start.Add(30 * 24 * time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name          string
+		body          string
+		wantStatus    string
+		wantQueryType string
+		wantResult    string
+	}{
+		{
+			name:          "instant",
+			body:          `{"question": "request rate per job"}`,
+			wantStatus:    StatusOK,
+			wantQueryType: "instant",
+			wantResult:    "vector",
+		},
+		{
+			name:          "range",
+			body:          `{"question": "request rate per job", "start": "` + start + `", "end": "` + end + `"}`,
+			wantStatus:    StatusOK,
+			wantQueryType: "range",
+			wantResult:    "matrix",
+		},
+		{
+			// Prometheus refuses range queries of more than 11,000 points.
+			name:          "prometheus error",
+			body:          `{"question": "request rate per job", "start": "` + start + `", "end": "` + monthEnd + `", "step": "1s"}`,
+			wantStatus:    StatusExecutionFailed,
+			wantQueryType: "range",
+		},
+		{
+			name:       "conversion failure",
+			body:       `{"question": "something unanswerable"}`,
+			wantStatus: StatusConversionFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := ask(h, context.Background(), tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp AskResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.wantStatus || resp.QueryType != tt.wantQueryType || resp.Answer == "" {
+				t.Fatalf("got %s", rec.Body)
+			}
+			if tt.wantResult == "" {
+				if resp.Data != nil {
+					t.Errorf("unexpected data %+v", resp.Data)
+				}
+				return
+			}
+			if resp.Data == nil || resp.Data.Data.ResultType != tt.wantResult || len(resp.Data.Data.Result) != 2 {
+				t.Errorf("got data %+v", resp.Data)
+			}
+			if resp.SuggestedChart == nil || !strings.Contains(resp.PromQL, "http_requests_total") {
+				t.Errorf("got %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestAskRejectsBadRequests(t *testing.T) {
+	h := askHandlers(t)
+	for _, body := range []string{
+		`{"question": ""}`,
+		`{"question": "request rate per job", "start": "2024-01-01T00:00:00Z"}`,
+		`{"question": "request rate per job", "step": "soon"}`,
+		`{"question": "request rate per job", "timeout": "-1s"}`,
+	} {
+		if _, err := ask(h, context.Background(), body); httpStatus(err) != http.StatusBadRequest {
+			t.Errorf("%s: got %v", body, err)
+		}
+	}
+}
+
+func TestAskCancelled(t *testing.T) {
+	h := askHandlers(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ask(h, ctx, `{"question": "request rate per job"}`); httpStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("cancelled: got %v", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := ask(h, ctx, `{"question": "request rate per job"}`); httpStatus(err) != http.StatusGatewayTimeout {
+		t.Errorf("timed out: got %v", err)
+	}
+}
+
+func TestPrometheusDownIsNotAnInvalidQuery(t *testing.T) {
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Load(testSeries); err != nil {
+		t.Fatal(err)
+	}
+	llm, _ := mock.New([]mock.Rule{{
+		Pattern:  `Query: request rate per job$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate", "groupBy": ["job"]}`,
+	}}, nil, "explanation")
+	sources := prometheus.SingleRegistry(prometheus.NewClientFor(srv.Start(), 5*time.Second))
+	h := New(sources, llm, session.NewMemoryStore(time.Hour))
+	// Discover the schema, then take Prometheus away before validation.
+	if _, err := h.pipeline.Metrics(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		body    string
+	}{
+		{"ask", h.HandleAsk, `{"question": "request rate per job"}`},
+		{"convert", h.HandleConvert, `{"query": "request rate per job"}`},
+		{"validate", h.HandleValidate, `{"promql": "up"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := call(tt.handler, http.MethodPost, "/", tt.body)
+			if status := httpStatus(err); err == nil || status != http.StatusServiceUnavailable {
+				t.Errorf("got %v, %s", err, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAskWithoutSchema(t *testing.T) {
+	llm, _ := mock.New(nil, nil, "explanation")
+	sources := prometheus.SingleRegistry(prometheus.NewClientFor("http://127.0.0.1:1", time.Second))
+	h := New(sources, llm, session.NewMemoryStore(time.Hour))
+
+	rec, err := ask(h, context.Background(), `{"question": "request rate per job"}`)
+	if status := httpStatus(err); err == nil || status != http.StatusServiceUnavailable {
+		t.Errorf("got %v, %s", err, rec.Body)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/labstack/echo/v4"
+)
+
+// clarificationTTL is how long a clarification can still be answered.
+const clarificationTTL = 15 * time.Minute
+
+var errUnknownClarification = errors.New("unknown or expired clarification")
+
+// clarificationCache keeps the clarifications returned to clients until they
+// are answered or expire.
+type clarificationCache struct {
+	pending map[string]pendingClarification
+	mu      sync.Mutex
+}
+
+type pendingClarification struct {
+	clarification *agent.Clarification
+	expires       time.Time
+}
+
+func newClarificationCache() *clarificationCache {
+	return &clarificationCache{
+		pending: make(map[string]pendingClarification),
+	}
+}
+
+func (cc *clarificationCache) put(c *agent.Clarification) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	now := time.Now()
+	for id, p := range cc.pending {
+		if now.After(p.expires) {
+			delete(cc.pending, id)
+		}
+	}
+	cc.pending[c.ID] = pendingClarification{
+		clarification: c,
+		expires:       now.Add(clarificationTTL),
+	}
+}
+
+func (cc *clarificationCache) get(id string) (*agent.Clarification, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	p, ok := cc.pending[id]
+	if !ok || time.Now().After(p.expires) {
+		return nil, false
+	}
+	return p.clarification, true
+}
+
+func (cc *clarificationCache) remove(id string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.pending, id)
+}
+
+// convert runs a ConvertRequest through the pipeline. Requests carrying a
+// clarification_id answer an earlier needs_clarification response instead of
+// starting a new conversion.
+func (h *Handlers) convert(ctx context.Context, req ConvertRequest, emit agent.EventFunc) (*agent.ConvertResult, error) {
+	if req.ClarificationID != "" {
+		clarification, ok := h.clarifications.get(req.ClarificationID)
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusNotFound, errUnknownClarification.Error())
+		}
+		option, ok := clarification.Option(req.OptionID)
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Unknown clarification option")
+		}
+
+		result, err := h.pipeline.Resolve(ctx, option.Context, clarification.Datasource, 0, emit)
+		if err != nil {
+			return nil, err
+		}
+		h.clarifications.remove(req.ClarificationID)
+		return result, nil
+	}
+
+	result, err := h.pipeline.Convert(ctx, req.Query, agent.ConvertOptions{
+		Clarify:    req.Clarify,
+		Candidates: req.Candidates,
+		Datasource: req.Datasource,
+	}, emit)
+	if errors.Is(err, prometheus.ErrUnknownDatasource) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Clarification != nil {
+		h.clarifications.put(result.Clarification)
+	}
+	return result, nil
+}
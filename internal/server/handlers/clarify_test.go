@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+)
+
+func TestClarificationCache(t *testing.T) {
+	cc := newClarificationCache()
+	cc.put(&agent.Clarification{ID: "a"})
+	if c, ok := cc.get("a"); !ok || c.ID != "a" {
+		t.Fatalf("get a: %v %v", c, ok)
+	}
+	if _, ok := cc.get("b"); ok {
+		t.Error("found unknown clarification")
+	}
+
+	cc.pending["old"] = pendingClarification{clarification: &agent.Clarification{ID: "old"}, expires: time.Now().Add(-time.Second)}
+	if _, ok := cc.get("old"); ok {
+		t.Error("expired clarification still answerable")
+	}
+	cc.put(&agent.Clarification{ID: "b"})
+	if _, ok := cc.pending["old"]; ok {
+		t.Error("expired clarification not evicted")
+	}
+
+	cc.remove("a")
+	if _, ok := cc.get("a"); ok {
+		t.Error("removed clarification still answerable")
+	}
+}
+
+func TestConvertClarification(t *testing.T) {
+	h := newTestHandlers(t, mock.Rule{
+		Pattern:  `Query: request rate$`,
+		Response: `{"metric": "http_requests_total", "labels": {"job": "api"}, "timeRange": "5m", "aggregation": "rate"}`,
+	})
+
+	rec, err := call(h.HandleConvert, http.MethodPost, "/api/v1/convert", `{"query": "request rate", "clarify": true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asked ConvertResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &asked); err != nil {
+		t.Fatal(err)
+	}
+	if asked.Status != StatusNeedsClarification || asked.Clarification == nil || len(asked.Clarification.Options) != 2 {
+		t.Fatalf("got %s", rec.Body)
+	}
+	id := asked.Clarification.ID
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantPromQL string
+	}{
+		{"missing option", `{"clarification_id": "` + id + `"}`, http.StatusBadRequest, ""},
+		{"unknown option", `{"clarification_id": "` + id + `", "option_id": "9"}`, http.StatusBadRequest, ""},
+		{"answer", `{"clarification_id": "` + id + `", "option_id": "2"}`, http.StatusOK, `job="web"`},
+		{"answered already", `{"clarification_id": "` + id + `", "option_id": "1"}`, http.StatusNotFound, ""},
+		{"unknown clarification", `{"clarification_id": "nope", "option_id": "1"}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := call(h.HandleConvert, http.MethodPost, "/api/v1/convert", tt.body)
+			if err != nil {
+				if status := httpStatus(err); status != tt.wantStatus {
+					t.Fatalf("got %d (%v), want %d", status, err, tt.wantStatus)
+				}
+				return
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var resp ConvertResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != StatusOK || !strings.Contains(resp.PromQL, tt.wantPromQL) {
+				t.Errorf("got %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/labstack/echo/v4"
+)
+
+// DatasourceInfo describes a configured datasource.
+type DatasourceInfo struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Retention string `json:"retention,omitempty"`
+	LongTerm  bool   `json:"long_term,omitempty"`
+	Default   bool   `json:"default,omitempty"`
+}
+
+func (h *Handlers) HandleListDatasources(c echo.Context) error {
+	sources := h.pipeline.Datasources()
+	out := make([]DatasourceInfo, 0)
+	for _, ds := range sources.List() {
+		info := DatasourceInfo{
+			Name:     ds.Name,
+			Address:  ds.Address,
+			LongTerm: ds.LongTerm,
+			Default:  ds == sources.Default(),
+		}
+		if ds.Retention > 0 {
+			info.Retention = ds.Retention.String()
+		}
+		out = append(out, info)
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// datasource returns the named datasource, or the one query routes to when
+// name is empty. lookback is how far back the query reaches.
+func (h *Handlers) datasource(ctx context.Context, name, query string, lookback time.Duration) (*prometheus.Datasource, error) {
+	sources := h.pipeline.Datasources()
+	if name == "" {
+		ds, _ := sources.RouteQuery(ctx, query, lookback)
+		return ds, nil
+	}
+	ds, err := sources.Get(name)
+	if errors.Is(err, prometheus.ErrUnknownDatasource) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return ds, err
+}
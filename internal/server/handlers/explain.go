@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/txt2promql/internal/query"
+	"github.com/labstack/echo/v4"
+)
+
+type ExplainRequest struct {
+	PromQL string `json:"promql"`
+}
+
+type ExplainResponse struct {
+	PromQL      string       `json:"promql"`
+	Type        string       `json:"type"`
+	Explanation string       `json:"explanation"`
+	Steps       []query.Step `json:"steps"`
+}
+
+// HandleExplain explains an arbitrary PromQL expression, such as a panel
+// query from someone else's dashboard.
+func (h *Handlers) HandleExplain(c echo.Context) error {
+	var req ExplainRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	if strings.TrimSpace(req.PromQL) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "PromQL cannot be empty")
+	}
+
+	structural, explanation, err := h.explainer.ExplainPromQL(c.Request().Context(), req.PromQL)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, ExplainResponse{
+		PromQL:      structural.Query,
+		Type:        structural.Type,
+		Explanation: explanation,
+		Steps:       structural.Steps,
+	})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/grafana"
+	"github.com/labstack/echo/v4"
+)
+
+type GrafanaExportRequest struct {
+	Title   string          `json:"title"`
+	UID     string          `json:"uid,omitempty"`
+	Queries []grafana.Query `json:"queries"`
+	// DatasourceVariable adds a $datasource variable instead of pinning
+	// DatasourceUID.
+	DatasourceVariable bool   `json:"datasource_variable,omitempty"`
+	DatasourceUID      string `json:"datasource_uid,omitempty"`
+	// TemplateVariables adds label variables such as $namespace and $job.
+	TemplateVariables bool `json:"template_variables,omitempty"`
+	// Datasource converts and shapes every panel on one datasource. Empty
+	// routes each panel by its metric.
+	Datasource string `json:"datasource,omitempty"`
+}
+
+// HandleExportGrafana responds with a Grafana dashboard JSON model holding
+// one panel per question or PromQL expression.
+func (h *Handlers) HandleExportGrafana(c echo.Context) error {
+	var req GrafanaExportRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	dashboard, err := h.exporter.Export(c.Request().Context(), req.Queries, grafana.ExportOptions{
+		Options: grafana.Options{
+			Title:              req.Title,
+			UID:                req.UID,
+			DatasourceVariable: req.DatasourceVariable,
+			DatasourceUID:      req.DatasourceUID,
+		},
+		TemplateVariables: req.TemplateVariables,
+		Datasource:        req.Datasource,
+	})
+	if err != nil {
+		if errors.Is(err, agent.ErrSchemaUnavailable) {
+			return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, dashboard)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/session"
+)
+
+// countingFake serves load from a fake Prometheus and counts the range
+// queries it answers.
+func countingFake(t *testing.T, load string) (string, *atomic.Int32) {
+	t.Helper()
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	if err := srv.Load(load); err != nil {
+		t.Fatal(err)
+	}
+	var ranges atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/query_range" {
+			ranges.Add(1)
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, &ranges
+}
+
+func TestExportShapesPanelsOnRoutedDatasource(t *testing.T) {
+	eu, euRanges := countingFake(t, "load 1m\n  up{job=\"api\"} 1x60\n")
+	us, usRanges := countingFake(t, "load 1m\n  node_load1{instance=\"n1\"} 0.5x60\n")
+	sources, err := prometheus.NewRegistry([]prometheus.DatasourceConfig{
+		{Name: "eu", Address: eu, Default: true},
+		{Name: "us", Address: us},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm, _ := mock.New(nil, nil, "explanation")
+	h := New(sources, llm, session.NewMemoryStore(time.Hour))
+
+	tests := []struct {
+		name   string
+		body   string
+		wantEU int32
+		wantUS int32
+	}{
+		{"routed by metric", `{"queries": [{"promql": "up"}, {"promql": "node_load1"}]}`, 1, 1},
+		{"named datasource", `{"queries": [{"promql": "node_load1"}], "datasource": "eu"}`, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			euRanges.Store(0)
+			usRanges.Store(0)
+			if _, err := call(h.HandleExportGrafana, http.MethodPost, "/api/v1/export/grafana", tt.body); err != nil {
+				t.Fatal(err)
+			}
+			if euRanges.Load() != tt.wantEU || usRanges.Load() != tt.wantUS {
+				t.Errorf("got %d range queries on eu and %d on us, want %d and %d",
+					euRanges.Load(), usRanges.Load(), tt.wantEU, tt.wantUS)
+			}
+		})
+	}
+
+	_, err = call(h.HandleExportGrafana, http.MethodPost, "/api/v1/export/grafana",
+		`{"queries": [{"promql": "up"}], "datasource": "apac"}`)
+	if status := httpStatus(err); status != http.StatusBadRequest {
+		t.Errorf("unknown datasource: got %d (%v), want 400", status, err)
+	}
+}
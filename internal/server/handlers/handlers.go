@@ -1,48 +1,116 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/chart"
 	kg "github.com/agentkube/txt2promql/internal/core/knowledgegraph"
+	"github.com/agentkube/txt2promql/internal/grafana"
 	"github.com/agentkube/txt2promql/internal/prometheus"
-	"github.com/agentkube/txt2promql/internal/provider/openai"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/resilience"
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/agentkube/txt2promql/internal/session"
 	"github.com/labstack/echo/v4"
 )
 
 type Handlers struct {
-	promClient        *prometheus.Client
-	contextExtractor  *agent.ContextExtractor
-	explainer         *agent.Explainer
-	queryBuilder      *agent.QueryBuilder
-	metricCache       map[string]prometheus.MetricSchema
-	lastCacheTime     time.Time
-	knowledgePatterns *kg.KnowledgePatterns
+	promClient     *prometheus.Client
+	pipeline       *agent.Pipeline
+	explainer      *agent.Explainer
+	summarizer     *agent.Summarizer
+	exporter       *grafana.Exporter
+	alerts         *rules.AlertGenerator
+	slos           *rules.SLOGenerator
+	sessions       session.Store
+	clarifications *clarificationCache
+	// snapshot is the schema snapshot conversions run on, if any.
+	snapshot *prometheus.Snapshot
 }
 
-func New(promClient *prometheus.Client, openaiClient *openai.OpenAIClient) *Handlers {
+func New(sources *prometheus.Registry, llm provider.Provider, sessions session.Store) *Handlers {
+	pipeline := agent.NewPipelineFor(sources, llm)
+	promClient := sources.Default().Client
 	return &Handlers{
-		promClient:        promClient,
-		contextExtractor:  agent.NewContextExtractor(openaiClient),
-		explainer:         agent.NewExplainer(openaiClient),
-		queryBuilder:      agent.NewQueryBuilder(),
-		metricCache:       make(map[string]prometheus.MetricSchema),
-		knowledgePatterns: kg.NewKnowledgePatterns(),
+		promClient:     promClient,
+		pipeline:       pipeline,
+		explainer:      agent.NewExplainer(llm),
+		summarizer:     agent.NewSummarizer(llm),
+		exporter:       grafana.NewExporter(pipeline),
+		alerts:         rules.NewAlertGenerator(pipeline, llm),
+		slos:           rules.NewSLOGenerator(pipeline),
+		sessions:       sessions,
+		clarifications: newClarificationCache(),
 	}
 }
 
+// UseSnapshot runs conversions against a schema snapshot instead of the
+// schema discovered from Prometheus.
+func (h *Handlers) UseSnapshot(snapshot *prometheus.Snapshot) {
+	h.snapshot = snapshot
+	h.pipeline.UseSnapshot(snapshot)
+}
+
+// Conversion statuses reported in ConvertResponse.
+const (
+	StatusOK                 = "ok"
+	StatusNeedsClarification = "needs_clarification"
+)
+
 type ConvertRequest struct {
 	Query string `json:"query"`
+	// Clarify allows a needs_clarification response for ambiguous questions.
+	Clarify bool `json:"clarify,omitempty"`
+	// Candidates asks for that many alternative queries, ranked.
+	Candidates int `json:"candidates,omitempty"`
+	// ClarificationID and OptionID answer a previous needs_clarification
+	// response; Query is ignored when they are set.
+	ClarificationID string `json:"clarification_id,omitempty"`
+	OptionID        string `json:"option_id,omitempty"`
+	// Execute runs the generated query and answers the question from its
+	// result.
+	Execute bool `json:"execute,omitempty"`
+	// Datasource converts against one datasource. Empty routes the query
+	// to the datasource that has its metric.
+	Datasource string `json:"datasource,omitempty"`
+}
+
+func (r ConvertRequest) validate() error {
+	if r.ClarificationID != "" {
+		if r.OptionID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Option id is required to answer a clarification")
+		}
+		return nil
+	}
+	if strings.TrimSpace(r.Query) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Query cannot be empty")
+	}
+	if r.Candidates < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Candidates cannot be negative")
+	}
+	return nil
 }
 
 type ConvertResponse struct {
-	PromQL         string          `json:"promql"`
-	Explanation    string          `json:"explanation,omitempty"`
-	SimilarMetrics []kg.MetricInfo `json:"similar_metrics,omitempty"`
+	Status         string                  `json:"status,omitempty"`
+	PromQL         string                  `json:"promql"`
+	Datasource     string                  `json:"datasource,omitempty"`
+	Explanation    string                  `json:"explanation,omitempty"`
+	Confidence     *agent.Confidence       `json:"confidence,omitempty"`
+	SimilarMetrics []kg.MetricInfo         `json:"similar_metrics,omitempty"`
+	Clarification  *agent.Clarification    `json:"clarification,omitempty"`
+	Candidates     []agent.Candidate       `json:"candidates,omitempty"`
+	Correction     *agent.Correction       `json:"correction,omitempty"`
+	Data           *prometheus.QueryResult `json:"data,omitempty"`
+	Answer         string                  `json:"answer,omitempty"`
 }
 
 func (h *Handlers) HandleConvert(c echo.Context) error {
@@ -51,81 +119,124 @@ func (h *Handlers) HandleConvert(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
 	}
 
-	if strings.TrimSpace(req.Query) == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Query cannot be empty")
-	}
-
-	if err := h.refreshMetricCache(c.Request().Context()); err != nil {
-		return c.JSON(http.StatusOK, ConvertResponse{
-			Explanation: "Failed to refresh metrics, response may be inaccurate",
-		})
+	if err := req.validate(); err != nil {
+		return err
 	}
 
-	queryCtx, err := h.contextExtractor.ExtractQueryContext(c.Request().Context(), req.Query, h.metricCache)
+	result, err := h.convert(c.Request().Context(), req, nil)
 	if err != nil {
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			return he
+		}
+		var apiErr *prometheus.APIError
+		if errors.As(err, &apiErr) {
+			return prometheusError(err)
+		}
 		return c.JSON(http.StatusOK, ConvertResponse{
-			Explanation: "Failed to extract query context",
-		})
-	}
-
-	promQL, _ := h.queryBuilder.Build(queryCtx)
-	if promQL == "" {
-		return c.JSON(http.StatusOK, ConvertResponse{
-			Explanation: "Unable to generate PromQL query",
+			Explanation: convertErrorMessage(err),
 		})
 	}
 
-	explanation := h.explainer.GenerateExplanation(c.Request().Context(), queryCtx, promQL)
-	similarMetrics := h.knowledgePatterns.FindSimilarMetrics(queryCtx.MainMetric, h.metricCache)
-
-	validationResult, err := h.promClient.ValidateQuery(c.Request().Context(), promQL)
-	if err != nil || !validationResult.Valid {
-		explanation += " (Generated PromQL query may not be accurate)"
+	resp := newConvertResponse(result)
+	if req.Execute && resp.PromQL != "" {
+		h.answer(c.Request().Context(), req.Query, &resp)
 	}
 
-	return c.JSON(http.StatusOK, ConvertResponse{
-		PromQL:         promQL,
-		Explanation:    explanation,
-		SimilarMetrics: similarMetrics,
-	})
+	return c.JSON(http.StatusOK, resp)
 }
 
-func (h *Handlers) refreshMetricCache(ctx context.Context) error {
-	if time.Since(h.lastCacheTime) < 5*time.Minute {
-		return nil
+// answer runs resp.PromQL as an instant query and fills in the data and a
+// natural-language answer to question.
+func (h *Handlers) answer(ctx context.Context, question string, resp *ConvertResponse) {
+	ds, err := h.datasource(ctx, resp.Datasource, resp.PromQL, 0)
+	if err != nil {
+		resp.Answer = fmt.Sprintf("Query execution failed: %v", err)
+		return
 	}
-
-	result, err := h.promClient.Query(ctx, "{__name__=~\".+\"}")
+	data, err := ds.Client.QueryInstant(ctx, resp.PromQL, nil)
 	if err != nil {
-		return err
+		resp.Answer = fmt.Sprintf("Query execution failed: %v", err)
+		return
 	}
+	resp.Data = data
+	resp.Answer = h.summarizer.Summarize(ctx, question, resp.PromQL, data)
+}
 
-	newCache := make(map[string]prometheus.MetricSchema)
-	for _, m := range result.Data.Result {
-		if name, ok := m.Metric["__name__"]; ok {
-			newCache[name] = prometheus.MetricSchema{
-				Name:   name,
-				Labels: m.Metric,
-			}
+func newConvertResponse(result *agent.ConvertResult) ConvertResponse {
+	if result.Clarification != nil {
+		return ConvertResponse{
+			Status:        StatusNeedsClarification,
+			Clarification: result.Clarification,
 		}
 	}
+	return ConvertResponse{
+		Status:         StatusOK,
+		PromQL:         result.PromQL,
+		Datasource:     result.Datasource,
+		Explanation:    result.Explanation,
+		Confidence:     result.Confidence,
+		SimilarMetrics: result.SimilarMetrics,
+		Candidates:     result.Candidates,
+		Correction:     result.Correction,
+	}
+}
 
-	h.metricCache = newCache
-	h.lastCacheTime = time.Now()
-	return nil
+// convertErrorMessage maps pipeline failures to the messages returned to
+// API clients.
+func convertErrorMessage(err error) string {
+	var apiErr *prometheus.APIError
+	switch {
+	case errors.Is(err, agent.ErrSchemaUnavailable):
+		return "Failed to refresh metrics, response may be inaccurate"
+	case errors.As(err, &apiErr):
+		return fmt.Sprintf("Prometheus could not check the query: %s", apiErr.Msg)
+	case errors.Is(err, agent.ErrContextExtraction):
+		return "Failed to extract query context"
+	default:
+		return "Unable to generate PromQL query"
+	}
+}
+
+// suggestChart suggests a chart for a query result, taking metric types from
+// the schema when it is available and from metric names otherwise.
+func (h *Handlers) suggestChart(ctx context.Context, promQL string, result *prometheus.QueryResult) chart.Suggestion {
+	metrics, _ := h.pipeline.Metrics(ctx)
+	return chart.Suggest(promQL, result, metrics)
+}
+
+// prometheusError answers a failed Prometheus call with the status its
+// error type maps to, passing on the type and message Prometheus reported.
+func prometheusError(err error) error {
+	var apiErr *prometheus.APIError
+	if !errors.As(err, &apiErr) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	body := map[string]interface{}{
+		"message":    apiErr.Msg,
+		"error_type": apiErr.Type,
+	}
+	if len(apiErr.Warnings) > 0 {
+		body["warnings"] = apiErr.Warnings
+	}
+	return echo.NewHTTPError(prometheus.HTTPStatus(err), body)
 }
 
 func (h *Handlers) HandleValidate(c echo.Context) error {
 	var req struct {
-		PromQL string `json:"promql"`
+		PromQL     string `json:"promql"`
+		Datasource string `json:"datasource,omitempty"`
 	}
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	result, err := h.promClient.ValidateQuery(c.Request().Context(), req.PromQL)
+	result, err := h.pipeline.Validate(c.Request().Context(), req.PromQL, req.Datasource)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		if errors.Is(err, prometheus.ErrUnknownDatasource) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return prometheusError(err)
 	}
 
 	return c.JSON(http.StatusOK, result)
@@ -134,7 +245,7 @@ func (h *Handlers) HandleValidate(c echo.Context) error {
 func (h *Handlers) HandleListMetrics(c echo.Context) error {
 	result, err := h.promClient.Query(c.Request().Context(), "{__name__=~\".+\"}")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return prometheusError(err)
 	}
 
 	metrics := make([]string, 0)
@@ -147,18 +258,60 @@ func (h *Handlers) HandleListMetrics(c echo.Context) error {
 	return c.JSON(http.StatusOK, metrics)
 }
 
+// healthTimeout bounds the datasource probes of a health check, retries
+// included.
+const healthTimeout = 2 * time.Second
+
 func (h *Handlers) HandleHealth(c echo.Context) error {
-	ctx := context.Background()
-	_, err := h.promClient.Query(ctx, "up")
-	promOK := err == nil
+	ctx, cancel := context.WithTimeout(c.Request().Context(), healthTimeout)
+	defer cancel()
+
+	registry := h.pipeline.Datasources()
+	sources := registry.List()
+	up := make([]bool, len(sources))
+	var wg sync.WaitGroup
+	for i, ds := range sources {
+		wg.Add(1)
+		go func(i int, ds *prometheus.Datasource) {
+			defer wg.Done()
+			_, err := ds.Client.Query(ctx, "up")
+			up[i] = err == nil
+		}(i, ds)
+	}
+	wg.Wait()
+
+	promOK := false
+	status := make(map[string]bool, len(sources))
+	for i, ds := range sources {
+		status[ds.Name] = up[i]
+		if ds == registry.Default() {
+			promOK = up[i]
+		}
+	}
 
 	resp := map[string]interface{}{
 		"status":     "ok",
 		"prometheus": promOK,
 	}
-	if !promOK {
+	if len(sources) > 1 {
+		// prometheus reports the default datasource; the others are only
+		// listed, since routing skips those that are down.
+		resp["datasources"] = status
+	}
+	if h.snapshot != nil {
+		// Conversions do not need Prometheus when they run on a snapshot.
+		resp["schema_snapshot"] = h.snapshot.CreatedAt
+	} else if !promOK {
 		resp["status"] = "degraded"
 	}
+	if upstreams := resilience.Statuses(); len(upstreams) > 0 {
+		resp["upstreams"] = upstreams
+		for _, status := range upstreams {
+			if status.State == resilience.Open {
+				resp["status"] = "degraded"
+			}
+		}
+	}
 
 	return c.JSON(http.StatusOK, resp)
 }
@@ -169,6 +322,16 @@ type ExecuteRequest struct {
 	End       *time.Time `json:"end,omitempty"`
 	Step      string     `json:"step,omitempty"`
 	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// Summarize adds a natural-language answer describing the result.
+	Summarize bool `json:"summarize,omitempty"`
+	// Question is the original question, used to phrase the answer.
+	Question string `json:"question,omitempty"`
+	// Datasource runs the query on one datasource. Empty routes it by its
+	// metric and by how far back it reaches.
+	Datasource string `json:"datasource,omitempty"`
+	// Format is json (default) or csv, which answers with the result as a
+	// CSV table of one row per sample.
+	Format string `json:"format,omitempty"`
 }
 
 // func (h *Handlers) HandleExecute(c echo.Context) error {
@@ -210,75 +373,12 @@ type ExecuteRequest struct {
 // 	return c.JSON(http.StatusOK, result)
 // }
 
-type ChartSuggestion struct {
-	Type   string `json:"type"`
-	Reason string `json:"reason"`
-}
-
 type ExecuteResponse struct {
 	Status         string                  `json:"status"`
 	Data           *prometheus.QueryResult `json:"data"`
-	SuggestedChart ChartSuggestion         `json:"suggestedChart"`
-}
-
-func predictChartType(query string, result *prometheus.QueryResult) ChartSuggestion {
-	// Check for time-based functions
-	if strings.Contains(query, "rate(") ||
-		strings.Contains(query, "increase(") ||
-		strings.Contains(query, "irate(") {
-		return ChartSuggestion{
-			Type:   "time-series",
-			Reason: "Query contains rate or increase functions which are best visualized over time",
-		}
-	}
-
-	// Check for aggregations
-	if strings.Contains(query, " by (") {
-		if strings.Contains(query, "topk") || strings.Contains(query, "bottomk") {
-			return ChartSuggestion{
-				Type:   "bar",
-				Reason: "Query uses top/bottom k aggregation which is best shown as a bar chart",
-			}
-		}
-		return ChartSuggestion{
-			Type:   "pie",
-			Reason: "Query uses grouping which can be effectively shown as a pie chart",
-		}
-	}
-
-	// Check for single value or gauge-like metrics
-	if result.Data.ResultType == "vector" && len(result.Data.Result) == 1 {
-		if strings.Contains(strings.ToLower(query), "total") ||
-			strings.Contains(strings.ToLower(query), "sum") {
-			return ChartSuggestion{
-				Type:   "gauge",
-				Reason: "Query returns a single total/sum value suitable for a gauge",
-			}
-		}
-	}
-
-	// Check for complex multi-metric results
-	if result.Data.ResultType == "matrix" ||
-		(result.Data.ResultType == "vector" && len(result.Data.Result) > 10) {
-		return ChartSuggestion{
-			Type:   "table",
-			Reason: "Query returns multiple metrics which are best viewed in a table",
-		}
-	}
-
-	// Check for hierarchical data
-	if strings.Contains(query, "count") && strings.Contains(query, " by (") {
-		return ChartSuggestion{
-			Type:   "tree",
-			Reason: "Query counts by labels which can be shown hierarchically",
-		}
-	}
-
-	// Default to time-series for most other cases
-	return ChartSuggestion{
-		Type:   "time-series",
-		Reason: "Default visualization for metric data over time",
-	}
+	SuggestedChart chart.Suggestion        `json:"suggestedChart"`
+	Answer         string                  `json:"answer,omitempty"`
+	Datasource     string                  `json:"datasource,omitempty"`
 }
 
 func (h *Handlers) HandleExecute(c echo.Context) error {
@@ -290,11 +390,25 @@ func (h *Handlers) HandleExecute(c echo.Context) error {
 	if strings.TrimSpace(req.Query) == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "Query cannot be empty")
 	}
+	switch strings.ToLower(req.Format) {
+	case "", "json", "csv":
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown format %q, want json or csv", req.Format))
+	}
 
 	ctx := c.Request().Context()
-	var result *prometheus.QueryResult
-	var err error
+	var lookback time.Duration
+	if req.Start != nil {
+		lookback = time.Since(*req.Start)
+	} else if req.Timestamp != nil {
+		lookback = time.Since(*req.Timestamp)
+	}
+	ds, err := h.datasource(ctx, req.Datasource, req.Query, lookback)
+	if err != nil {
+		return err
+	}
 
+	var result *prometheus.QueryResult
 	if req.Start != nil && req.End != nil {
 		step := time.Minute
 		if req.Step != "" {
@@ -303,22 +417,33 @@ func (h *Handlers) HandleExecute(c echo.Context) error {
 				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid step: %v", err))
 			}
 		}
-		result, err = h.promClient.QueryRange(ctx, req.Query, *req.Start, *req.End, step)
+		result, err = ds.Client.QueryRange(ctx, req.Query, *req.Start, *req.End, step)
 	} else {
-		result, err = h.promClient.QueryInstant(ctx, req.Query, req.Timestamp)
+		result, err = ds.Client.QueryInstant(ctx, req.Query, req.Timestamp)
 	}
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return prometheusError(err)
 	}
 
-	// Predict chart type based on query and result
-	chartSuggestion := predictChartType(req.Query, result)
+	if strings.EqualFold(req.Format, "csv") {
+		var buf bytes.Buffer
+		if err := result.WriteCSV(&buf); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.Blob(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+
+	chartSuggestion := h.suggestChart(ctx, req.Query, result)
 
 	response := ExecuteResponse{
 		Status:         "success",
 		Data:           result,
 		SuggestedChart: chartSuggestion,
+		Datasource:     ds.Name,
+	}
+	if req.Summarize {
+		response.Answer = h.summarizer.Summarize(ctx, req.Question, req.Query, result)
 	}
 
 	return c.JSON(http.StatusOK, response)
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/session"
+	"github.com/labstack/echo/v4"
+)
+
+// testSeries is what the fake Prometheus behind newTestHandlers serves.
+const testSeries = `
+load 1m
+  http_requests_total{job="api", code="200"} 0+60x60
+  http_requests_total{job="web", code="200"} 0+30x60
+`
+
+// newTestHandlers serves testSeries from a fake Prometheus and answers LLM
+// prompts with rules, or "explanation" when none match.
+func newTestHandlers(t *testing.T, rules ...mock.Rule) *Handlers {
+	t.Helper()
+	llm, err := mock.New(rules, nil, "explanation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := prometheus.SingleRegistry(prometheus.NewClientFor(startFake(t, testSeries), 5*time.Second))
+	return New(sources, llm, session.NewMemoryStore(time.Hour))
+}
+
+// startFake serves the series of a "load" block on a fresh fake Prometheus.
+func startFake(t *testing.T, load string) string {
+	t.Helper()
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	if err := srv.Load(load); err != nil {
+		t.Fatal(err)
+	}
+	return srv.Start()
+}
+
+// call runs handler on a JSON request and returns the recorded response and
+// the error the handler returned.
+func call(handler echo.HandlerFunc, method, target, body string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	return rec, handler(echo.New().NewContext(req, rec))
+}
+
+// httpStatus is the status echo would answer err with.
+func httpStatus(err error) int {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
+
+func TestExecuteSuggestsChartFromSchema(t *testing.T) {
+	// Without a _total suffix the name alone reads as a gauge; the
+	// metadata says it is a counter.
+	for _, metadata := range []string{"", "counter"} {
+		srv, err := promtest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { srv.Close() })
+		if err := srv.Load("load 1m\n  http_requests{job=\"api\"} 0+60x60\n"); err != nil {
+			t.Fatal(err)
+		}
+		if metadata != "" {
+			srv.SetMetadata("http_requests", promtest.Metadata{Type: metadata})
+		}
+		llm, _ := mock.New(nil, nil, "explanation")
+		sources := prometheus.SingleRegistry(prometheus.NewClientFor(srv.Start(), 5*time.Second))
+		h := New(sources, llm, session.NewMemoryStore(time.Hour))
+
+		rec, err := call(h.HandleExecute, http.MethodPost, "/api/v1/execute", `{"query": "rate(http_requests[5m])"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp ExecuteResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		want := ""
+		if metadata == "counter" {
+			want = "reqps"
+		}
+		if resp.SuggestedChart.Unit != want {
+			t.Errorf("metadata %q: got unit %q, want %q", metadata, resp.SuggestedChart.Unit, want)
+		}
+	}
+}
+
+func TestHealthProbesDatasourcesConcurrently(t *testing.T) {
+	// hung never answers, so only the probe timeout ends its probe.
+	block := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-block:
+		}
+	}))
+	t.Cleanup(hung.Close)
+	t.Cleanup(func() { close(block) })
+
+	sources, err := prometheus.NewRegistry([]prometheus.DatasourceConfig{
+		{Name: "eu", Address: startFake(t, testSeries), Default: true},
+		{Name: "us", Address: hung.URL},
+		{Name: "apac", Address: hung.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm, _ := mock.New(nil, nil, "explanation")
+	h := New(sources, llm, session.NewMemoryStore(time.Hour))
+
+	start := time.Now()
+	rec, err := call(h.HandleHealth, http.MethodGet, "/health", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > healthTimeout+time.Second {
+		t.Errorf("health check took %s", elapsed)
+	}
+	var resp struct {
+		Prometheus  bool            `json:"prometheus"`
+		Datasources map[string]bool `json:"datasources"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Prometheus || !resp.Datasources["eu"] || resp.Datasources["us"] || resp.Datasources["apac"] {
+		t.Errorf("got %s", rec.Body)
+	}
+}
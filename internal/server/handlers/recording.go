@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/labstack/echo/v4"
+)
+
+type RecordingRulesRequest struct {
+	Queries []string `json:"queries"`
+	// IncludeSessions adds the queries generated in stored sessions.
+	IncludeSessions bool   `json:"include_sessions,omitempty"`
+	Group           string `json:"group,omitempty"`
+	// Interval is the group evaluation interval, such as "1m".
+	Interval       string `json:"interval,omitempty"`
+	MinOccurrences int    `json:"min_occurrences,omitempty"`
+}
+
+type RecordingRulesResponse struct {
+	*rules.RecordingAnalysis
+	ValidationErrors []string `json:"validation_errors,omitempty"`
+}
+
+// HandleRecordingRules suggests recording rules for expensive or repeated
+// subexpressions and rewrites the queries to use them.
+func (h *Handlers) HandleRecordingRules(c echo.Context) error {
+	var req RecordingRulesRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	var interval time.Duration
+	if req.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(req.Interval); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid interval")
+		}
+	}
+
+	queries := req.Queries
+	if req.IncludeSessions {
+		sessions, err := h.sessions.List()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		for _, s := range sessions {
+			for _, turn := range s.Turns {
+				queries = append(queries, turn.PromQL)
+			}
+		}
+	}
+	if len(queries) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "No queries to analyze")
+	}
+
+	analysis, err := rules.AnalyzeRecording(queries, rules.RecordingOptions{
+		Group:          req.Group,
+		Interval:       interval,
+		MinOccurrences: req.MinOccurrences,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := RecordingRulesResponse{RecordingAnalysis: analysis}
+	if analysis.File != nil {
+		resp.ValidationErrors = analysis.File.Validate()
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultRenderWindow is the range rendered when the request names none.
+const defaultRenderWindow = time.Hour
+
+// TimeRangeParams selects a past time range. Start and End take RFC 3339 or
+// Unix timestamps; without Start the range covers the last Range before End,
+// and End defaults to now.
+type TimeRangeParams struct {
+	Start string `json:"start,omitempty" query:"start"`
+	End   string `json:"end,omitempty" query:"end"`
+	Range string `json:"range,omitempty" query:"range"`
+	Step  string `json:"step,omitempty" query:"step"`
+}
+
+// RenderRequest is accepted as a JSON body or, for GET, as query parameters.
+type RenderRequest struct {
+	Query string `json:"query" query:"query"`
+	TimeRangeParams
+	Instant bool   `json:"instant,omitempty" query:"instant"`
+	Type    string `json:"type,omitempty" query:"type"`
+	Format  string `json:"format,omitempty" query:"format"`
+	Width   int    `json:"width,omitempty" query:"width"`
+	Height  int    `json:"height,omitempty" query:"height"`
+	Theme   string `json:"theme,omitempty" query:"theme"`
+	Legend  bool   `json:"legend,omitempty" query:"legend"`
+	Title   string `json:"title,omitempty" query:"title"`
+	// Datasource runs the query on one datasource. Empty routes it by its
+	// metric and by how far back it reaches.
+	Datasource string `json:"datasource,omitempty" query:"datasource"`
+}
+
+// HandleRender executes a query and responds with the result drawn as a PNG
+// or SVG image, for clients such as chat bots that cannot draw charts.
+func (h *Handlers) HandleRender(c echo.Context) error {
+	var req RenderRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Query cannot be empty")
+	}
+
+	ctx := c.Request().Context()
+	var result *prometheus.QueryResult
+	if req.Instant || instantChart(req.Type) {
+		ds, err := h.datasource(ctx, req.Datasource, req.Query, 0)
+		if err != nil {
+			return err
+		}
+		result, err = ds.Client.QueryInstant(ctx, req.Query, nil)
+		if err != nil {
+			return prometheusError(err)
+		}
+	} else {
+		now := time.Now()
+		start, end, step, err := req.timeRange(now, defaultRenderWindow)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		ds, err := h.datasource(ctx, req.Datasource, req.Query, now.Sub(start))
+		if err != nil {
+			return err
+		}
+		result, err = ds.Client.QueryRange(ctx, req.Query, start, end, step)
+		if err != nil {
+			return prometheusError(err)
+		}
+	}
+
+	opts := chart.RenderOptions{
+		Type:   req.Type,
+		Format: req.Format,
+		Width:  req.Width,
+		Height: req.Height,
+		Theme:  req.Theme,
+		Legend: req.Legend,
+		Title:  req.Title,
+	}
+	var buf bytes.Buffer
+	if err := chart.Render(&buf, result, h.suggestChart(ctx, req.Query, result), opts); err != nil {
+		if errors.Is(err, chart.ErrInvalidOptions) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	format := strings.ToLower(req.Format)
+	return c.Blob(http.StatusOK, chart.ContentType(format), buf.Bytes())
+}
+
+// instantChart reports whether a chart type shows a single point in time.
+func instantChart(chartType string) bool {
+	switch chartType {
+	case chart.TypeGauge, chart.TypeBar, chart.TypePie, chart.TypeTable:
+		return true
+	}
+	return false
+}
+
+func (r TimeRangeParams) timeRange(now time.Time, defaultWindow time.Duration) (time.Time, time.Time, time.Duration, error) {
+	end := now
+	if r.End != "" {
+		t, err := parseTime(r.End)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("invalid end: %w", err)
+		}
+		end = t
+	}
+
+	window := defaultWindow
+	if r.Range != "" {
+		d, err := time.ParseDuration(r.Range)
+		if err != nil || d <= 0 {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("invalid range %q", r.Range)
+		}
+		window = d
+	}
+	start := end.Add(-window)
+	if r.Start != "" {
+		t, err := parseTime(r.Start)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("invalid start: %w", err)
+		}
+		start = t
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, 0, errors.New("start must be before end")
+	}
+
+	step := chart.DefaultStep(end.Sub(start))
+	if r.Step != "" {
+		d, err := time.ParseDuration(r.Step)
+		if err != nil || d <= 0 {
+			return time.Time{}, time.Time{}, 0, fmt.Errorf("invalid step %q", r.Step)
+		}
+		step = d
+	}
+	return start, end, step, nil
+}
+
+// parseTime accepts the timestamp formats of the Prometheus HTTP API: RFC
+// 3339 or Unix seconds with an optional fraction.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse %q as a timestamp", s)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/session"
+)
+
+func TestRenderRoutesToDatasource(t *testing.T) {
+	sources, err := prometheus.NewRegistry([]prometheus.DatasourceConfig{
+		{Name: "eu", Address: startFake(t, "load 1m\n  up{job=\"api\"} 1x60\n"), Default: true},
+		{Name: "us", Address: startFake(t, "load 1m\n  node_load1{instance=\"n1\"} 0.5x60\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm, _ := mock.New(nil, nil, "explanation")
+	h := New(sources, llm, session.NewMemoryStore(time.Hour))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+	}{
+		{"routed by metric", "/api/v1/render?query=node_load1&instant=true&type=table&format=svg", http.StatusOK},
+		{"named datasource", "/api/v1/render?query=node_load1&instant=true&type=table&format=svg&datasource=us", http.StatusOK},
+		{"routed range", "/api/v1/render?query=node_load1&start=0&end=3600&format=svg&legend=true", http.StatusOK},
+		{"unknown datasource", "/api/v1/render?query=node_load1&format=svg&datasource=apac", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := call(h.HandleRender, http.MethodGet, tt.target, "")
+			if err != nil {
+				if status := httpStatus(err); status != tt.wantStatus {
+					t.Fatalf("got %d (%v), want %d", status, err, tt.wantStatus)
+				}
+				return
+			}
+			if rec.Code != tt.wantStatus || !bytes.Contains(rec.Body.Bytes(), []byte("<svg")) {
+				t.Fatalf("got %d, %.200s", rec.Code, rec.Body)
+			}
+			// The default datasource has no node_load1, so an empty chart
+			// means the query ran there.
+			if !bytes.Contains(rec.Body.Bytes(), []byte("n1")) {
+				t.Errorf("chart does not show the series of us: %.500s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestRenderRejectsBadOptions(t *testing.T) {
+	h := newTestHandlers(t)
+	for _, query := range []string{
+		"type=piee",
+		"theme=solarized",
+		"width=5000",
+		"format=gif",
+	} {
+		_, err := call(h.HandleRender, http.MethodGet, "/api/v1/render?query=http_requests_total&"+query, "")
+		if status := httpStatus(err); status != http.StatusBadRequest {
+			t.Errorf("%s: got %d (%v), want 400", query, status, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/session"
+	"github.com/agentkube/txt2promql/internal/types"
+	"github.com/labstack/echo/v4"
+)
+
+type SessionRequest struct {
+	Query string `json:"query"`
+}
+
+type SessionResponse struct {
+	ID        string           `json:"id"`
+	Turns     []session.Turn   `json:"turns"`
+	Result    *ConvertResponse `json:"result,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+type SessionSummary struct {
+	ID        string    `json:"id"`
+	Turns     int       `json:"turns"`
+	LastQuery string    `json:"last_query,omitempty"`
+	PromQL    string    `json:"promql,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HandleCreateSession starts a session, optionally answering its first
+// question straight away.
+func (h *Handlers) HandleCreateSession(c echo.Context) error {
+	var req SessionRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	s, err := h.sessions.Create()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return c.JSON(http.StatusCreated, newSessionResponse(s, nil))
+	}
+
+	resp, err := h.continueSession(c, s.ID, req.Query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// HandleContinueSession answers a question in the context of the session's
+// previous turn.
+func (h *Handlers) HandleContinueSession(c echo.Context) error {
+	var req SessionRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Query cannot be empty")
+	}
+
+	resp, err := h.continueSession(c, c.Param("id"), req.Query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// continueSession answers query as the next turn of session id. Questions
+// on the same session are answered one at a time, each resolved against the
+// turn before it.
+func (h *Handlers) continueSession(c echo.Context, id, query string) (*SessionResponse, error) {
+	var updated *session.Session
+	var converted ConvertResponse
+	err := h.sessions.Update(id, func(s *session.Session) error {
+		updated = s
+		var previous *types.QueryContext
+		if last := s.Last(); last != nil {
+			previous = last.Context
+		}
+
+		result, err := h.pipeline.Convert(c.Request().Context(), query, agent.ConvertOptions{Previous: previous}, nil)
+		if err != nil {
+			// Failed turns are not recorded so the next follow-up still
+			// resolves against the last good answer.
+			converted = ConvertResponse{Explanation: convertErrorMessage(err)}
+			return nil
+		}
+
+		converted = newConvertResponse(result)
+		s.Turns = append(s.Turns, session.Turn{
+			Question:    query,
+			Context:     result.Context,
+			PromQL:      converted.PromQL,
+			Explanation: converted.Explanation,
+			CreatedAt:   time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	return newSessionResponse(updated, &converted), nil
+}
+
+func (h *Handlers) HandleGetSession(c echo.Context) error {
+	s, err := h.sessions.Get(c.Param("id"))
+	if err != nil {
+		return sessionError(err)
+	}
+	return c.JSON(http.StatusOK, newSessionResponse(s, nil))
+}
+
+func (h *Handlers) HandleListSessions(c echo.Context) error {
+	sessions, err := h.sessions.List()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	summaries := make([]SessionSummary, 0, len(sessions))
+	for _, s := range sessions {
+		summary := SessionSummary{
+			ID:        s.ID,
+			Turns:     len(s.Turns),
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+		}
+		if last := s.Last(); last != nil {
+			summary.LastQuery = last.Question
+			summary.PromQL = last.PromQL
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return c.JSON(http.StatusOK, summaries)
+}
+
+func (h *Handlers) HandleDeleteSession(c echo.Context) error {
+	if err := h.sessions.Delete(c.Param("id")); err != nil {
+		return sessionError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func newSessionResponse(s *session.Session, result *ConvertResponse) *SessionResponse {
+	turns := s.Turns
+	if turns == nil {
+		turns = []session.Turn{}
+	}
+	return &SessionResponse{
+		ID:        s.ID,
+		Turns:     turns,
+		Result:    result,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+func sessionError(err error) error {
+	if errors.Is(err, session.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Session not found")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/labstack/echo/v4"
+)
+
+func TestContinueSessionConcurrently(t *testing.T) {
+	h := newTestHandlers(t, mock.Rule{
+		Pattern:  `Query: request rate$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate"}`,
+	}, mock.Rule{
+		Pattern:  `Query: only (api|web)$`,
+		Response: `{"metric": "http_requests_total", "labels": {"job": "$1"}, "timeRange": "5m", "aggregation": "rate"}`,
+	})
+
+	rec, err := call(h.HandleCreateSession, http.MethodPost, "/api/v1/sessions", `{"query": "request rate"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created SessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || len(created.Turns) != 1 {
+		t.Fatalf("created %s", rec.Body)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := `{"query": "only api"}`
+			if i%2 == 1 {
+				body = `{"query": "only web"}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/sessions/"+created.ID, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(created.ID)
+			if err := h.HandleContinueSession(c); err != nil || rec.Code != http.StatusOK {
+				t.Errorf("continue: %d %v", rec.Code, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s, err := h.sessions.Get(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Turns) != n+1 {
+		t.Errorf("got %d turns, want %d", len(s.Turns), n+1)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/labstack/echo/v4"
+)
+
+type SLORequest struct {
+	Description string `json:"description"`
+	// Errors, Good and Total override the discovered SLI selectors.
+	Errors string `json:"errors,omitempty"`
+	Good   string `json:"good,omitempty"`
+	Total  string `json:"total,omitempty"`
+	// Format is "json" (default) or "yaml" for the bare rule file.
+	Format string `json:"format,omitempty"`
+}
+
+// HandleSLO generates SLI, error budget and burn-rate queries plus the
+// recording and alerting rules for a description such as "99.9% of checkout
+// requests succeed over 30 days".
+func (h *Handlers) HandleSLO(c echo.Context) error {
+	var req SLORequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+	if strings.TrimSpace(req.Description) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Description cannot be empty")
+	}
+	if req.Format != "" && req.Format != "json" && req.Format != "yaml" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Format must be json or yaml")
+	}
+
+	result, err := h.slos.Generate(c.Request().Context(), req.Description, rules.SLOOptions{
+		Errors: req.Errors,
+		Good:   req.Good,
+		Total:  req.Total,
+	})
+	switch {
+	case errors.Is(err, agent.ErrSchemaUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, convertErrorMessage(err))
+	case errors.Is(err, rules.ErrNoSLIMetrics):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if req.Format == "yaml" {
+		return c.Blob(http.StatusOK, "application/yaml", []byte(result.YAML))
+	}
+	return c.JSON(http.StatusOK, result)
+}
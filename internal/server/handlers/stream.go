@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/labstack/echo/v4"
+)
+
+// sseWriter writes Server-Sent Events to an echo response until the client
+// goes away.
+type sseWriter struct {
+	res *echo.Response
+	ctx context.Context
+}
+
+func newSSEWriter(c echo.Context) *sseWriter {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+	return &sseWriter{res: res, ctx: c.Request().Context()}
+}
+
+func (w *sseWriter) send(event string, data interface{}) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	if _, err := fmt.Fprintf(w.res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+// HandleConvertStream runs the conversion pipeline and reports each stage as
+// a Server-Sent Event. The final ConvertResponse is sent as a "result" event,
+// or an "error" event if the pipeline fails.
+func (h *Handlers) HandleConvertStream(c echo.Context) error {
+	var req ConvertRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	if err := req.validate(); err != nil {
+		return err
+	}
+
+	sse := newSSEWriter(c)
+	result, err := h.convert(c.Request().Context(), req, func(ev agent.Event) {
+		sse.send(ev.Stage, ev.Data)
+	})
+	if err != nil {
+		message := convertErrorMessage(err)
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			message = fmt.Sprint(he.Message)
+		}
+		return sse.send("error", map[string]string{"message": message})
+	}
+
+	return sse.send("result", newConvertResponse(result))
+}
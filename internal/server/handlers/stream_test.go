@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/labstack/echo/v4"
+)
+
+type sseEvent struct {
+	name string
+	data json.RawMessage
+}
+
+// parseEvents splits a text/event-stream body into its events.
+func parseEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.name != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = json.RawMessage(strings.TrimPrefix(line, "data: "))
+			if !json.Valid(current.data) {
+				t.Errorf("event %s carries invalid JSON %s", current.name, current.data)
+			}
+		default:
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+	if current.name != "" {
+		t.Errorf("event %s not terminated by a blank line", current.name)
+	}
+	return events
+}
+
+// stages lists the event names in order, collapsing runs of tokens.
+func stages(events []sseEvent) []string {
+	var names []string
+	for _, ev := range events {
+		if len(names) > 0 && names[len(names)-1] == ev.name && strings.HasSuffix(ev.name, "_token") {
+			continue
+		}
+		names = append(names, ev.name)
+	}
+	return names
+}
+
+func streamConvert(h *Handlers, ctx context.Context, body string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/convert/stream", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return rec, h.HandleConvertStream(echo.New().NewContext(req, rec))
+}
+
+func TestConvertStream(t *testing.T) {
+	h := newTestHandlers(t, mock.Rule{
+		Pattern:  `Query: request rate per job$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate", "groupBy": ["job"]}`,
+	})
+
+	rec, err := streamConvert(h, context.Background(), `{"query": "request rate per job"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Errorf("content type %q", ct)
+	}
+
+	events := parseEvents(t, rec.Body.String())
+	want := []string{
+		agent.StageSchema, agent.StageCandidates, agent.StageContextToken, agent.StageContext,
+		agent.StagePromQL, agent.StageValidation, agent.StageConfidence, agent.StageExplanationToken,
+		"result",
+	}
+	if got := stages(events); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+
+	byName := make(map[string]json.RawMessage)
+	for _, ev := range events {
+		byName[ev.name] = ev.data
+	}
+	var promQL string
+	if err := json.Unmarshal(byName[agent.StagePromQL], &promQL); err != nil || !strings.Contains(promQL, "http_requests_total") {
+		t.Errorf("promql event %s", byName[agent.StagePromQL])
+	}
+	var validation struct {
+		Valid  bool `json:"valid"`
+		Series int  `json:"series"`
+	}
+	if err := json.Unmarshal(byName[agent.StageValidation], &validation); err != nil || !validation.Valid || validation.Series != 2 {
+		t.Errorf("validation event %s", byName[agent.StageValidation])
+	}
+	var result ConvertResponse
+	if err := json.Unmarshal(byName["result"], &result); err != nil || result.Status != StatusOK || result.PromQL != promQL {
+		t.Errorf("result event %s", byName["result"])
+	}
+}
+
+func TestConvertStreamError(t *testing.T) {
+	// No rule matches, so context extraction gets the plain-text fallback.
+	h := newTestHandlers(t)
+
+	rec, err := streamConvert(h, context.Background(), `{"query": "something unanswerable"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := parseEvents(t, rec.Body.String())
+	last := events[len(events)-1]
+	var body map[string]string
+	if err := json.Unmarshal(last.data, &body); err != nil || last.name != "error" || body["message"] == "" {
+		t.Fatalf("last event %s %s", last.name, last.data)
+	}
+	for _, ev := range events {
+		if ev.name == "result" {
+			t.Error("result sent after an error")
+		}
+	}
+
+	// Requests are checked before the stream starts.
+	if _, err := streamConvert(h, context.Background(), `{"query": " "}`); httpStatus(err) != http.StatusBadRequest {
+		t.Errorf("empty query: got %v", err)
+	}
+}
+
+// hangUp cancels the request when the explanation is requested, as a client
+// that disconnects halfway through the stream would.
+type hangUp struct {
+	provider.Provider
+	cancel context.CancelFunc
+	once   sync.Once
+	calls  int
+}
+
+func (p *hangUp) CompleteStream(ctx context.Context, prompt string, onToken provider.TokenFunc) (string, error) {
+	p.calls++
+	if p.calls > 1 {
+		p.once.Do(p.cancel)
+		return "", ctx.Err()
+	}
+	return p.Provider.CompleteStream(ctx, prompt, onToken)
+}
+
+func TestConvertStreamStopsOnDisconnect(t *testing.T) {
+	h := newTestHandlers(t)
+	llm, err := mock.New([]mock.Rule{{
+		Pattern:  `Query: request rate per job$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate", "groupBy": ["job"]}`,
+	}}, nil, "explanation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.pipeline = agent.NewPipelineFor(h.pipeline.Datasources(), &hangUp{Provider: llm, cancel: cancel})
+
+	rec, _ := streamConvert(h, ctx, `{"query": "request rate per job"}`)
+	got := stages(parseEvents(t, rec.Body.String()))
+	if last := got[len(got)-1]; last != agent.StageConfidence {
+		t.Errorf("events after disconnect: %v", got)
+	}
+}
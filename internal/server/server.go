@@ -6,9 +6,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/agentkube/txt2promql/internal/config"
 	prometheus "github.com/agentkube/txt2promql/internal/prometheus"
-	"github.com/agentkube/txt2promql/internal/provider/openai"
+	"github.com/agentkube/txt2promql/internal/provider/factory"
 	handlers "github.com/agentkube/txt2promql/internal/server/handlers"
+	"github.com/agentkube/txt2promql/internal/session"
 	"github.com/labstack/echo/v4"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -68,20 +70,32 @@ func MetricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
-func RegisterHandlers(e *echo.Echo, promClient *prometheus.Client) error {
+func RegisterHandlers(e *echo.Echo, sources *prometheus.Registry) error {
 	// Load AI configuration
-	var aiConfig openai.Config
-	if err := viper.UnmarshalKey("ai", &aiConfig); err != nil {
-		return fmt.Errorf("loading AI configuration: %w", err)
+	aiConfig, err := factory.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Initialize the LLM provider
+	llm, err := factory.New(aiConfig)
+	if err != nil {
+		return fmt.Errorf("initializing %s provider: %w", aiConfig.Provider, err)
 	}
 
-	// Initialize OpenAI client
-	openaiClient, err := openai.NewClient(&aiConfig)
+	sessions, err := newSessionStore()
 	if err != nil {
-		return fmt.Errorf("initializing OpenAI client: %w", err)
+		return fmt.Errorf("initializing session store: %w", err)
 	}
 
-	h := handlers.New(promClient, openaiClient)
+	h := handlers.New(sources, llm, sessions)
+	if path := viper.GetString("prometheus.schema_snapshot"); path != "" {
+		snapshot, err := prometheus.LoadSnapshot(path)
+		if err != nil {
+			return fmt.Errorf("loading schema snapshot: %w", err)
+		}
+		h.UseSnapshot(snapshot)
+	}
 	// middleware
 	e.Use(MetricsMiddleware)
 
@@ -93,21 +107,50 @@ func RegisterHandlers(e *echo.Echo, promClient *prometheus.Client) error {
 	api := e.Group("/api/v1")
 	{
 		api.POST("/convert", h.HandleConvert) //TODO high chances of request failure when same statement flows in.
+		api.POST("/convert/stream", h.HandleConvertStream)
 		api.POST("/validate", h.HandleValidate)
+		api.POST("/explain", h.HandleExplain)
 		api.POST("/execute", h.HandleExecute)
+		api.POST("/ask", h.HandleAsk)
+		api.GET("/render", h.HandleRender)
+		api.POST("/render", h.HandleRender)
+		api.POST("/export/grafana", h.HandleExportGrafana)
+		api.POST("/alerts", h.HandleAlert)
+		api.POST("/rules/recording", h.HandleRecordingRules)
+		api.POST("/slo", h.HandleSLO)
 		api.GET("/metrics", h.HandleListMetrics)
+		api.GET("/datasources", h.HandleListDatasources)
+
+		api.POST("/sessions", h.HandleCreateSession)
+		api.GET("/sessions", h.HandleListSessions)
+		api.GET("/sessions/:id", h.HandleGetSession)
+		api.POST("/sessions/:id", h.HandleContinueSession)
+		api.DELETE("/sessions/:id", h.HandleDeleteSession)
 	}
 
 	return nil
 }
 
+func newSessionStore() (session.Store, error) {
+	var cfg config.SessionConfig
+	if err := viper.UnmarshalKey("session", &cfg); err != nil {
+		return nil, fmt.Errorf("loading session configuration: %w", err)
+	}
+
+	switch cfg.Store {
+	case "", "memory":
+		return session.NewMemoryStore(cfg.TTL), nil
+	case "file":
+		return session.NewFileStore(cfg.Path, cfg.TTL)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.Store)
+	}
+}
+
 //TODO high chances of request failure when same statement flows in.
 // {
 //   "message": "Failed to process query"
 // }
-// {
-//   "message": "Invalid PromQL query: invalid query: unexpected status code: 400"
-// }
 
 // Agent Response:
 // ```json
@@ -0,0 +1,101 @@
+// internal/session/file.go
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore is a MemoryStore that writes every change to a JSON file so
+// sessions survive restarts.
+type FileStore struct {
+	*MemoryStore
+	path    string
+	writeMu sync.Mutex
+}
+
+func NewFileStore(path string, ttl time.Duration) (*FileStore, error) {
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(ttl),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading session file: %w", err)
+	}
+	if len(data) > 0 {
+		var sessions []*Session
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, fmt.Errorf("decoding session file: %w", err)
+		}
+		for _, s := range sessions {
+			fs.sessions[s.ID] = s
+		}
+		fs.expireLocked()
+	}
+
+	return fs, nil
+}
+
+func (fs *FileStore) Create() (*Session, error) {
+	s, err := fs.MemoryStore.Create()
+	if err != nil {
+		return nil, err
+	}
+	return s, fs.persist()
+}
+
+func (fs *FileStore) Save(s *Session) error {
+	if err := fs.MemoryStore.Save(s); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileStore) Update(id string, fn func(*Session) error) error {
+	if err := fs.MemoryStore.Update(id, fn); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileStore) Delete(id string) error {
+	if err := fs.MemoryStore.Delete(id); err != nil {
+		return err
+	}
+	return fs.persist()
+}
+
+func (fs *FileStore) persist() error {
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+
+	sessions, err := fs.MemoryStore.List()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding sessions: %w", err)
+	}
+
+	if dir := filepath.Dir(fs.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("creating session directory: %w", err)
+		}
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated store.
+	tmp := fs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing session file: %w", err)
+	}
+	return os.Rename(tmp, fs.path)
+}
@@ -0,0 +1,136 @@
+// internal/session/memory.go
+package session
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in memory and expires them ttl after their
+// last update. A zero ttl disables expiry.
+type MemoryStore struct {
+	sessions map[string]*Session
+	// updating serializes Update per session without holding mu while
+	// the update runs.
+	updating map[string]*sync.Mutex
+	ttl      time.Duration
+	mu       sync.Mutex
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*Session),
+		updating: make(map[string]*sync.Mutex),
+		ttl:      ttl,
+	}
+}
+
+func (m *MemoryStore) Create() (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := New()
+	m.sessions[s.ID] = s
+	return clone(s), nil
+}
+
+func (m *MemoryStore) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireLocked()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(s), nil
+}
+
+func (m *MemoryStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireLocked()
+	if _, ok := m.sessions[s.ID]; !ok {
+		return ErrNotFound
+	}
+	saved := clone(s)
+	saved.UpdatedAt = time.Now()
+	m.sessions[s.ID] = saved
+	return nil
+}
+
+func (m *MemoryStore) Update(id string, fn func(*Session) error) error {
+	lock := m.updateLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now()
+	return m.Save(s)
+}
+
+// updateLock returns the mutex Update holds for the session id.
+func (m *MemoryStore) updateLock(id string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.updating[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.updating[id] = lock
+	}
+	return lock
+}
+
+func (m *MemoryStore) List() ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireLocked()
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, clone(s))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+	return list, nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.sessions, id)
+	delete(m.updating, id)
+	return nil
+}
+
+func (m *MemoryStore) expireLocked() {
+	if m.ttl <= 0 {
+		return
+	}
+	for id, s := range m.sessions {
+		if time.Since(s.UpdatedAt) > m.ttl {
+			delete(m.sessions, id)
+			delete(m.updating, id)
+		}
+	}
+}
+
+func clone(s *Session) *Session {
+	c := *s
+	c.Turns = append([]Turn(nil), s.Turns...)
+	return &c
+}
@@ -0,0 +1,70 @@
+// internal/session/session.go
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Turn is a single question answered within a session.
+type Turn struct {
+	Question    string              `json:"question"`
+	Context     *types.QueryContext `json:"context"`
+	PromQL      string              `json:"promql"`
+	Explanation string              `json:"explanation,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// Session keeps the conversation state follow-up questions are resolved
+// against.
+type Session struct {
+	ID        string    `json:"id"`
+	Turns     []Turn    `json:"turns"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Last returns the most recent turn, or nil for a new session.
+func (s *Session) Last() *Turn {
+	if len(s.Turns) == 0 {
+		return nil
+	}
+	return &s.Turns[len(s.Turns)-1]
+}
+
+// Store persists sessions. Implementations drop sessions that have not been
+// updated within their TTL.
+type Store interface {
+	Create() (*Session, error)
+	Get(id string) (*Session, error)
+	Save(s *Session) error
+	// Update applies fn to the session with the given id and saves the
+	// result unless fn fails. Updates of the same session run one at a
+	// time, so fn may take long without another update being lost.
+	Update(id string, fn func(*Session) error) error
+	List() ([]*Session, error)
+	Delete(id string) error
+}
+
+func New() *Session {
+	now := time.Now()
+	return &Session{
+		ID:        newID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -13,6 +13,9 @@ type QueryContext struct {
 	GroupBy       []string
 	AdditionalOps []string
 	Rules         []Rule
+	// Alternatives holds other interpretations the LLM considered equally
+	// plausible, used to ask the user for clarification.
+	Alternatives []*QueryContext `json:",omitempty"`
 }
 
 type TimeRange struct {
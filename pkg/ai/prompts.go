@@ -1,5 +1,10 @@
 package ai
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	default_prompt = `
 	Summarize the given Kubernetes error message, enclosed by triple dashes, in --- %s --- language; --- %s ---.  
@@ -20,17 +25,16 @@ const (
 	Available metrics and their labels:
 	%s
 
-	Valid PromQL examples:
-	- Simple sum: sum(prometheus_http_response_size_bytes_sum)
-	- Rate with time: rate(prometheus_http_requests_total[5m])
-	- Filtered sum: sum(prometheus_http_requests_total{code="200"})
+	Valid PromQL examples:%s
 
 	Return ONLY a JSON object with these fields:
 	{
 		"metric": "exact_metric_name_from_list",
 		"labels": {"label": "value"},
 		"timeRange": "5m",      // Omit for sum aggregation
-		"aggregation": ""    // sum/rate/avg/count/increase - Leave empty if no aggregation needed
+		"aggregation": "",   // sum/rate/avg/count/increase - Leave empty if no aggregation needed
+		"groupBy": [],       // Labels to break the result down by - Leave empty if not requested
+		"alternatives": []   // Other equally plausible {"metric", "labels"} choices - Leave empty if the query is unambiguous
 	}
 
 	Rules:
@@ -44,6 +48,48 @@ const (
 		- count: for occurrences
 		- increase: for total increases`
 
+	promql_follow_up_prompt = `The query is a follow-up to a previous question. Resolve it against the previous answer.
+	Previous question: %s
+	Previous PromQL: %s
+	Previous components: %s
+
+	Keep every component the follow-up does not change. For example:
+	- "now break that down by pod" adds "pod" to groupBy
+	- "only for production" adds a matching label filter
+	- "over the last hour instead" changes timeRange
+	Return the complete updated JSON object.`
+
+	promql_correction_prompt = `Prometheus rejected the PromQL built from your previous answer.
+	PromQL: %s
+	Components: %s
+	Error (%s): %s
+
+	Fix the components so the query is valid, for example by choosing a metric that exists, dropping a label the metric does not have or using an aggregation that suits its type.
+	Return the complete corrected JSON object.`
+
+	promql_candidates_prompt = `Instead of a single object, return a JSON array of up to %d alternative interpretations of the query.
+	Each element has the fields described above plus "description": a short phrase saying what it measures.
+	Prefer genuinely different angles such as traffic, errors, latency and saturation over small variations of one query.`
+
+	promql_polish_prompt = `Rewrite the structural explanation of this PromQL query as a short, clear paragraph for an engineer reading someone else's dashboard.
+	Query: %s
+	Steps, innermost first:
+	%s
+	Only use facts from the steps. Mention what is measured, how it is filtered, the time window and what the result is grouped by.`
+
+	result_summary_prompt = `Answer the question using the statistics computed from the query result.
+	Question: %s
+	Query: %s
+	Statistics: %s
+	Reply in one or two sentences an on-call engineer can act on, such as "checkout p99 latency peaked at 2.3s at 14:05 and is now 400ms".
+	Only use numbers from the statistics and include units when the query makes them clear.`
+
+	alert_runbook_prompt = `Write a short runbook for the Prometheus alert below as 3 to 5 numbered steps an on-call engineer follows to investigate and mitigate it.
+	Alert: %s
+	Condition: %s
+	Expression: %s
+	Return only the numbered steps as plain text, one per line.`
+
 	promql_context_extractor = `
 	Extract PromQL query components from: "%s"
 	Return JSON with:
@@ -54,9 +100,33 @@ const (
 	`
 )
 
+// ExampleQueries are the accepted queries shown to the LLM in the
+// PromQLBuilder prompt. Counters are always wrapped in rate.
+var ExampleQueries = []string{
+	"sum(process_resident_memory_bytes)",
+	"rate(prometheus_http_requests_total[5m])",
+	`sum by (handler) (rate(prometheus_http_requests_total{code="200"}[5m]))`,
+}
+
+// builderPrompt lists ExampleQueries in the PromQLBuilder prompt, keeping
+// its first %s for the available metrics.
+func builderPrompt() string {
+	var examples strings.Builder
+	for _, q := range ExampleQueries {
+		examples.WriteString("\n\t- " + strings.ReplaceAll(q, "%", "%%"))
+	}
+	return fmt.Sprintf(promql_query_builder, "%s", examples.String())
+}
+
 var PromptMap = map[string]string{
 	"default":                default_prompt,
 	"PromQLExplanation":      promql_explaination_prompt,
-	"PromQLBuilder":          promql_query_builder,
+	"PromQLBuilder":          builderPrompt(),
 	"PromQLContextExtractor": promql_context_extractor,
+	"PromQLFollowUp":         promql_follow_up_prompt,
+	"PromQLCandidates":       promql_candidates_prompt,
+	"PromQLCorrection":       promql_correction_prompt,
+	"PromQLPolish":           promql_polish_prompt,
+	"ResultSummary":          result_summary_prompt,
+	"AlertRunbook":           alert_runbook_prompt,
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/eval"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/provider/openai"
+	"gopkg.in/yaml.v3"
+)
+
+// TestGoldenDataset scores the conversion pipeline on golden.yaml. With
+// OPENAI_API_KEY set it asks the model TXT2PROMQL_EVAL_MODEL picks; without
+// it, it runs offline on the scripted answers in mock.yaml.
+// TXT2PROMQL_EVAL_REPORT saves the report and TXT2PROMQL_EVAL_MIN_ACCURACY
+// fails the test below that accuracy; offline runs default to
+// offlineMinAccuracy.
+func TestGoldenDataset(t *testing.T) {
+	llm, offline, err := evalLLM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataset, err := eval.LoadDataset("golden.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Generated queries are validated on a fake Prometheus serving the
+	// dataset's synthetic data.
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err := srv.Load(dataset.SyntheticLoad()); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := eval.NewRunner(dataset, prometheus.NewClientFor(srv.Start(), 5*time.Second), llm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+
+	report, err := runner.Run(context.Background(), eval.RunOptions{
+		OnCase: func(res eval.CaseResult) {
+			if !res.Correct() {
+				t.Logf("%s: expected %s, got %s %s%s", res.ID, res.Expected, res.Actual, res.Error, res.Note)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range report.Categories {
+		t.Logf("%-12s %2d cases  result %.0f%%  ast %.0f%%  exact %.0f%%  %s  %d tokens",
+			s.Category, s.Cases, s.Result*100, s.AST*100, s.Exact*100, s.MeanLatency, s.Tokens)
+	}
+
+	if path := os.Getenv("TXT2PROMQL_EVAL_REPORT"); path != "" {
+		if err := report.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	min, err := strconv.ParseFloat(os.Getenv("TXT2PROMQL_EVAL_MIN_ACCURACY"), 64)
+	if err != nil {
+		if !offline {
+			return
+		}
+		min = offlineMinAccuracy
+	}
+	if report.Overall.Result < min {
+		t.Errorf("accuracy %.1f%% is below %.1f%%", report.Overall.Result*100, min*100)
+	}
+}
+
+// offlineMinAccuracy is the floor for the scripted answers in mock.yaml,
+// which get 7 of the 16 golden cases right; losing any of them fails.
+const offlineMinAccuracy = 0.4
+
+// evalLLM returns the provider to evaluate and whether it is the offline mock.
+func evalLLM() (provider.Provider, bool, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		content, err := os.ReadFile("mock.yaml")
+		if err != nil {
+			return nil, true, err
+		}
+		var cfg mock.Config
+		if err := yaml.Unmarshal(content, &cfg); err != nil {
+			return nil, true, err
+		}
+		llm, err := mock.NewFromConfig(cfg)
+		if err != nil {
+			return nil, true, err
+		}
+		return llm, true, nil
+	}
+	model := os.Getenv("TXT2PROMQL_EVAL_MODEL")
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+	llm, err := openai.NewClient(&openai.Config{APIKey: apiKey, Model: model})
+	if err != nil {
+		return nil, false, err
+	}
+	return llm, false, nil
+}
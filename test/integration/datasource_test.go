@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+)
+
+// startFake serves the series of a "load" block on a fresh fake Prometheus.
+func startFake(t *testing.T, load string) string {
+	t.Helper()
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	if err := srv.Load(load); err != nil {
+		t.Fatal(err)
+	}
+	return srv.Start()
+}
+
+func newTestRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+	sources, err := prometheus.NewRegistry([]prometheus.DatasourceConfig{
+		{Name: "eu", Address: startFake(t, "load 1m\n  http_requests_total{job=\"api\"} 0+60x60\n"), Retention: "15d", Default: true},
+		{Name: "us", Address: startFake(t, "load 1m\n  node_memory_MemAvailable_bytes{instance=\"n1\"} 1x60\n"), Retention: "15d"},
+		{Name: "thanos", Address: startFake(t, "load 1m\n  http_requests_total{job=\"api\"} 0+60x60\n  node_memory_MemAvailable_bytes{instance=\"n1\"} 1x60\n"), LongTerm: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sources
+}
+
+func TestDatasourceRouting(t *testing.T) {
+	sources := newTestRegistry(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		metric   string
+		lookback time.Duration
+		want     string
+	}{
+		{"http_requests_total", time.Hour, "eu"},
+		{"node_memory_MemAvailable_bytes", time.Hour, "us"},
+		{"node_memory_MemAvailable_bytes", 90 * 24 * time.Hour, "thanos"},
+		{"unknown_metric", 0, "eu"},
+	}
+	for _, tt := range tests {
+		if ds, reason := sources.Route(ctx, tt.metric, tt.lookback); ds.Name != tt.want {
+			t.Errorf("%s over %s: routed to %s (%s), want %s", tt.metric, tt.lookback, ds.Name, reason, tt.want)
+		}
+	}
+
+	if ds, _ := sources.RouteQuery(ctx, `max_over_time(node_memory_MemAvailable_bytes[30d])`, 0); ds.Name != "thanos" {
+		t.Errorf("30d range routed to %s, want thanos", ds.Name)
+	}
+
+	metrics, err := sources.Metrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics["http_requests_total"].Series != 2 || len(metrics) != 2 {
+		t.Errorf("merged schema: %+v", metrics)
+	}
+}
+
+func TestPipelineRoutesToDatasource(t *testing.T) {
+	sources := newTestRegistry(t)
+	llm, _ := mock.New([]mock.Rule{{
+		Pattern:  `Query: available memory$`,
+		Response: `{"metric": "node_memory_MemAvailable_bytes", "labels": {}}`,
+	}, {
+		Pattern:  `Query: memory overview$`,
+		Response: `[{"metric": "node_memory_MemAvailable_bytes", "labels": {}, "description": "available memory"}]`,
+	}}, nil, "explanation")
+	pipeline := agent.NewPipelineFor(sources, llm)
+	ctx := context.Background()
+
+	res, err := pipeline.Convert(ctx, "available memory", agent.ConvertOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datasource != "us" || !res.Validation.Valid || res.Validation.Series != 1 {
+		t.Errorf("got %s on %s, validation %+v", res.PromQL, res.Datasource, res.Validation)
+	}
+
+	res, err = pipeline.Convert(ctx, "available memory", agent.ConvertOptions{Datasource: "thanos"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datasource != "thanos" {
+		t.Errorf("explicit datasource: got %s", res.Datasource)
+	}
+
+	// A 30 day graph needs long-term storage even though the query itself
+	// only looks at the latest sample.
+	res, err = pipeline.Convert(ctx, "available memory", agent.ConvertOptions{Lookback: 30 * 24 * time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datasource != "thanos" {
+		t.Errorf("30d lookback: got %s, want thanos", res.Datasource)
+	}
+
+	res, err = pipeline.Convert(ctx, "memory overview", agent.ConvertOptions{Candidates: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datasource != "us" || len(res.Candidates) != 1 {
+		t.Errorf("candidates: got datasource %q, %d candidates", res.Datasource, len(res.Candidates))
+	}
+
+	res, err = pipeline.Resolve(ctx, res.Context, "", 30*24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datasource != "thanos" {
+		t.Errorf("resolve over 30d: got %s, want thanos", res.Datasource)
+	}
+
+	if _, err := pipeline.Convert(ctx, "available memory", agent.ConvertOptions{Datasource: "apac"}, nil); err == nil {
+		t.Error("unknown datasource accepted")
+	}
+}
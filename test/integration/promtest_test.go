@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/promtest"
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+func newFakePrometheus(t *testing.T) *prometheus.Client {
+	t.Helper()
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	for _, path := range []string{"testdata/series.yaml", "testdata/node.om"} {
+		if err := srv.LoadFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return prometheus.NewClientFor(srv.Start(), 5*time.Second)
+}
+
+func TestFakePrometheusAPI(t *testing.T) {
+	client := newFakePrometheus(t)
+	ctx := context.Background()
+
+	res, err := client.Query(ctx, `sum by (job) (rate(http_requests_total[5m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Data.ResultType != "vector" || len(res.Data.Result) != 2 {
+		t.Fatalf("got %s with %d series, want a vector of 2", res.Data.ResultType, len(res.Data.Result))
+	}
+	for _, s := range res.Data.Result {
+		want := map[string]float64{"api": 1.1, "web": 0.5}[s.Metric["job"]]
+		if s.Value.Value != want {
+			t.Errorf("job %s: got rate %v, want %v", s.Metric["job"], s.Value.Value, want)
+		}
+	}
+
+	ts := promtest.Start.Add(45 * time.Minute)
+	res, err = client.QueryInstant(ctx, `up == 0`, &ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data.Result) != 1 || res.Data.Result[0].Metric["job"] != "web" {
+		t.Errorf("up == 0 at 45m: got %v", res.Data.Result)
+	}
+
+	res, err = client.QueryRange(ctx, `up`, promtest.Start, promtest.Start.Add(time.Hour), 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Data.ResultType != "matrix" || len(res.Data.Result) != 2 || len(res.Data.Result[0].Values) != 5 {
+		t.Errorf("range query: got %+v", res.Data)
+	}
+
+	metadata, err := client.Metadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := metadata["node_memory_MemAvailable_bytes"]; len(md) != 1 || md[0].Type != "gauge" || md[0].Unit != "bytes" {
+		t.Errorf("metadata: got %v", metadata)
+	}
+
+	validation, err := client.ValidateQuery(ctx, `sum(rate(http_requests_total[5m])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validation.Valid {
+		t.Error("unbalanced query validated")
+	}
+}
+
+func TestPipelineAgainstFakePrometheus(t *testing.T) {
+	client := newFakePrometheus(t)
+	llm, err := mock.New([]mock.Rule{{
+		Pattern:  `Query: request rate per job$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate", "groupBy": ["job"]}`,
+	}}, nil, "The query returns the request rate of each job.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := agent.NewPipeline(client, llm)
+	metrics, err := pipeline.Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema := metrics["node_memory_MemAvailable_bytes"]; schema.Type != "gauge" || schema.Help == "" {
+		t.Errorf("discovered schema: got %+v", schema)
+	}
+	if values := metrics["http_requests_total"].LabelValues["job"]; len(values) != 2 {
+		t.Errorf("discovered job values: got %v", values)
+	}
+
+	res, err := pipeline.Convert(context.Background(), "request rate per job", agent.ConvertOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Validation == nil || !res.Validation.Valid || res.Validation.Series != 2 {
+		t.Errorf("got %s, validation %+v", res.PromQL, res.Validation)
+	}
+}
+
+func TestConvertAgainstSnapshot(t *testing.T) {
+	client := newFakePrometheus(t)
+	metrics, err := prometheus.NewSchemaManager(client).Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := prometheus.NewSnapshot(metrics, "fake", 1).Encode(&buf, "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := prometheus.ParseSnapshot(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := snapshot.Schema()["http_requests_total"]
+	if requests.Series != 3 || len(requests.LabelValues["job"]) != 1 {
+		t.Errorf("snapshot kept %+v", requests)
+	}
+
+	llm, _ := mock.New([]mock.Rule{{
+		Pattern:  `Query: request rate per job$`,
+		Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "rate", "groupBy": ["job"]}`,
+	}}, nil, "explanation")
+	// Nothing listens here: the conversion must not need Prometheus.
+	pipeline := agent.NewPipeline(prometheus.NewClientFor("http://127.0.0.1:1", time.Second), llm)
+	pipeline.UseSnapshot(snapshot)
+
+	res, err := pipeline.Convert(context.Background(), "request rate per job", agent.ConvertOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Validation.Valid || !res.Validation.Offline || res.Validation.Series != 3 {
+		t.Errorf("got %s, validation %+v", res.PromQL, res.Validation)
+	}
+}
+
+func TestPrometheusAPIErrors(t *testing.T) {
+	client := newFakePrometheus(t)
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, `sum(http_requests_total[5m])`)
+	var apiErr *prometheus.APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != prometheus.ErrBadData || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %v, want a bad_data API error", err)
+	}
+	if prometheus.HTTPStatus(err) != http.StatusBadRequest {
+		t.Errorf("bad_data maps to %d", prometheus.HTTPStatus(err))
+	}
+
+	validation, err := client.ValidateQuery(ctx, `sum(http_requests_total[5m])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validation.Valid || validation.ErrorType != prometheus.ErrBadData || !strings.Contains(validation.Error, "range vector") {
+		t.Errorf("validation: %+v", validation)
+	}
+
+	_, err = prometheus.NewClientFor("http://127.0.0.1:1", time.Second).Query(ctx, "up")
+	if !errors.As(err, &apiErr) || apiErr.Type != prometheus.ErrUnavailable {
+		t.Errorf("unreachable Prometheus: got %v", err)
+	}
+	if _, err := prometheus.NewClientFor("http://127.0.0.1:1", time.Second).ValidateQuery(ctx, "up"); !errors.As(err, &apiErr) {
+		t.Errorf("validating on unreachable Prometheus: got %v", err)
+	}
+}
+
+func TestMalformedPrometheusResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"no status", http.StatusOK, `{}`, "decoding response: missing status"},
+		{"long proxy page", http.StatusBadGateway, strings.Repeat("é", 150), strings.Repeat("é", 100) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			_, err := prometheus.NewClientFor(srv.URL, time.Second).Query(context.Background(), "up")
+			if err == nil {
+				t.Fatal("no error")
+			}
+			msg := err.Error()
+			var apiErr *prometheus.APIError
+			if errors.As(err, &apiErr) {
+				msg = apiErr.Msg
+			}
+			if msg != tt.want || !utf8.ValidString(msg) {
+				t.Errorf("got %q, want %q", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineCorrectsRejectedQuery(t *testing.T) {
+	llm, _ := mock.New([]mock.Rule{
+		{
+			Pattern:  `(?s)Error \(bad_data\).*Query: total requests$`,
+			Response: `{"metric": "http_requests_total", "labels": {}, "aggregation": "sum"}`,
+		},
+		{
+			Pattern:  `Query: total requests$`,
+			Response: `{"metric": "http_requests_total", "labels": {}, "timeRange": "5m", "aggregation": "sum"}`,
+		},
+	}, nil, "explanation")
+	pipeline := agent.NewPipeline(newFakePrometheus(t), llm)
+
+	res, err := pipeline.Convert(context.Background(), "total requests", agent.ConvertOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Validation.Valid || res.Correction == nil || res.Correction.ErrorType != prometheus.ErrBadData {
+		t.Fatalf("got %s, correction %+v, validation %+v", res.PromQL, res.Correction, res.Validation)
+	}
+	if res.PromQL == res.Correction.PromQL {
+		t.Errorf("corrected query is the rejected one: %s", res.PromQL)
+	}
+}
+
+func TestHistogramSumCountTypedAsCounters(t *testing.T) {
+	srv, err := promtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	if err := srv.LoadFile("testdata/latency.om"); err != nil {
+		t.Fatal(err)
+	}
+	client := prometheus.NewClientFor(srv.Start(), 5*time.Second)
+	metrics, err := prometheus.NewSchemaManager(client).Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"http_request_duration_seconds_bucket": "histogram",
+		"http_request_duration_seconds_sum":    "counter",
+		"http_request_duration_seconds_count":  "counter",
+	} {
+		if got := metrics[name].Type; got != want {
+			t.Errorf("%s: got type %q, want %q", name, got, want)
+		}
+	}
+
+	queryCtx := &types.QueryContext{
+		Query:       "average request latency",
+		MainMetric:  "http_request_duration_seconds_sum",
+		Aggregation: "rate",
+	}
+	validation := &prometheus.ValidationResult{Valid: true, Series: 1}
+	confidence := agent.NewScorer(nil).Score(queryCtx,
+		`rate(http_request_duration_seconds_sum[5m]) / rate(http_request_duration_seconds_count[5m])`,
+		validation, metrics)
+	for _, f := range confidence.Factors {
+		if f.Name == agent.FactorTypeMatch && f.Score != 1 {
+			t.Errorf("average of sum and count penalised: %+v", f)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+func TestBuilderGroupBy(t *testing.T) {
+	qb := agent.NewQueryBuilder()
+	cases := []struct {
+		ctx  types.QueryContext
+		want string
+	}{
+		{
+			ctx:  types.QueryContext{MainMetric: "up", Aggregation: "sum", GroupBy: []string{"job"}},
+			want: "sum by (job) (up)",
+		},
+		{
+			ctx: types.QueryContext{
+				MainMetric:  "http_requests_total",
+				Aggregation: "rate",
+				TimeRange:   types.TimeRange{Duration: 5 * time.Minute},
+				GroupBy:     []string{"pod"},
+			},
+			want: "sum by (pod) (rate(http_requests_total[5m0s]))",
+		},
+	}
+
+	for _, c := range cases {
+		got, _ := qb.Build(&c.ctx)
+		if got != c.want {
+			t.Errorf("Build() = %q, want %q", got, c.want)
+		}
+	}
+}
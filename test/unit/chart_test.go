@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+func decodeResult(t *testing.T, body string) *prometheus.QueryResult {
+	t.Helper()
+	var result prometheus.QueryResult
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func TestChartSuggest(t *testing.T) {
+	matrix := decodeResult(t, `{"data":{"resultType":"matrix","result":[
+		{"metric":{"job":"api"},"values":[[1,"1"],[2,"2"]]},
+		{"metric":{"job":"web"},"values":[[1,"3"],[2,"4"]]}
+	]}}`)
+	vector := decodeResult(t, `{"data":{"resultType":"vector","result":[
+		{"metric":{"job":"api"},"value":[1,"1"]},
+		{"metric":{"job":"web"},"value":[1,"3"]}
+	]}}`)
+	single := decodeResult(t, `{"data":{"resultType":"vector","result":[
+		{"metric":{"handler":"/api/total"},"value":[1,"1"]}
+	]}}`)
+
+	tests := []struct {
+		name    string
+		promQL  string
+		result  *prometheus.QueryResult
+		want    string
+		stacked bool
+		unit    string
+		legend  string
+	}{
+		{"stacked rate", `sum by (job) (rate(http_requests_total[5m]))`, matrix, chart.TypeTimeSeries, true, "reqps", "{{job}}"},
+		{"heatmap", `sum by (le) (rate(http_request_duration_seconds_bucket[5m]))`, matrix, chart.TypeHeatmap, false, "s", "{{le}}"},
+		{"pie", `count by (job) (up)`, vector, chart.TypePie, false, "", "{{job}}"},
+		{"topk", `topk(5, sum by (job) (rate(http_requests_total[5m])))`, vector, chart.TypeBar, false, "reqps", "{{job}}"},
+		{"label value is not a function", `http_requests{handler="/api/total"}`, single, chart.TypeGauge, false, "", ""},
+		{"latency quantile", `histogram_quantile(0.99, sum by (le) (rate(http_request_duration_seconds_bucket[5m])))`, matrix, chart.TypeTimeSeries, false, "s", "{{job}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chart.Suggest(tt.promQL, tt.result, nil)
+			if got.Type != tt.want || got.Stacked != tt.stacked || got.Unit != tt.unit || got.LegendFormat != tt.legend {
+				t.Errorf("Suggest(%s) = %+v", tt.promQL, got)
+			}
+		})
+	}
+}
+
+func TestChartRender(t *testing.T) {
+	buckets := decodeResult(t, `{"data":{"resultType":"matrix","result":[
+		{"metric":{"le":"0.1"},"values":[[60,"1"],[120,"2"]]},
+		{"metric":{"le":"+Inf"},"values":[[60,"3"],[120,"5"]]}
+	]}}`)
+	matrix := decodeResult(t, `{"data":{"resultType":"matrix","result":[
+		{"metric":{"job":"api"},"values":[[60,"1"],[120,"2"]]}
+	]}}`)
+
+	for _, chartType := range []string{chart.TypeTimeSeries, chart.TypeBar, chart.TypeGauge, chart.TypeHeatmap} {
+		for _, format := range []string{chart.FormatPNG, chart.FormatSVG} {
+			result := matrix
+			if chartType == chart.TypeHeatmap {
+				result = buckets
+			}
+			var buf bytes.Buffer
+			err := chart.Render(&buf, result, chart.Suggestion{}, chart.RenderOptions{
+				Type:   chartType,
+				Format: format,
+				Theme:  chart.ThemeDark,
+				Legend: true,
+			})
+			if err != nil {
+				t.Fatalf("%s/%s: %v", chartType, format, err)
+			}
+			if buf.Len() == 0 {
+				t.Fatalf("%s/%s: empty image", chartType, format)
+			}
+		}
+	}
+
+	for _, opts := range []chart.RenderOptions{
+		{Format: "gif"},
+		{Type: "piee"},
+		{Theme: "solarized"},
+		{Width: 5000},
+	} {
+		if err := chart.Render(&bytes.Buffer{}, matrix, chart.Suggestion{}, opts); !errors.Is(err, chart.ErrInvalidOptions) {
+			t.Errorf("%+v: got %v, want an invalid options error", opts, err)
+		}
+	}
+}
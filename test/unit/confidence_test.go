@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/types"
+	"github.com/agentkube/txt2promql/pkg/ai"
+)
+
+func TestScorerRewardsRateOnCounter(t *testing.T) {
+	metrics := map[string]prometheus.MetricSchema{
+		"http_requests_total": {
+			Name:        "http_requests_total",
+			Type:        "counter",
+			LabelValues: map[string][]string{"job": {"api"}},
+		},
+	}
+	validation := &prometheus.ValidationResult{Valid: true, Series: 1}
+	scorer := agent.NewScorer(nil)
+
+	good := scorer.Score(&types.QueryContext{
+		Query:       "request rate for the api job",
+		MainMetric:  "http_requests_total",
+		Labels:      map[string]string{"job": "api"},
+		Aggregation: "rate",
+	}, `rate(http_requests_total{job="api"}[5m])`, validation, metrics)
+
+	bad := scorer.Score(&types.QueryContext{
+		Query:       "request rate for the api job",
+		MainMetric:  "http_requests_total",
+		Labels:      map[string]string{"job": "web"},
+		Aggregation: "sum",
+	}, `sum(http_requests_total{job="web"})`, validation, metrics)
+
+	if good.Score <= bad.Score {
+		t.Fatalf("expected rate on counter to score higher: good=%v bad=%v", good.Score, bad.Score)
+	}
+	if good.Score > 1 || bad.Score < 0 {
+		t.Fatalf("scores out of range: good=%v bad=%v", good.Score, bad.Score)
+	}
+}
+
+func TestBuilderPromptShowsExampleQueries(t *testing.T) {
+	prompt := fmt.Sprintf(ai.PromptMap["PromQLBuilder"], "http_requests_total")
+	for _, q := range ai.ExampleQueries {
+		if !strings.Contains(prompt, "- "+q+"\n") {
+			t.Errorf("PromQLBuilder prompt does not show %s", q)
+		}
+	}
+	if strings.Contains(prompt, "%!") {
+		t.Errorf("PromQLBuilder prompt has a formatting error:\n%s", prompt)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/eval"
+)
+
+func TestGoldenDatasetEvaluates(t *testing.T) {
+	dataset, err := eval.LoadDataset("../eval/golden.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluator, err := eval.NewEvaluator(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer evaluator.Close()
+
+	ctx := context.Background()
+	for _, c := range dataset.Cases {
+		ok, reason, err := evaluator.Equivalent(ctx, c.Expected, c.Expected)
+		if err != nil || !ok {
+			t.Errorf("%s: expected query does not evaluate on synthetic data: %v %s", c.ID, err, reason)
+		}
+	}
+
+	for _, q := range []struct {
+		expected, actual string
+		equivalent       bool
+	}{
+		{`sum(rate(http_requests_total[5m]))`, `sum(irate(http_requests_total[5m])) * 0 + sum(rate(http_requests_total[5m]))`, true},
+		{`sum by (job) (rate(http_requests_total[5m]))`, `sum by (job) (rate(http_requests_total[10m]))`, false},
+		{`up == 0`, `up < 1`, true},
+		{`sum by (job) (rate(http_requests_total[5m]))`, `sum by (method) (rate(http_requests_total[5m]))`, false},
+	} {
+		ok, reason, err := evaluator.Equivalent(ctx, q.expected, q.actual)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != q.equivalent {
+			t.Errorf("%s vs %s: equivalent=%v (%s)", q.expected, q.actual, ok, reason)
+		}
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	previous := &eval.Report{Results: []eval.CaseResult{
+		{ID: "a", Category: "rate", Actual: "x", Result: true},
+		{ID: "b", Category: "rate", Actual: "y"},
+		{ID: "c", Category: "rate", Actual: "z"},
+	}}
+	current := &eval.Report{Results: []eval.CaseResult{
+		{ID: "a", Category: "rate", Actual: "x2"},
+		{ID: "b", Category: "rate", Actual: "y2", AST: true},
+		{ID: "d", Category: "rate", Actual: "w"},
+	}}
+	diff := eval.Compare(previous, current)
+	if len(diff.Regressed) != 1 || diff.Regressed[0].ID != "a" || len(diff.Fixed) != 1 || diff.Fixed[0].ID != "b" {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	if len(diff.Added) != 1 || diff.Added[0] != "d" || len(diff.Removed) != 1 || diff.Removed[0] != "c" {
+		t.Errorf("unexpected added/removed %v %v", diff.Added, diff.Removed)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/query"
+)
+
+func TestExplainDescribesEachNode(t *testing.T) {
+	e, err := query.Explain(`sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d: %+v", len(e.Steps), e.Steps)
+	}
+	for i, want := range []string{"where code matches /5../", "5m window", "one per distinct job"} {
+		if !strings.Contains(e.Steps[i].Text, want) {
+			t.Errorf("step %d = %q, want it to mention %q", i, e.Steps[i].Text, want)
+		}
+	}
+}
+
+func TestExplainPercentiles(t *testing.T) {
+	for q, want := range map[string]string{
+		"0.29":  "29th percentile",
+		"0.01":  "1st percentile",
+		"0.02":  "2nd percentile",
+		"0.03":  "3rd percentile",
+		"0.11":  "11th percentile",
+		"0.5":   "50th percentile",
+		"0.999": "99.9th percentile",
+	} {
+		e, err := query.Explain(`histogram_quantile(` + q + `, rate(http_request_duration_seconds_bucket[5m]))`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text := e.Steps[len(e.Steps)-1].Text; !strings.Contains(text, " "+want) {
+			t.Errorf("%s: got %q, want the %s", q, text, want)
+		}
+	}
+}
+
+func TestExplainLiteral(t *testing.T) {
+	for _, promQL := range []string{`42`, `(42)`, `"up"`} {
+		e, err := query.Explain(promQL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(e.Steps) != 1 || e.Summary == "" {
+			t.Errorf("%s: got steps %+v, summary %q", promQL, e.Steps, e.Summary)
+		}
+	}
+}
+
+func TestExplainRejectsInvalidQuery(t *testing.T) {
+	if _, err := query.Explain(`sum(rate(`); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
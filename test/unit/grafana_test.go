@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/chart"
+	"github.com/agentkube/txt2promql/internal/grafana"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+func TestGrafanaTemplatize(t *testing.T) {
+	metrics := map[string]prometheus.MetricSchema{
+		"http_requests_total": {LabelValues: map[string][]string{"namespace": {"a"}, "job": {"api"}}},
+		"up":                  {LabelValues: map[string][]string{"job": {"api"}}},
+	}
+
+	exprs, variables, err := grafana.Templatize([]string{
+		`sum by (job) (rate(http_requests_total{job="api"}[5m]))`,
+		`up`,
+	}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(variables) != 1 || variables[0].Label != "job" {
+		t.Fatalf("expected only a job variable, got %+v", variables)
+	}
+	if exprs[0] != `sum by (job) (rate(http_requests_total{job="api"}[5m]))` {
+		t.Errorf("existing matcher was replaced: %s", exprs[0])
+	}
+	if exprs[1] != `up{job=~"$job"}` {
+		t.Errorf("unexpected templated query: %s", exprs[1])
+	}
+}
+
+func TestGrafanaBuild(t *testing.T) {
+	d := grafana.Build([]grafana.PanelSpec{
+		{Title: "a", PromQL: "up", Suggestion: chart.Suggestion{Type: chart.TypeTimeSeries, Stacked: true, Unit: "reqps"}},
+		{Title: "b", PromQL: "up", Suggestion: chart.Suggestion{Type: chart.TypeHeatmap}},
+		{Title: "c", PromQL: "up"},
+	}, grafana.Options{DatasourceVariable: true})
+
+	if len(d.Panels) != 3 || len(d.Templating.List) != 1 {
+		t.Fatalf("unexpected dashboard %+v", d)
+	}
+	if p := d.Panels[0]; p.Type != "timeseries" || p.FieldConfig.Defaults.Unit != "reqps" || p.FieldConfig.Defaults.Custom["stacking"] == nil {
+		t.Errorf("unexpected first panel %+v", p)
+	}
+	if p := d.Panels[1]; p.Type != "heatmap" || p.Targets[0].Format != "heatmap" || p.GridPos.X != 12 {
+		t.Errorf("unexpected second panel %+v", p)
+	}
+	if p := d.Panels[2]; p.GridPos.Y != 8 || p.Datasource.UID != "${datasource}" {
+		t.Errorf("unexpected third panel %+v", p)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/spf13/viper"
+)
+
+func TestDatasourceHTTPConfig(t *testing.T) {
+	var auth, tenant string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, tenant = r.Header.Get("Authorization"), r.Header.Get("X-Scope-OrgID")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(fmt.Sprintf(`
+prometheus:
+  timeout: 5s
+  datasources:
+    - name: mimir
+      address: %s
+      http_config:
+        authorization:
+          credentials_file: %s
+        http_headers:
+          X-Scope-OrgID:
+            values: [platform]
+        tls_config:
+          insecure_skip_verify: true
+`, srv.URL, tokenFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := prometheus.LoadRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := sources.Default().Client
+	ctx := context.Background()
+
+	if _, err := client.Query(ctx, "up"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer first" || tenant != "platform" {
+		t.Errorf("got Authorization %q, X-Scope-OrgID %q", auth, tenant)
+	}
+
+	// A rotated token is picked up on the next request.
+	if err := os.WriteFile(tokenFile, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Query(ctx, "up"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer second" {
+		t.Errorf("after rotation got Authorization %q", auth)
+	}
+}
+
+func TestDatasourceHTTPConfigInvalid(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+prometheus:
+  http_config:
+    basic_auth:
+      username: u
+      password: p
+    authorization:
+      credentials: token
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prometheus.LoadRegistry(); err == nil {
+		t.Error("basic_auth together with authorization accepted")
+	}
+}
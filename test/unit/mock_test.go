@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/provider/mock"
+)
+
+func TestMockProvider(t *testing.T) {
+	p, err := mock.New([]mock.Rule{
+		{Pattern: `Query: (?P<metric>\w+) per (\w+)$`, Response: `{"metric": "${metric}", "groupBy": ["$2"]}`},
+	}, []mock.Exchange{
+		{Prompt: "Query: up per job", Response: "recorded"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if got, _ := p.Complete(ctx, "Query: up per job"); got != "recorded" {
+		t.Errorf("fixture: got %q", got)
+	}
+	if got, _ := p.Complete(ctx, "schema...\n\nQuery: memory per pod"); got != `{"metric": "memory", "groupBy": ["pod"]}` {
+		t.Errorf("rule: got %q", got)
+	}
+	if _, err := p.Complete(ctx, "Query: something else"); !errors.Is(err, mock.ErrNoResponse) {
+		t.Errorf("unmatched prompt: got error %v", err)
+	}
+
+	var tokens string
+	got, err := p.CompleteStream(ctx, "Query: up per job", func(token string) { tokens += token })
+	if err != nil || tokens != got {
+		t.Errorf("stream: tokens %q, response %q, err %v", tokens, got, err)
+	}
+	if n := len(p.Calls()); n != 4 {
+		t.Errorf("got %d calls, want 4", n)
+	}
+}
+
+func TestMockRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.yaml")
+	live, _ := mock.New(nil, nil, "live answer")
+	recorder, err := mock.NewRecorder(live, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, prompt := range []string{"Query: a", "Query: b", "Query: a"} {
+		if _, err := recorder.Complete(ctx, prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exchanges, err := mock.LoadFixtures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("got %d exchanges, want 2: %v", len(exchanges), exchanges)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary fixture file left behind: %v", err)
+	}
+	replay, err := mock.NewFromConfig(mock.Config{Fixtures: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := replay.Complete(ctx, "Query: b"); err != nil || got != "live answer" {
+		t.Errorf("replay: got %q, %v", got, err)
+	}
+}
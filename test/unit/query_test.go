@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/query"
+)
+
+func TestNormalizeIgnoresLabelOrderAndFormatting(t *testing.T) {
+	a, err := query.Normalize(`sum by (job, pod) (rate(http_requests_total{code="500",job="api"}[5m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := query.Normalize(`sum  by(pod,job)(rate(http_requests_total{ job="api", code="500" }[5m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatalf("expected equal normalized queries:\n%s\n%s", a, b)
+	}
+}
+
+func TestNormalizeParentheses(t *testing.T) {
+	for _, pair := range [][2]string{
+		{`sum(rate(x{b="1",a="2"}[5m])) by (job, le)`, `sum by (le, job) (rate(x{a="2", b="1"}[5m]))`},
+		{`((up))`, `up`},
+		{`(sum(x)) / (sum(y))`, `sum(x) / sum(y)`},
+	} {
+		a, err := query.Normalize(pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := query.Normalize(pair[1])
+		if a != b {
+			t.Errorf("%s and %s normalize differently: %s, %s", pair[0], pair[1], a, b)
+		}
+	}
+
+	a, _ := query.Normalize(`(a + b) * c`)
+	b, _ := query.Normalize(`a + b * c`)
+	if a == b {
+		t.Error("parentheses that change precedence must be kept")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/resilience"
+)
+
+func TestResilienceRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch n := calls.Add(1); {
+		case r.URL.Path == "/busy" && n < 3:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/slow-down":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case r.URL.Path == "/gateway":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: resilience.NewTransport("test/retries", resilience.Config{
+		MaxAttempts:      3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       10 * time.Millisecond,
+		FailureThreshold: -1,
+	}, nil)}
+
+	tests := []struct {
+		method, path string
+		status       int
+		calls        int32
+	}{
+		// 503 is retried, honouring Retry-After, until it succeeds.
+		{http.MethodGet, "/busy", http.StatusOK, 3},
+		// A Retry-After beyond max_backoff is returned as is.
+		{http.MethodGet, "/slow-down", http.StatusTooManyRequests, 1},
+		// 502 is retried for idempotent requests only.
+		{http.MethodGet, "/gateway", http.StatusBadGateway, 3},
+		{http.MethodPost, "/gateway", http.StatusBadGateway, 1},
+	}
+	for _, tt := range tests {
+		calls.Store(0)
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader("{}"))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || calls.Load() != tt.calls {
+			t.Errorf("%s %s: got %d after %d calls, want %d after %d", tt.method, tt.path, resp.StatusCode, calls.Load(), tt.status, tt.calls)
+		}
+	}
+}
+
+func TestResilienceCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: resilience.NewTransport("test/breaker", resilience.Config{
+		MaxAttempts:      1,
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+	}, nil)}
+	get := func() error {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	get()
+	get()
+	if state := resilience.Statuses()["test/breaker"].State; state != resilience.Open {
+		t.Fatalf("after 2 failures: state %s", state)
+	}
+	if err := get(); !errors.Is(err, resilience.ErrCircuitOpen) {
+		t.Errorf("open circuit: got %v", err)
+	}
+
+	healthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if state := resilience.Statuses()["test/breaker"].State; state != resilience.Closed {
+		t.Errorf("after a successful trial: state %s", state)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+func TestQueryResultDecoding(t *testing.T) {
+	body := `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"job":"api"},"value":[1700000000.5,"+Inf"]},
+		{"metric":{"job":"web"},"value":[1700000000.5,"2"]},
+		{"metric":{"job":"db"},"histogram":[1700000000.5,{"count":"3","sum":"0.7","buckets":[[0,"0.1","0.2","1"],[0,"0.2","0.4","2"]]}]}
+	]},"warnings":["metric might not be a counter"]}`
+	var result prometheus.QueryResult
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	api := result.Data.Result[0].Value
+	if !math.IsInf(api.Value, 1) || !api.At.Equal(time.UnixMilli(1700000000500)) {
+		t.Errorf("api sample: %+v", api)
+	}
+	h := result.Data.Result[2].Histogram
+	if h == nil || h.Histogram.Count != 3 || len(h.Histogram.Buckets) != 2 || h.Histogram.Buckets[1].Upper != 0.4 {
+		t.Errorf("histogram: %+v", h)
+	}
+	if len(result.Warnings) != 1 || !result.HasHistograms() {
+		t.Errorf("warnings %v, histograms %v", result.Warnings, result.HasHistograms())
+	}
+	if series := result.Series(); len(series) != 1 || series[0].Labels["job"] != "web" {
+		t.Errorf("only the finite float series should remain: %+v", series)
+	}
+
+	// Marshalling gives back what Prometheus sent.
+	out, err := json.Marshal(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got interface{}
+	json.Unmarshal([]byte(body), &want)
+	json.Unmarshal(out, &got)
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(wantJSON, gotJSON) {
+		t.Errorf("round trip:\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+
+	var buf bytes.Buffer
+	if err := result.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "job,timestamp,value\n" +
+		"api,2023-11-14T22:13:20Z,+Inf\n" +
+		"web,2023-11-14T22:13:20Z,2\n" +
+		"db,2023-11-14T22:13:20Z,count=3 sum=0.7\n"
+	if buf.String() != wantCSV {
+		t.Errorf("CSV:\n%s\nwant:\n%s", buf.String(), wantCSV)
+	}
+}
+
+func TestQueryResultScalar(t *testing.T) {
+	var result prometheus.QueryResult
+	if err := json.Unmarshal([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"42"]}}`), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Data.Scalar == nil || result.Data.Scalar.Value != 42 {
+		t.Fatalf("scalar: %+v", result.Data)
+	}
+	if stats := result.Stats(); len(stats) != 1 || stats[0].Last != 42 {
+		t.Errorf("stats: %+v", stats)
+	}
+
+	if err := json.Unmarshal([]byte(`{"status":"success","data":{"resultType":"string","result":[1700000000,"hello"]}}`), &result); err != nil {
+		t.Fatal(err)
+	}
+	columns, rows := result.Table()
+	if len(columns) != 2 || len(rows) != 1 || rows[0][1] != "hello" {
+		t.Errorf("string table: %v %v", columns, rows)
+	}
+}
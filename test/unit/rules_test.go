@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+	"github.com/agentkube/txt2promql/internal/rules"
+	"github.com/prometheus/common/model"
+)
+
+func TestParseAlert(t *testing.T) {
+	spec, err := rules.ParseAlert("alert when checkout error rate is above 5% for 10 minutes, critical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Measure != "checkout error rate" || spec.Operator != ">" || spec.Threshold != 5 || !spec.Percent {
+		t.Errorf("unexpected condition %+v", spec)
+	}
+	if spec.For != 10*time.Minute || spec.Severity != rules.SeverityCritical || spec.Name != "CheckoutErrorRateHigh" {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+
+	spec, err = rules.ParseAlert("p99 latency below 250ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Operator != "<" || spec.Threshold != 0.25 || spec.Name != "P99LatencyLow" {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+
+	if _, err := rules.ParseAlert("checkout is broken"); err == nil {
+		t.Error("expected an error without a threshold")
+	}
+}
+
+func TestRuleFileValidate(t *testing.T) {
+	file := &rules.File{Groups: []rules.Group{{
+		Name: "test",
+		Rules: []rules.Rule{{
+			Alert:       "High",
+			Expr:        `rate(errors_total[5m]) > 0.05`,
+			For:         model.Duration(10 * time.Minute),
+			Annotations: map[string]string{"summary": "{{ $labels.job }} is {{ $value | humanize }}"},
+		}},
+	}}}
+	if problems := file.Validate(); len(problems) != 0 {
+		t.Fatalf("expected a valid file, got %v", problems)
+	}
+	content, _ := file.YAML()
+	if !strings.Contains(string(content), "for: 10m") {
+		t.Errorf("unexpected YAML:\n%s", content)
+	}
+
+	file.Groups[0].Rules[0].Expr = "rate(errors_total[5m] > "
+	if problems := file.Validate(); len(problems) == 0 {
+		t.Fatal("expected an invalid expression to be reported")
+	}
+}
+
+func TestAnalyzeRecording(t *testing.T) {
+	analysis, err := rules.AnalyzeRecording([]string{
+		`sum by (job) (rate(http_requests_total{code="500"}[5m])) / sum by (job) (rate(http_requests_total[5m]))`,
+		`sum by (job) (rate(http_requests_total[5m]))`,
+		`max by (instance) (rate(cpu_seconds_total[1m]))`,
+		`up`,
+		`sum(`,
+	}, rules.RecordingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]int)
+	for _, s := range analysis.Suggestions {
+		names[s.Rule.Record] = s.Occurrences
+	}
+	if names["job:http_requests:rate5m"] != 2 || names["job:http_requests_500:rate5m"] != 1 {
+		t.Errorf("unexpected suggestions %+v", analysis.Suggestions)
+	}
+	if _, ok := names["instance:cpu_seconds:max_rate1m"]; ok {
+		t.Error("a cheap expression seen once should not be recorded")
+	}
+	if len(analysis.Skipped) != 1 {
+		t.Errorf("expected the invalid query to be skipped, got %v", analysis.Skipped)
+	}
+
+	if len(analysis.Rewrites) != 2 || analysis.Rewrites[0].Rewritten != "job:http_requests_500:rate5m / job:http_requests:rate5m" {
+		t.Errorf("unexpected rewrites %+v", analysis.Rewrites)
+	}
+	if errs := analysis.File.Validate(); len(errs) > 0 {
+		t.Errorf("rule file is invalid: %v", errs)
+	}
+}
+
+func TestAnalyzeRecordingMatchesEquivalentExpressions(t *testing.T) {
+	// The same aggregation with its matchers and grouping labels reordered.
+	analysis, err := rules.AnalyzeRecording([]string{
+		`sum by (job, code) (rate(http_requests_total{job="api", code="500"}[5m]))`,
+		`sum by (code, job) (rate(http_requests_total{code="500", job="api"}[5m])) > 1`,
+	}, rules.RecordingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Suggestions) != 1 || analysis.Suggestions[0].Occurrences != 2 {
+		t.Fatalf("unexpected suggestions %+v", analysis.Suggestions)
+	}
+	name := analysis.Suggestions[0].Rule.Record
+	if len(analysis.Rewrites) != 2 || analysis.Rewrites[0].Rewritten != name || analysis.Rewrites[1].Rewritten != name+" > 1" {
+		t.Errorf("unexpected rewrites %+v", analysis.Rewrites)
+	}
+}
+
+func TestReadQueries(t *testing.T) {
+	queries, err := rules.ReadQueries(strings.NewReader("# dashboard\nup\n\n{\"params\":{\"query\":\"sum(rate(x[5m]))\"}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || queries[1] != "sum(rate(x[5m]))" {
+		t.Errorf("unexpected queries %q", queries)
+	}
+}
+
+func TestSLO(t *testing.T) {
+	spec, err := rules.ParseSLO("99.9% of checkout requests succeed over 30 days")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Objective != 0.999 || spec.Window != model.Duration(30*24*time.Hour) || spec.Name != "checkout-availability" {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+
+	metrics := map[string]prometheus.MetricSchema{
+		"http_requests_total": {Name: "http_requests_total", LabelValues: map[string][]string{
+			"service": {"cart", "checkout"},
+			"code":    {"200", "500"},
+		}},
+		"http_request_duration_seconds_bucket": {Name: "http_request_duration_seconds_bucket", LabelValues: map[string][]string{
+			"service": {"checkout"},
+			"le":      {"0.1", "0.25", "0.5", "+Inf"},
+		}},
+	}
+	sli, err := rules.DiscoverSLI(spec, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sli.Errors != `http_requests_total{service="checkout", code=~"5.."}` || sli.Total != `http_requests_total{service="checkout"}` {
+		t.Errorf("unexpected SLI %+v", sli)
+	}
+
+	result, err := rules.BuildSLO(spec, sli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.ValidationErrors) > 0 {
+		t.Fatalf("rule file is invalid: %v\n%s", result.ValidationErrors, result.YAML)
+	}
+	if len(result.BurnRates) != 4 || result.BurnRates[0].Factor != 14.4 || result.BurnRates[3].Factor != 1 {
+		t.Errorf("unexpected burn rates %+v", result.BurnRates)
+	}
+	for _, want := range []string{"slo:sli_error:ratio_rate5m", "slo:sli_error:ratio_rate30d", "slo:error_budget_remaining:ratio", "CheckoutAvailabilityBurnRateCritical"} {
+		if !strings.Contains(result.YAML, want) {
+			t.Errorf("rule file lacks %s", want)
+		}
+	}
+
+	spec, err = rules.ParseSLO("99% of checkout requests complete within 300ms over 7 days")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sli, err = rules.DiscoverSLI(spec, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sli.Good != `http_request_duration_seconds_bucket{service="checkout", le="0.5"}` || len(sli.Notes) != 1 {
+		t.Errorf("unexpected latency SLI %+v", sli)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agentkube/txt2promql/internal/session"
+	"github.com/agentkube/txt2promql/internal/types"
+)
+
+func TestMemoryStoreExpiresSessions(t *testing.T) {
+	store := session.NewMemoryStore(time.Millisecond)
+	s, err := store.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.Get(s.ID); err != session.ErrNotFound {
+		t.Fatalf("expected expired session, got %v", err)
+	}
+}
+
+func TestFileStoreReloadsSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := session.NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := store.Create()
+	s.Turns = append(s.Turns, session.Turn{
+		Question: "request rate",
+		Context:  &types.QueryContext{MainMetric: "http_requests_total"},
+		PromQL:   "rate(http_requests_total[5m])",
+	})
+	if err := store.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := session.NewFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Get(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Last().PromQL != "rate(http_requests_total[5m])" {
+		t.Fatalf("unexpected last turn: %+v", got.Last())
+	}
+}
+
+func TestStoreUpdateKeepsConcurrentTurns(t *testing.T) {
+	fileStore, err := session.NewFileStore(filepath.Join(t.TempDir(), "sessions.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]session.Store{
+		"memory": session.NewMemoryStore(time.Hour),
+		"file":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := store.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const n = 20
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					err := store.Update(s.ID, func(s *session.Session) error {
+						// Widen the window a lost update would need.
+						time.Sleep(time.Millisecond)
+						s.Turns = append(s.Turns, session.Turn{Question: fmt.Sprint(i)})
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			got, err := store.Get(s.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Turns) != n {
+				t.Errorf("got %d turns, want %d", len(got.Turns), n)
+			}
+
+			failed := errors.New("failed")
+			if err := store.Update(s.ID, func(s *session.Session) error {
+				s.Turns = nil
+				return failed
+			}); err != failed {
+				t.Errorf("got %v, want the update's error", err)
+			}
+			if got, _ := store.Get(s.ID); len(got.Turns) != n {
+				t.Error("failed update was saved")
+			}
+			if err := store.Update("missing", func(*session.Session) error { return nil }); err != session.ErrNotFound {
+				t.Errorf("missing session: got %v", err)
+			}
+		})
+	}
+}
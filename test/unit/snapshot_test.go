@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	from := &prometheus.Snapshot{Version: 1, Metrics: []prometheus.SnapshotMetric{
+		{Name: "up", Type: "gauge", Series: 2, Labels: []prometheus.SnapshotLabel{{Name: "job", Cardinality: 2}}},
+		{Name: "old_metric", Type: "gauge"},
+		{Name: "http_requests_total", Type: "counter", Series: 4, Labels: []prometheus.SnapshotLabel{
+			{Name: "code", Cardinality: 2}, {Name: "status", Cardinality: 2},
+		}},
+	}}
+	to := &prometheus.Snapshot{Version: 1, Metrics: []prometheus.SnapshotMetric{
+		{Name: "up", Type: "gauge", Series: 2, Labels: []prometheus.SnapshotLabel{{Name: "job", Cardinality: 2}}},
+		{Name: "new_metric", Type: "gauge"},
+		{Name: "http_requests_total", Type: "counter", Series: 9, Labels: []prometheus.SnapshotLabel{
+			{Name: "code", Cardinality: 3}, {Name: "method", Cardinality: 3},
+		}},
+	}}
+
+	diff := prometheus.DiffSnapshots(from, to)
+	if len(diff.Added) != 1 || diff.Added[0] != "new_metric" || len(diff.Removed) != 1 || diff.Removed[0] != "old_metric" {
+		t.Errorf("added %v, removed %v", diff.Added, diff.Removed)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("got %d changed metrics, want 1: %+v", len(diff.Changed), diff.Changed)
+	}
+
+	var b strings.Builder
+	diff.Write(&b)
+	want := `+ new_metric
+- old_metric
+~ http_requests_total
+    series 4 -> 9
+    + label method
+    - label status
+    label code cardinality 2 -> 3
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+	if !prometheus.DiffSnapshots(to, to).Empty() {
+		t.Error("a snapshot differs from itself")
+	}
+}
+
+func TestValidateAgainstSchema(t *testing.T) {
+	metrics := map[string]prometheus.MetricSchema{
+		"up": {Name: "up", Series: 3, LabelValues: map[string][]string{"job": {"api"}}},
+	}
+	tests := []struct {
+		query    string
+		valid    bool
+		warnings int
+	}{
+		{`sum by (job) (up{job="api"})`, true, 0},
+		{`up{cluster="eu"}`, true, 1},
+		{`rate(missing_total[5m])`, false, 0},
+		{`sum(up`, false, 0},
+	}
+	for _, tt := range tests {
+		res := prometheus.ValidateAgainstSchema(tt.query, metrics)
+		if res.Valid != tt.valid || len(res.Warnings) != tt.warnings || !res.Offline {
+			t.Errorf("%s: got %+v", tt.query, res)
+		}
+	}
+}
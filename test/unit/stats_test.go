@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agentkube/txt2promql/internal/agent"
+	"github.com/agentkube/txt2promql/internal/prometheus"
+)
+
+func TestQueryResultStats(t *testing.T) {
+	var result prometheus.QueryResult
+	body := `{"status":"success","data":{"resultType":"matrix","result":[
+		{"metric":{"__name__":"up","job":"api"},"values":[
+			[1700000000,"1"],[1700000060,"2"],[1700000120,"NaN"],[1700000180,"4"]
+		]}
+	]}}`
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := result.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(stats))
+	}
+	st := stats[0]
+	if st.Name != `up{job="api"}` {
+		t.Errorf("unexpected name %s", st.Name)
+	}
+	if st.Samples != 3 || st.Min != 1 || st.Max != 4 || st.Last != 4 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+	if st.Slope <= 0 {
+		t.Errorf("expected positive slope, got %v", st.Slope)
+	}
+
+	summary := agent.TemplateSummary(&result)
+	if !strings.Contains(summary, "peaked at 4") || !strings.Contains(summary, "trending up") {
+		t.Errorf("unexpected summary %q", summary)
+	}
+}
+
+// flatWithSpike returns a matrix of n samples a minute apart, all 1 except
+// the last, which is 100.
+func flatWithSpike(t *testing.T, n int) *prometheus.QueryResult {
+	t.Helper()
+	values := make([]string, n)
+	for i := range values {
+		v := "1"
+		if i == n-1 {
+			v = "100"
+		}
+		values[i] = fmt.Sprintf(`[%d,"%s"]`, 1700000000+60*i, v)
+	}
+	var result prometheus.QueryResult
+	body := `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"api"},"values":[` + strings.Join(values, ",") + `]}]}}`
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func TestSpikeDetectionAtMinimumSamples(t *testing.T) {
+	tests := []struct {
+		samples int
+		spikes  int
+	}{
+		{10, 0},
+		{11, 1},
+		{30, 1},
+	}
+	for _, tt := range tests {
+		st := flatWithSpike(t, tt.samples).Stats()[0]
+		if len(st.Spikes) != tt.spikes {
+			t.Errorf("%d samples: got spikes %+v, want %d", tt.samples, st.Spikes, tt.spikes)
+			continue
+		}
+		if tt.spikes > 0 && (st.Spikes[0].Value != 100 || st.Spikes[0].ZScore < 3) {
+			t.Errorf("%d samples: got spike %+v", tt.samples, st.Spikes[0])
+		}
+	}
+}
+
+func TestSummaryTimesAreUTC(t *testing.T) {
+	// The spike is at 1700000600, 22:23:20 UTC.
+	summary := agent.TemplateSummary(flatWithSpike(t, 11))
+	if !strings.Contains(summary, "peaked at 100 at 22:23 UTC") || !strings.Contains(summary, "the largest at 22:23 UTC") {
+		t.Errorf("unexpected summary %q", summary)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/agentkube/txt2promql/internal/chart"
+)
+
+func TestSparkline(t *testing.T) {
+	got := chart.Sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}, 80)
+	if got != "▁▂▃▄▅▆▇█" {
+		t.Fatalf("unexpected sparkline %q", got)
+	}
+	if n := utf8.RuneCountInString(chart.Sparkline(make([]float64, 100), 10)); n != 10 {
+		t.Fatalf("expected 10 runes, got %d", n)
+	}
+}
+
+func TestTerminalTableSortsByValue(t *testing.T) {
+	result := decodeResult(t, `{"data":{"resultType":"vector","result":[
+		{"metric":{"job":"api"},"value":[1,"1"]},
+		{"metric":{"job":"web"},"value":[1,"30"]}
+	]}}`)
+
+	var buf bytes.Buffer
+	chart.WriteTable(&buf, result.Series(), chart.TerminalOptions{Width: 40})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "web") || !strings.HasPrefix(lines[2], "api") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "\033[") {
+		t.Fatal("table contains color codes with color disabled")
+	}
+}